@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -10,13 +11,17 @@ import (
 
 	"github.com/VasySS/cloudru-load-balancer/internal/app"
 	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
 )
 
 func main() {
-	setupLogger()
-
 	cfg := config.MustInit()
 
+	if err := setupLogger(cfg.YAML.Log); err != nil {
+		slog.Error("failed to setup logger", slog.Any("error", err))
+		os.Exit(1)
+	}
+
 	slog.Info("starting the application")
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -27,12 +32,26 @@ func main() {
 	}
 }
 
-func setupLogger() {
-	slogLogger := slog.New(
-		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		}),
-	)
+func setupLogger(cfg config.Log) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("error parsing log level: %w", err)
+	}
+
+	componentLevels := make(map[string]slog.Level, len(cfg.Components))
+
+	for component, rawLevel := range cfg.Components {
+		var componentLevel slog.Level
+		if err := componentLevel.UnmarshalText([]byte(rawLevel)); err != nil {
+			return fmt.Errorf("error parsing log level of %q: %w", component, err)
+		}
+
+		componentLevels[component] = componentLevel
+	}
+
+	if err := logging.Setup(os.Stderr, logging.Format(cfg.Format), level, componentLevels); err != nil {
+		return fmt.Errorf("error creating log handler: %w", err)
+	}
 
-	slog.SetDefault(slogLogger)
+	return nil
 }
@@ -0,0 +1,185 @@
+// Package accesslog provides structured access logging with configurable formats and sinks.
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidTrustedProxy is returned when a trusted proxy is neither an IP nor a CIDR.
+var ErrInvalidTrustedProxy = errors.New("invalid trusted proxy")
+
+// Entry contains data about a single proxied request.
+type Entry struct {
+	Time            time.Time     `json:"time"`
+	RequestID       string        `json:"requestId"`
+	RemoteAddr      string        `json:"remoteAddr"`
+	Client          string        `json:"client"`
+	Method          string        `json:"method"`
+	URI             string        `json:"uri"`
+	Proto           string        `json:"proto"`
+	Status          int           `json:"status"`
+	Bytes           int           `json:"bytes"`
+	Duration        time.Duration `json:"duration"`
+	Backend         string        `json:"backend"`
+	UpstreamLatency time.Duration `json:"upstreamLatency"`
+	RateLimit       string        `json:"rateLimit"`
+	UserAgent       string        `json:"userAgent"`
+	Referer         string        `json:"referer"`
+}
+
+// Options contains settings for the access logger.
+type Options struct {
+	// BufferSize is the amount of entries that can wait for being written.
+	// Entries are dropped when the buffer is full, so requests are never blocked.
+	BufferSize int
+	// SampleSuccess is the share (0..1] of 2xx responses that are logged.
+	// Other responses are always logged.
+	SampleSuccess float64
+	// TrustedProxies are IPs and CIDRs of proxies, whose X-Forwarded-For header is used for the remote address.
+	TrustedProxies []string
+}
+
+// Logger writes access log entries asynchronously to a sink.
+type Logger struct {
+	format        Formatter
+	sink          io.WriteCloser
+	sampleSuccess float64
+	trusted       []netip.Prefix
+	entries       chan []byte
+	dropped       atomic.Int64
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	// mu guards entries from sending after Close, e.g. by upgraded connections closed during shutdown.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a new access logger and starts the writer goroutine.
+func New(format Formatter, sink io.WriteCloser, opts Options) (*Logger, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1024
+	}
+
+	if opts.SampleSuccess <= 0 || opts.SampleSuccess > 1 {
+		opts.SampleSuccess = 1
+	}
+
+	trusted := make([]netip.Prefix, 0, len(opts.TrustedProxies))
+
+	for _, raw := range opts.TrustedProxies {
+		prefix, err := parsePrefix(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTrustedProxy, raw)
+		}
+
+		trusted = append(trusted, prefix)
+	}
+
+	l := &Logger{
+		format:        format,
+		sink:          sink,
+		sampleSuccess: opts.SampleSuccess,
+		trusted:       trusted,
+		entries:       make(chan []byte, opts.BufferSize),
+		done:          make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// parsePrefix parses CIDR or a single IP.
+func parsePrefix(raw string) (netip.Prefix, error) {
+	if strings.Contains(raw, "/") {
+		return netip.ParsePrefix(raw) //nolint:wrapcheck
+	}
+
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Prefix{}, err //nolint:wrapcheck
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Log formats the entry and queues it for writing.
+func (l *Logger) Log(e Entry) {
+	if !l.sampled(e.Status) {
+		return
+	}
+
+	line, err := l.format.Format(e)
+	if err != nil {
+		slog.Error("failed to format access log entry", slog.Any("error", err))
+		return
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		l.dropped.Add(1)
+		return
+	}
+
+	select {
+	case l.entries <- line:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the amount of entries dropped because the buffer was full or the logger was closed.
+func (l *Logger) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close flushes queued entries and closes the sink.
+func (l *Logger) Close() error {
+	var err error
+
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		l.closed = true
+		close(l.entries)
+		l.mu.Unlock()
+
+		<-l.done
+
+		if closeErr := l.sink.Close(); closeErr != nil {
+			err = fmt.Errorf("error closing access log sink: %w", closeErr)
+		}
+	})
+
+	return err
+}
+
+func (l *Logger) sampled(status int) bool {
+	if status < 200 || status >= 300 || l.sampleSuccess >= 1 {
+		return true
+	}
+
+	//nolint:gosec
+	return rand.Float64() < l.sampleSuccess
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	for line := range l.entries {
+		if _, err := l.sink.Write(line); err != nil {
+			slog.Error("failed to write access log entry", slog.Any("error", err))
+		}
+	}
+}
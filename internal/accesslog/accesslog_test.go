@@ -0,0 +1,215 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/accesslog"
+)
+
+type bufferSink struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *bufferSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.Write(p)
+}
+
+func (s *bufferSink) Close() error { return nil }
+
+func testEntry(status int) accesslog.Entry {
+	return accesslog.Entry{
+		Time:       time.Date(2025, time.April, 1, 12, 30, 0, 0, time.UTC),
+		RemoteAddr: "10.0.0.1",
+		Method:     "GET",
+		URI:        "/api?q=1",
+		Proto:      "HTTP/1.1",
+		Status:     status,
+		Bytes:      42,
+		Duration:   time.Millisecond * 15,
+		Backend:    "localhost:8081",
+		RateLimit:  accesslog.RateLimitAllowed,
+		UserAgent:  "curl/8.0",
+		Referer:    "https://example.com",
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("common log format", func(t *testing.T) {
+		t.Parallel()
+
+		line, err := accesslog.NewCommonFormatter().Format(testEntry(200))
+		require.NoError(t, err)
+		assert.Equal(t,
+			`10.0.0.1 - - [01/Apr/2025:12:30:00 +0000] "GET /api?q=1 HTTP/1.1" 200 42`+"\n",
+			string(line),
+		)
+	})
+
+	t.Run("combined log format", func(t *testing.T) {
+		t.Parallel()
+
+		line, err := accesslog.NewCombinedFormatter().Format(testEntry(404))
+		require.NoError(t, err)
+		assert.Equal(t,
+			`10.0.0.1 - - [01/Apr/2025:12:30:00 +0000] "GET /api?q=1 HTTP/1.1" 404 42 "https://example.com" "curl/8.0"`+"\n",
+			string(line),
+		)
+	})
+
+	t.Run("json format", func(t *testing.T) {
+		t.Parallel()
+
+		line, err := accesslog.NewJSONFormatter().Format(testEntry(200))
+		require.NoError(t, err)
+
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal(line, &decoded))
+		assert.Equal(t, "localhost:8081", decoded["backend"])
+		assert.Equal(t, "15ms", decoded["duration"])
+		assert.Equal(t, "allowed", decoded["rateLimit"])
+		assert.InDelta(t, 200, decoded["status"], 0)
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		t.Parallel()
+
+		f, err := accesslog.NewTemplateFormatter("{{.Method}} {{.URI}} -> {{.Backend}} {{.Status}}")
+		require.NoError(t, err)
+
+		line, err := f.Format(testEntry(200))
+		require.NoError(t, err)
+		assert.Equal(t, "GET /api?q=1 -> localhost:8081 200\n", string(line))
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := accesslog.NewTemplateFormatter("{{.Method")
+		require.Error(t, err)
+	})
+}
+
+func TestLoggerSampling(t *testing.T) {
+	t.Parallel()
+
+	sink := &bufferSink{}
+	l, err := accesslog.New(accesslog.NewCommonFormatter(), sink, accesslog.Options{
+		SampleSuccess: 0.000001,
+	})
+	require.NoError(t, err)
+
+	for range 100 {
+		l.Log(testEntry(500))
+	}
+
+	require.NoError(t, l.Close())
+
+	lines := bytes.Count(sink.buf.Bytes(), []byte("\n"))
+	assert.Equal(t, 100, lines, "non-2xx responses must never be sampled out")
+}
+
+func TestLoggerClosed(t *testing.T) {
+	t.Parallel()
+
+	l, err := accesslog.New(accesslog.NewCommonFormatter(), &bufferSink{}, accesslog.Options{})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	// e.g. upgraded connections, that are closed after the logger during shutdown
+	assert.NotPanics(t, func() { l.Log(testEntry(200)) })
+	assert.Equal(t, int64(1), l.Dropped())
+}
+
+func TestRemoteAddr(t *testing.T) {
+	t.Parallel()
+
+	_, err := accesslog.New(accesslog.NewCommonFormatter(), &bufferSink{}, accesslog.Options{
+		TrustedProxies: []string{"10.0.0.0/33"},
+	})
+	require.ErrorIs(t, err, accesslog.ErrInvalidTrustedProxy)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"no header", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"untrusted client can't spoof the header", "192.0.2.1:1234", "203.0.113.5", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.2:1234", "203.0.113.5", "203.0.113.5"},
+		{"rightmost untrusted address", "10.0.0.2:1234", "198.51.100.1, 203.0.113.5, 10.0.0.3", "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := &bufferSink{}
+			l, err := accesslog.New(accesslog.NewCommonFormatter(), sink, accesslog.Options{
+				TrustedProxies: []string{"10.0.0.0/8"},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			l.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, l.Close())
+
+			assert.True(t, strings.HasPrefix(sink.buf.String(), tt.want+" "), sink.buf.String())
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	rf, err := accesslog.NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first-01\n", "second-2\n", "third-03\n", "fourth-4\n"} {
+		_, err := rf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, rf.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth-4\n", string(current))
+
+	backup, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "third-03\n", string(backup))
+
+	backup, err = os.ReadFile(path + ".2")
+	require.NoError(t, err)
+	assert.Equal(t, "second-2\n", string(backup))
+
+	_, err = os.Stat(path + ".3")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
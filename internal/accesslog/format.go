@@ -0,0 +1,134 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Formatter converts an entry to a single log line.
+type Formatter interface {
+	Format(e Entry) ([]byte, error)
+}
+
+// NewJSONFormatter returns a formatter, that writes entries as JSON objects.
+//
+//nolint:ireturn
+func NewJSONFormatter() Formatter {
+	return jsonFormatter{}
+}
+
+// NewCommonFormatter returns a formatter for Common Log Format.
+//
+//nolint:ireturn
+func NewCommonFormatter() Formatter {
+	return clfFormatter{combined: false}
+}
+
+// NewCombinedFormatter returns a formatter for Combined Log Format.
+//
+//nolint:ireturn
+func NewCombinedFormatter() Formatter {
+	return clfFormatter{combined: true}
+}
+
+// NewTemplateFormatter returns a formatter, that executes text/template over an Entry.
+//
+//nolint:ireturn
+func NewTemplateFormatter(tmpl string) (Formatter, error) {
+	t, err := template.New("accesslog").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing access log template: %w", err)
+	}
+
+	return templateFormatter{tmpl: t}, nil
+}
+
+type jsonFormatter struct{}
+
+// jsonEntry overrides durations of the entry to be human-readable.
+type jsonEntry struct {
+	Entry
+
+	Duration        string `json:"duration"`
+	UpstreamLatency string `json:"upstreamLatency,omitempty"`
+}
+
+func (jsonFormatter) Format(e Entry) ([]byte, error) {
+	je := jsonEntry{Entry: e, Duration: e.Duration.String()}
+	if e.UpstreamLatency > 0 {
+		je.UpstreamLatency = e.UpstreamLatency.String()
+	}
+
+	line, err := json.Marshal(je)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding access log entry: %w", err)
+	}
+
+	return append(line, '\n'), nil
+}
+
+// clfFormatter writes entries in Common or Combined Log Format.
+type clfFormatter struct {
+	combined bool
+}
+
+func (f clfFormatter) Format(e Entry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(dashIfEmpty(e.RemoteAddr))
+	buf.WriteString(" - - [")
+	buf.WriteString(e.Time.Format(clfTimeLayout))
+	buf.WriteString("] ")
+	buf.WriteString(strconv.Quote(e.Method + " " + e.URI + " " + e.Proto))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+
+	if e.Bytes > 0 {
+		buf.WriteString(strconv.Itoa(e.Bytes))
+	} else {
+		buf.WriteByte('-')
+	}
+
+	if f.combined {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Quote(dashIfEmpty(e.Referer)))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Quote(dashIfEmpty(e.UserAgent)))
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+type templateFormatter struct {
+	tmpl *template.Template
+}
+
+func (f templateFormatter) Format(e Entry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := f.tmpl.Execute(&buf, e); err != nil {
+		return nil, fmt.Errorf("error executing access log template: %w", err)
+	}
+
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,162 @@
+package accesslog
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RateLimit decisions, that are written to the access log.
+const (
+	RateLimitAllowed  = "allowed"
+	RateLimitRejected = "rejected"
+)
+
+type annotationsCtxKey struct{}
+
+// annotations contain values that are only known deeper in the handler chain.
+type annotations struct {
+	client          string
+	backend         string
+	rateLimit       string
+	upstreamLatency time.Duration
+}
+
+func annotationsFrom(ctx context.Context) *annotations {
+	a, _ := ctx.Value(annotationsCtxKey{}).(*annotations)
+	return a
+}
+
+// SetClient records the client identifier used for rate limiting.
+func SetClient(ctx context.Context, client string) {
+	if a := annotationsFrom(ctx); a != nil {
+		a.client = client
+	}
+}
+
+// SetRateLimit records the rate limit decision for the request.
+func SetRateLimit(ctx context.Context, decision string) {
+	if a := annotationsFrom(ctx); a != nil {
+		a.rateLimit = decision
+	}
+}
+
+// SetBackend records the backend chosen by the balancer.
+func SetBackend(ctx context.Context, backend string) {
+	if a := annotationsFrom(ctx); a != nil {
+		a.backend = backend
+	}
+}
+
+// SetUpstreamLatency records the time spent waiting for the backend.
+func SetUpstreamLatency(ctx context.Context, d time.Duration) {
+	if a := annotationsFrom(ctx); a != nil {
+		a.upstreamLatency = d
+	}
+}
+
+// Detach returns the context with separate annotations for a request, that is shared by several logged requests,
+// e.g. a coalesced one. CopyUpstream writes its backend and upstream latency to their entries.
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, annotationsCtxKey{}, &annotations{})
+}
+
+// CopyUpstream records the backend and the upstream latency of the shared request with the src context.
+// It must be called after the shared request is completed.
+func CopyUpstream(dst, src context.Context) {
+	from, to := annotationsFrom(src), annotationsFrom(dst)
+	if from == nil || to == nil {
+		return
+	}
+
+	to.backend = from.backend
+	to.upstreamLatency = from.upstreamLatency
+}
+
+// Middleware writes an access log entry for every request.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := &annotations{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			l.Log(Entry{
+				Time:            start,
+				RequestID:       middleware.GetReqID(r.Context()),
+				RemoteAddr:      l.remoteHost(r),
+				Client:          a.client,
+				Method:          r.Method,
+				URI:             r.RequestURI,
+				Proto:           r.Proto,
+				Status:          status,
+				Bytes:           ww.BytesWritten(),
+				Duration:        time.Since(start),
+				Backend:         a.backend,
+				UpstreamLatency: a.upstreamLatency,
+				RateLimit:       a.rateLimit,
+				UserAgent:       r.UserAgent(),
+				Referer:         r.Referer(),
+			})
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), annotationsCtxKey{}, a)))
+	})
+}
+
+// remoteHost returns the address of the client. X-Forwarded-For is only used, when the request comes
+// from a trusted proxy, the rightmost address, that isn't a trusted proxy, is the client.
+func (l *Logger) remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !l.isTrusted(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		host = addr
+
+		if !l.isTrusted(addr) {
+			break
+		}
+	}
+
+	return host
+}
+
+func (l *Logger) isTrusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range l.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
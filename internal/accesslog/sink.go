@@ -0,0 +1,139 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrSyslogUnsupported is returned when syslog sink is not available on the current platform.
+var ErrSyslogUnsupported = errors.New("syslog is not supported on this platform")
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Stdout returns a sink writing to standard output, which is not closed by the logger.
+//
+//nolint:ireturn
+func Stdout() io.WriteCloser {
+	return nopCloser{Writer: os.Stdout}
+}
+
+// RotatingFile is a file sink, that rotates the file when it exceeds the max size.
+// Rotated files are renamed to <path>.1, <path>.2 and so on, oldest ones are removed.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingFile opens (or creates) a file for appending access log entries.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating access log directory: %w", err)
+	}
+
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// Write writes p to the file, rotating it beforehand if needed.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize && rf.size > 0 {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	if err != nil {
+		return n, fmt.Errorf("error writing access log file: %w", err)
+	}
+
+	return n, nil
+}
+
+// Close closes the underlying file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("error closing access log file: %w", err)
+	}
+
+	return nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("error opening access log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error reading access log file info: %w", err)
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("error closing access log file: %w", err)
+	}
+
+	if rf.maxBackups <= 0 {
+		if err := os.Remove(rf.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing access log file: %w", err)
+		}
+
+		return rf.open()
+	}
+
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		from := rf.backupName(i)
+		if err := os.Rename(from, rf.backupName(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error rotating access log backup: %w", err)
+		}
+	}
+
+	if err := os.Rename(rf.path, rf.backupName(1)); err != nil {
+		return fmt.Errorf("error rotating access log file: %w", err)
+	}
+
+	return rf.open()
+}
+
+func (rf *RotatingFile) backupName(n int) string {
+	return rf.path + "." + strconv.Itoa(n)
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !plan9
+
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// NewSyslog connects to a syslog daemon. Empty network and address connect to the local daemon.
+//
+//nolint:ireturn
+func NewSyslog(network, address, tag string) (io.WriteCloser, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to syslog: %w", err)
+	}
+
+	return w, nil
+}
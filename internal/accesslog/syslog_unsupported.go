@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package accesslog
+
+import "io"
+
+// NewSyslog is not supported on this platform and always returns an error.
+//
+//nolint:ireturn
+func NewSyslog(_, _, _ string) (io.WriteCloser, error) {
+	return nil, ErrSyslogUnsupported
+}
@@ -5,21 +5,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
-	"os"
-	"time"
+	"slices"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
-	"github.com/VasySS/cloudru-load-balancer/internal/backend"
-	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/accesslog"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
 	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/admin"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
 	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
 	"github.com/VasySS/cloudru-load-balancer/internal/infrastructure/repository/postgres"
-	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
-	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit/leakybucket"
-	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit/tokenbucket"
+)
+
+var (
+	// ErrUnknownAccessLogFormat is returned when access log format from config is not supported.
+	ErrUnknownAccessLogFormat = errors.New("unknown access log format")
+	// ErrUnknownAccessLogOutput is returned when access log output from config is not supported.
+	ErrUnknownAccessLogOutput = errors.New("unknown access log output")
+	// ErrUnknownClientIdentity is returned when client certificate identity from config is not supported.
+	ErrUnknownClientIdentity = errors.New("unknown client certificate identity")
 )
 
 // Run starts the application.
@@ -39,16 +49,128 @@ func Run(ctx context.Context, cfg config.Config) error {
 		return err
 	}
 
-	rateLimiter := newRateLimiter(cfg, pgRepo, closer)
+	pools, err := newPools(ctx, cfg, pgRepo, closer)
+	if err != nil {
+		return err
+	}
+
+	var proxyOpts []proxy.Option
 
-	loadBalancer, err := newLoadBalancer(ctx, cfg)
+	if *cfg.YAML.AccessLog.Enabled {
+		accessLogger, err := newAccessLogger(cfg.YAML.AccessLog, closer)
+		if err != nil {
+			return err
+		}
+
+		proxyOpts = append(proxyOpts, proxy.WithAccessLog(accessLogger))
+	}
+
+	responseCache, err := newCache(cfg)
 	if err != nil {
 		return err
 	}
 
-	r := proxy.New(rateLimiter, loadBalancer)
+	geo, err := newGeoDB(ctx, cfg.YAML.GeoIP)
+	if err != nil {
+		return err
+	}
+
+	routes, err := newRoutes(cfg, pools, responseCache, geo)
+	if err != nil {
+		return err
+	}
+
+	if cfg.YAML.TLS.Enabled && cfg.YAML.TLS.HSTS.Enabled {
+		proxyOpts = append(proxyOpts, proxy.WithHSTS(
+			cfg.YAML.TLS.HSTS.MaxAge,
+			cfg.YAML.TLS.HSTS.IncludeSubdomains,
+			cfg.YAML.TLS.HSTS.Preload,
+		))
+	}
+
+	if cfg.YAML.TLS.Enabled && cfg.YAML.TLS.ClientAuth.Enabled {
+		identity, err := newCertIdentity(cfg.YAML.TLS.ClientAuth.Identity)
+		if err != nil {
+			return err
+		}
+
+		proxyOpts = append(proxyOpts, proxy.WithClientCert(identity, cfg.YAML.TLS.ClientAuth.Header))
+	}
+
+	proxyOpts = append(proxyOpts,
+		proxy.WithUpgradeLimit(*cfg.YAML.Upgrade.MaxPerClient),
+		proxy.WithUpgradeDrain(cfg.YAML.Upgrade.DrainTimeout),
+	)
 
-	go startHTTP(closer, r, cfg.ENV.Port)
+	var globalConcurrency *concurrency.Limiter
+	if cfg.YAML.ConcurrencyLimit.Enabled {
+		globalConcurrency = newConcurrencyLimiter(cfg.YAML.ConcurrencyLimit, "global")
+		proxyOpts = append(proxyOpts, proxy.WithConcurrencyLimit(globalConcurrency))
+	}
+
+	maintenance, pages, err := newMaintenance(cfg)
+	if err != nil {
+		return err
+	}
+
+	proxyOpts = append(proxyOpts, proxy.WithErrorPages(pages), proxy.WithMaintenance(maintenance))
+
+	r := proxy.New(routes, proxyOpts...)
+	// added before the servers, so upgraded connections are closed after the servers stop accepting requests,
+	// and before the access log is closed
+	closer.AddWithCtx(r.ShutdownUpgraded)
+
+	proxyServer := serverConfig{
+		settings:  cfg.YAML.Server,
+		protocols: newProtocols(cfg.YAML.HTTP2),
+	}
+
+	if cfg.YAML.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(ctx, cfg.YAML.TLS)
+		if err != nil {
+			return err
+		}
+
+		go startHTTPS(closer, r, cfg.ENV.TLSPort, tlsConfig, proxyServer)
+
+		if cfg.YAML.TLS.RedirectHTTP {
+			redirect := middleware.RedirectHTTPS(cfg.ENV.TLSPort)
+			go startHTTP(closer, redirect, cfg.ENV.Port, serverConfig{settings: cfg.YAML.Server})
+		} else {
+			go startHTTP(closer, r, cfg.ENV.Port, proxyServer)
+		}
+	} else {
+		go startHTTP(closer, r, cfg.ENV.Port, proxyServer)
+	}
+
+	l4Pools, err := newL4Pools(ctx, cfg, pgRepo, closer)
+	if err != nil {
+		return err
+	}
+
+	if err := startL4(closer, cfg.YAML.L4.Listeners, l4Pools); err != nil {
+		return err
+	}
+
+	allPools := slices.Concat(pools, l4Pools)
+	replicas, err := startCluster(ctx, closer, cfg, allPools)
+	if err != nil {
+		return err
+	}
+
+	adminServer := admin.New(admin.State{
+		Pools:       allPools,
+		Maintenance: maintenance,
+		Cache:       responseCache,
+		Access:      routeAccess(routes),
+		Concurrency: globalConcurrency,
+		Cluster:     replicas,
+	}, cfg.ENV.AdminToken)
+
+	go startHTTP(closer, adminServer, cfg.ENV.AdminPort, serverConfig{
+		settings: cfg.YAML.Server,
+		host:     cfg.ENV.AdminHost,
+	})
 
 	<-ctx.Done()
 	slog.Info("gracefully shutting down...")
@@ -64,24 +186,6 @@ func Run(ctx context.Context, cfg config.Config) error {
 	return nil
 }
 
-func startHTTP(closer *Closer, r http.Handler, port string) {
-	srv := &http.Server{
-		Addr:         ":" + port,
-		Handler:      r,
-		ReadTimeout:  time.Second * 10,
-		WriteTimeout: time.Second * 10,
-		IdleTimeout:  time.Second * 10,
-	}
-
-	slog.Info("starting http server", slog.String("addr", srv.Addr))
-	closer.AddWithCtx(srv.Shutdown)
-
-	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-		slog.Error("failed to start http server")
-		os.Exit(1)
-	}
-}
-
 func newPostgresRepo(ctx context.Context, closer *Closer, connectionURL string) (*postgres.Repository, error) {
 	pool, err := pgxpool.New(ctx, connectionURL)
 	if err != nil {
@@ -101,64 +205,155 @@ func newPostgresRepo(ctx context.Context, closer *Closer, connectionURL string)
 	return pgRepo, nil
 }
 
-//nolint:ireturn
-func newLoadBalancer(ctx context.Context, cfg config.Config) (balancer.Balancer, error) {
-	backends, err := backend.NewBackendServers(ctx, cfg.YAML.Backends, cfg.YAML.Balancer.BackendsCheckInterval)
+func newAccessLogger(cfg config.AccessLog, closer *Closer) (*accesslog.Logger, error) {
+	var (
+		formatter accesslog.Formatter
+		err       error
+	)
+
+	switch cfg.Format {
+	case config.JSONAccessLogFormat:
+		formatter = accesslog.NewJSONFormatter()
+	case config.CommonAccessLogFormat:
+		formatter = accesslog.NewCommonFormatter()
+	case config.CombinedAccessLogFormat:
+		formatter = accesslog.NewCombinedFormatter()
+	case config.TemplateAccessLogFormat:
+		formatter, err = accesslog.NewTemplateFormatter(cfg.Template)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownAccessLogFormat, cfg.Format)
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("error creating backends array: %w", err)
+		return nil, fmt.Errorf("error creating access log formatter: %w", err)
+	}
+
+	var sink io.WriteCloser
+
+	switch cfg.Output {
+	case config.StdoutAccessLogOutput:
+		sink = accesslog.Stdout()
+	case config.FileAccessLogOutput:
+		sink, err = accesslog.NewRotatingFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.MaxBackups)
+	case config.SyslogAccessLogOutput:
+		sink, err = accesslog.NewSyslog(cfg.Syslog.Network, cfg.Syslog.Address, cfg.Syslog.Tag)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownAccessLogOutput, cfg.Output)
 	}
 
-	// convert to balancer interface to pass the array
-	balancerBackends := make([]balancer.BackendServer, 0, len(backends))
-	for _, backend := range backends {
-		balancerBackends = append(balancerBackends, backend)
+	if err != nil {
+		return nil, fmt.Errorf("error creating access log output: %w", err)
 	}
 
-	var loadBalancer balancer.Balancer
+	slog.Info("access log enabled",
+		slog.String("format", string(cfg.Format)),
+		slog.String("output", string(cfg.Output)),
+	)
+
+	accessLogger, err := accesslog.New(formatter, sink, accesslog.Options{
+		BufferSize:     cfg.BufferSize,
+		SampleSuccess:  cfg.SampleSuccess,
+		TrustedProxies: cfg.TrustedProxies,
+	})
+	if err != nil {
+		//nolint:errcheck
+		sink.Close()
+
+		return nil, fmt.Errorf("error creating access logger: %w", err)
+	}
+
+	closer.AddWithError(accessLogger.Close)
+
+	return accessLogger, nil
+}
 
-	switch cfg.YAML.Balancer.Type {
-	case config.LeastConnectionsType:
-		slog.Info("using least connections algorithm for load balancing")
+func newCertIdentity(identity config.ClientIdentity) (middleware.CertIdentity, error) {
+	switch identity {
+	case config.SubjectClientIdentity:
+		return middleware.SubjectIdentity, nil
+	case config.SANClientIdentity:
+		return middleware.SANIdentity, nil
+	}
 
-		loadBalancer = balancer.NewLeastConnections(balancerBackends)
-	case config.RandomType:
-		slog.Info("using random select for load balancing")
+	return nil, fmt.Errorf("%w: %q", ErrUnknownClientIdentity, identity)
+}
 
-		loadBalancer = balancer.NewRandom(balancerBackends)
-	case config.RoundRobinType:
-		slog.Info("using round robin algorithm for load balancing")
+// newMaintenance loads error pages and creates maintenance mode, pages are nil if they are not configured.
+func newMaintenance(cfg config.Config) (*middleware.Maintenance, *problem.Pages, error) {
+	var (
+		pages *problem.Pages
+		err   error
+	)
 
-		loadBalancer = balancer.NewRoundRobin(balancerBackends)
+	if cfg.YAML.ErrorPages.Dir != "" {
+		pages, err = problem.LoadPages(cfg.YAML.ErrorPages.Dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading error pages: %w", err)
+		}
 	}
 
-	return loadBalancer, nil
+	maintenance, err := middleware.NewMaintenance(middleware.MaintenanceState{
+		Enabled:    cfg.YAML.Maintenance.Enabled,
+		RetryAfter: int(cfg.YAML.Maintenance.RetryAfter.Seconds()),
+		AllowedIPs: cfg.YAML.Maintenance.AllowedIPs,
+	}, pages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating maintenance mode: %w", err)
+	}
+
+	return maintenance, pages, nil
 }
 
-//nolint:ireturn
-func newRateLimiter(cfg config.Config, pgRepo *postgres.Repository, closer *Closer) ratelimit.Limiter {
-	var rateLimiter ratelimit.Limiter
+// newGeoDB loads the country database of access rules, it's nil if no database is configured.
+func newGeoDB(ctx context.Context, cfg config.GeoIP) (*access.GeoDB, error) {
+	if cfg.Database == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	geo, err := access.OpenGeoDB(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geo database: %w", err)
+	}
+
+	if *cfg.ReloadInterval > 0 {
+		go geo.WatchReload(ctx, *cfg.ReloadInterval)
+	}
+
+	slog.Info("geo database loaded", slog.String("path", cfg.Database))
 
-	switch cfg.YAML.RateLimit.Type {
-	case config.TokenBucketType:
-		slog.Info("using token bucket algorithm for rate limiting")
+	return geo, nil
+}
 
-		tokenBucket := tokenbucket.NewUserBucket(pgRepo,
-			cfg.YAML.RateLimit.Capacity,
-			cfg.YAML.RateLimit.TokenRate,
-			cfg.YAML.RateLimit.TokenInterval,
-		)
-		closer.Add(tokenBucket.Stop)
+// routeAccess returns access lists of routes in their configured order.
+func routeAccess(routes []proxy.Route) []*access.List {
+	res := make([]*access.List, 0, len(routes))
+	for _, rt := range routes {
+		res = append(res, rt.Access)
+	}
 
-		rateLimiter = tokenBucket
-	case config.LeakyBucketType:
-		slog.Info("using leaky bucket algorithm for rate limiting")
+	return res
+}
 
-		rateLimiter = leakybucket.NewUserBucket(pgRepo,
-			cfg.YAML.RateLimit.Capacity,
-			cfg.YAML.RateLimit.TokenRate,
-			cfg.YAML.RateLimit.TokenInterval,
-		)
+// newCache creates the response cache, it's nil if no route enables caching.
+func newCache(cfg config.Config) (*cache.Cache, error) {
+	if !slices.ContainsFunc(cfg.YAML.Routes, func(r config.Route) bool { return r.Cache }) {
+		return nil, nil //nolint:nilnil
 	}
 
-	return rateLimiter
+	responseCache, err := cache.New(cache.Options{
+		MaxBytes:      int64(cfg.YAML.Cache.MaxSizeMB) << 20,
+		MaxEntryBytes: int64(cfg.YAML.Cache.MaxEntrySizeKB) << 10,
+		DiskDir:       cfg.YAML.Cache.Disk.Dir,
+		DiskMaxBytes:  int64(cfg.YAML.Cache.Disk.MaxSizeMB) << 20,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating response cache: %w", err)
+	}
+
+	slog.Info("response cache enabled",
+		slog.Int("maxSizeMB", cfg.YAML.Cache.MaxSizeMB),
+		slog.String("diskDir", cfg.YAML.Cache.Disk.Dir),
+	)
+
+	return responseCache, nil
 }
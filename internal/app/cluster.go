@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/cluster"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+)
+
+// startCluster starts the gossip listener and rounds of the cluster, it's nil if cluster mode is disabled.
+func startCluster(
+	ctx context.Context,
+	closer *Closer,
+	cfg config.Config,
+	pools []*pool.Pool,
+) (*cluster.Cluster, error) {
+	if !cfg.YAML.Cluster.Enabled {
+		return nil, nil //nolint:nilnil
+	}
+
+	c, err := cluster.New(pools, cluster.Options{
+		Node:     cfg.YAML.Cluster.Node,
+		Peers:    cfg.YAML.Cluster.Peers,
+		Interval: cfg.YAML.Cluster.Interval,
+		Fanout:   cfg.YAML.Cluster.Fanout,
+		Quorum:   cfg.YAML.Cluster.Quorum,
+		StateTTL: cfg.YAML.Cluster.StateTTL,
+		Secret:   cfg.ENV.Cluster.Secret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating cluster: %w", err)
+	}
+
+	go startHTTP(closer, c.Handler(), cfg.ENV.Cluster.Port, serverConfig{settings: cfg.YAML.Server})
+	go c.Run(ctx)
+
+	slog.Info("cluster mode enabled",
+		slog.String("node", cfg.YAML.Cluster.Node),
+		slog.Any("peers", cfg.YAML.Cluster.Peers),
+		slog.Int("quorum", cfg.YAML.Cluster.Quorum),
+	)
+
+	return c, nil
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/discovery"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/tlsconfig"
+)
+
+const (
+	// discoveryTimeout limits requests to discovery sources.
+	discoveryTimeout = time.Second * 10
+	// discoveryStartupTimeout limits the first discovery of all pools together, so unavailable sources
+	// don't delay the start, the next discoveries happen in the background.
+	discoveryStartupTimeout = time.Second * 3
+)
+
+// startDiscovery discovers backends of the pool once until startup is done, so it starts with them,
+// and keeps refreshing them until ctx is done. Configured backends are used, if the first discovery fails.
+func startDiscovery(
+	ctx, startup context.Context,
+	p *pool.Pool,
+	cfg config.Pool,
+	registry *backend.Registry,
+) error {
+	provider, err := newDiscoveryProvider(*cfg.Discovery)
+	if err != nil {
+		return fmt.Errorf("error creating discovery of pool %q: %w", p.Name, err)
+	}
+
+	watcher := discovery.NewWatcher(provider, cfg.Backends, discovery.WatcherOptions{
+		Name:     p.Name,
+		Interval: cfg.Discovery.Interval,
+		Update: func(urls []string) {
+			updateBackends(p, registry, urls)
+		},
+	})
+
+	watcher.Refresh(startup)
+
+	go watcher.Run(ctx)
+
+	slog.Info("backend discovery started",
+		slog.String("pool", p.Name),
+		slog.String("type", string(cfg.Discovery.Type)),
+		slog.Duration("interval", cfg.Discovery.Interval),
+	)
+
+	return nil
+}
+
+//nolint:ireturn
+func newDiscoveryProvider(cfg config.Discovery) (discovery.Provider, error) {
+	client := &http.Client{Timeout: discoveryTimeout}
+
+	switch cfg.Type {
+	case config.DNSDiscoveryType:
+		provider, err := discovery.NewDNS(discovery.DNSOptions{
+			Name:       cfg.DNS.Name,
+			RecordType: dnsRecordType(cfg.DNS.RecordType),
+			Port:       cfg.DNS.Port,
+			Scheme:     cfg.Scheme,
+			Server:     cfg.DNS.Server,
+			Timeout:    discoveryTimeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating dns discovery: %w", err)
+		}
+
+		return provider, nil
+	case config.FileDiscoveryType:
+		return discovery.NewFile(cfg.File.Path), nil
+	case config.ConsulDiscoveryType:
+		return discovery.NewConsul(discovery.ConsulOptions{
+			Address:    cfg.Consul.Address,
+			Service:    cfg.Consul.Service,
+			Tag:        cfg.Consul.Tag,
+			Datacenter: cfg.Consul.Datacenter,
+			Token:      cfg.Consul.Token,
+			Scheme:     cfg.Scheme,
+			Client:     client,
+		}), nil
+	case config.KubernetesDiscoveryType:
+		// the CA of the cluster is only needed for https:// API servers, e.g. not for kubectl proxy
+		if strings.HasPrefix(cfg.Kubernetes.Address, "https://") {
+			tlsConfig, err := tlsconfig.NewClientConfig(tlsconfig.ClientOptions{CAFile: cfg.Kubernetes.CAFile})
+			if err != nil {
+				return nil, fmt.Errorf("error creating kubernetes TLS config: %w", err)
+			}
+
+			//nolint:forcetypeassert
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = tlsConfig
+			client.Transport = transport
+		}
+
+		return discovery.NewKubernetes(discovery.KubernetesOptions{
+			Address:   cfg.Kubernetes.Address,
+			Namespace: cfg.Kubernetes.Namespace,
+			Service:   cfg.Kubernetes.Service,
+			PortName:  cfg.Kubernetes.PortName,
+			TokenFile: cfg.Kubernetes.TokenFile,
+			Scheme:    cfg.Scheme,
+			Client:    client,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown type %q", config.ErrInvalidDiscovery, cfg.Type)
+}
+
+func dnsRecordType(recordType config.DNSRecordType) discovery.RecordType {
+	switch recordType {
+	case config.AAAARecord:
+		return discovery.AAAARecord
+	case config.SRVRecord:
+		return discovery.SRVRecord
+	case config.ARecord:
+	}
+
+	return discovery.ARecord
+}
+
+// updateBackends replaces backends of the pool with the discovered ones. The registry keeps backends,
+// that are still discovered, so their connections, health and ejection state are preserved.
+func updateBackends(p *pool.Pool, registry *backend.Registry, urls []string) {
+	backends, err := registry.Reconcile(urls)
+	if err != nil {
+		slog.Error("failed to add discovered backends", slog.String("pool", p.Name), slog.Any("error", err))
+	}
+
+	p.SetBackends(backends)
+}
@@ -0,0 +1,15 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+)
+
+// NewUpstreamTransport exports newUpstreamTransport for tests.
+var NewUpstreamTransport = newUpstreamTransport
+
+// NewServer exports newServer for tests.
+func NewServer(settings config.Server) *http.Server {
+	return newServer(http.NotFoundHandler(), "0", serverConfig{settings: settings})
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/infrastructure/repository/postgres"
+	"github.com/VasySS/cloudru-load-balancer/internal/l4"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+// newL4Pools creates backends, balancers and rate limiters for layer-4 pools.
+// Every pool has its own limiter of new connections per source IP.
+func newL4Pools(
+	ctx context.Context,
+	cfg config.Config,
+	pgRepo *postgres.Repository,
+	closer *Closer,
+) ([]*pool.Pool, error) {
+	pools := make([]*pool.Pool, 0, len(cfg.YAML.L4.Pools))
+
+	for _, poolCfg := range cfg.YAML.L4.Pools {
+		// backends are host:port addresses, scheme is needed to parse them as URLs
+		urls := make([]string, 0, len(poolCfg.Backends))
+		for _, addr := range poolCfg.Backends {
+			urls = append(urls, "tcp://"+addr)
+		}
+
+		healthCheckType := backend.TCPHealthCheck
+		if poolCfg.HealthCheck.IsDisabled() {
+			healthCheckType = backend.NoHealthCheck
+		}
+
+		backends, err := backend.NewBackendServers(ctx, urls, backend.Options{
+			HealthCheckInterval: poolCfg.Balancer.BackendsCheckInterval,
+			HealthCheckTimeout:  poolCfg.HealthCheck.Timeout,
+			HealthCheckType:     healthCheckType,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating backends of layer-4 pool %q: %w", poolCfg.Name, err)
+		}
+
+		rateLimit := *poolCfg.RateLimit
+
+		slog.Info("created layer-4 backend pool",
+			slog.String("pool", poolCfg.Name),
+			slog.Int("backends", len(backends)),
+			slog.String("balancer", string(poolCfg.Balancer.Type)),
+			slog.String("rateLimit", string(rateLimit.Type)),
+		)
+
+		pools = append(pools, &pool.Pool{
+			Name:         poolCfg.Name,
+			BalancerType: poolCfg.Balancer.Type,
+			RateLimit:    rateLimit,
+			Balancer:     newLoadBalancer(poolCfg.Balancer.Type, backends),
+			Limiter:      ratelimit.NewRejectionTracker(newRateLimiter(rateLimit, pgRepo, closer), 0),
+			Backends:     backends,
+		})
+	}
+
+	return pools, nil
+}
+
+// startL4 starts all layer-4 listeners.
+func startL4(closer *Closer, listeners []config.L4Listener, pools []*pool.Pool) error {
+	poolsByName := make(map[string]*pool.Pool, len(pools))
+	for _, p := range pools {
+		poolsByName[p.Name] = p
+	}
+
+	for _, l := range listeners {
+		opts := l4.Options{
+			DialTimeout: l.DialTimeout,
+			IdleTimeout: l.IdleTimeout,
+		}
+
+		switch l.Protocol {
+		case config.TCPProtocol:
+			ln, err := net.Listen("tcp", l.Address)
+			if err != nil {
+				return fmt.Errorf("error listening on %q: %w", l.Address, err)
+			}
+
+			tp := l4.NewTCPProxy(poolsByName[l.Pool], opts)
+			closer.AddWithCtx(tp.Shutdown)
+
+			go serveL4(l, func() error { return tp.Serve(ln) })
+		case config.UDPProtocol:
+			addr, err := net.ResolveUDPAddr("udp", l.Address)
+			if err != nil {
+				return fmt.Errorf("error resolving %q: %w", l.Address, err)
+			}
+
+			conn, err := net.ListenUDP("udp", addr)
+			if err != nil {
+				return fmt.Errorf("error listening on %q: %w", l.Address, err)
+			}
+
+			up := l4.NewUDPProxy(poolsByName[l.Pool], opts)
+			closer.AddWithCtx(up.Shutdown)
+
+			go serveL4(l, func() error { return up.Serve(conn) })
+		}
+	}
+
+	return nil
+}
+
+func serveL4(l config.L4Listener, serve func() error) {
+	slog.Info("starting layer-4 listener",
+		slog.String("name", l.Name),
+		slog.String("protocol", string(l.Protocol)),
+		slog.String("addr", l.Address),
+		slog.String("pool", l.Pool),
+	)
+
+	if err := serve(); !errors.Is(err, l4.ErrProxyClosed) {
+		slog.Error("layer-4 listener failed", slog.String("addr", l.Address), slog.Any("error", err))
+		os.Exit(1)
+	}
+}
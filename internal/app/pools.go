@@ -0,0 +1,369 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/coalesce"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/compress"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/rewrite"
+	"github.com/VasySS/cloudru-load-balancer/internal/infrastructure/repository/postgres"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit/leakybucket"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit/tokenbucket"
+	"github.com/VasySS/cloudru-load-balancer/internal/tlsconfig"
+)
+
+// newPools creates backends, balancers and rate limiters for every configured pool.
+// Pools without their own rate limit policy share the global rate limiter.
+func newPools(
+	ctx context.Context,
+	cfg config.Config,
+	pgRepo *postgres.Repository,
+	closer *Closer,
+) ([]*pool.Pool, error) {
+	var globalLimiter *ratelimit.RejectionTracker
+
+	pools := make([]*pool.Pool, 0, len(cfg.YAML.Pools))
+
+	discoveryStartup, cancel := context.WithTimeout(ctx, discoveryStartupTimeout)
+	defer cancel()
+
+	for _, poolCfg := range cfg.YAML.Pools {
+		transport, err := newUpstreamTransport(poolCfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating transport of pool %q: %w", poolCfg.Name, err)
+		}
+
+		backendOpts := backend.Options{
+			Transport:           transport,
+			HealthCheckPath:     poolCfg.HealthCheck.Path,
+			HealthCheckInterval: poolCfg.Balancer.BackendsCheckInterval,
+			HealthCheckTimeout:  poolCfg.HealthCheck.Timeout,
+			HealthCheckType:     healthCheckType(poolCfg.Protocol),
+			GRPCHealthService:   poolCfg.HealthCheck.Service,
+			PassiveHealth: backend.PassiveHealth{
+				MaxFailures:   *poolCfg.HealthCheck.Passive.MaxFailures,
+				EjectDuration: poolCfg.HealthCheck.Passive.EjectDuration,
+			},
+			MaxConnections: int64(poolCfg.Balancer.MaxConnections),
+			SlowStart:      poolCfg.Balancer.SlowStart,
+		}
+
+		registry := backend.NewRegistry(ctx, backendOpts)
+		closer.Add(registry.Close)
+
+		backends, err := registry.Reconcile(poolCfg.Backends)
+		if err != nil {
+			return nil, fmt.Errorf("error creating backends of pool %q: %w", poolCfg.Name, err)
+		}
+
+		rateLimit := cfg.YAML.RateLimit
+
+		var limiter *ratelimit.RejectionTracker
+
+		if poolCfg.RateLimit != nil {
+			rateLimit = *poolCfg.RateLimit
+			limiter = ratelimit.NewRejectionTracker(newRateLimiter(rateLimit, pgRepo, closer), 0)
+		} else {
+			if globalLimiter == nil {
+				globalLimiter = ratelimit.NewRejectionTracker(newRateLimiter(rateLimit, pgRepo, closer), 0)
+			}
+
+			limiter = globalLimiter
+		}
+
+		slog.Info("created backend pool",
+			slog.String("pool", poolCfg.Name),
+			slog.Int("backends", len(backends)),
+			slog.String("balancer", string(poolCfg.Balancer.Type)),
+			slog.String("rateLimit", string(rateLimit.Type)),
+		)
+
+		var poolConcurrency *concurrency.Limiter
+		if poolCfg.ConcurrencyLimit != nil && poolCfg.ConcurrencyLimit.Enabled {
+			poolConcurrency = newConcurrencyLimiter(*poolCfg.ConcurrencyLimit, poolCfg.Name)
+		}
+
+		var requestQueue *queue.Queue
+		if poolCfg.Queue.Enabled {
+			requestQueue = queue.New(queue.Options{
+				MaxSize:          poolCfg.Queue.MaxSize,
+				MaxWait:          poolCfg.Queue.MaxWait,
+				PriorityHeader:   poolCfg.Queue.PriorityHeader,
+				ClientPriorities: poolCfg.Queue.ClientPriorities,
+			})
+		}
+
+		p := &pool.Pool{
+			Name:         poolCfg.Name,
+			BalancerType: poolCfg.Balancer.Type,
+			RateLimit:    rateLimit,
+			Balancer:     newLoadBalancer(poolCfg.Balancer.Type, backends),
+			Limiter:      limiter,
+			Backends:     backends,
+			Concurrency:  poolConcurrency,
+			Queue:        requestQueue,
+		}
+
+		if poolCfg.Discovery != nil {
+			if err := startDiscovery(ctx, discoveryStartup, p, poolCfg, registry); err != nil {
+				return nil, err
+			}
+		}
+
+		pools = append(pools, p)
+	}
+
+	return pools, nil
+}
+
+// newUpstreamTransport creates a transport for proxied requests and health checks of the pool.
+func newUpstreamTransport(cfg config.Pool) (*http.Transport, error) {
+	tlsConfig, err := tlsconfig.NewClientConfig(tlsconfig.ClientOptions{
+		CAFile:             cfg.UpstreamTLS.CAFile,
+		CertFile:           cfg.UpstreamTLS.CertFile,
+		KeyFile:            cfg.UpstreamTLS.KeyFile,
+		ServerName:         cfg.UpstreamTLS.ServerName,
+		InsecureSkipVerify: cfg.UpstreamTLS.SkipVerify(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating upstream TLS config: %w", err)
+	}
+
+	//nolint:forcetypeassert
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.Transport.DialTimeout,
+		KeepAlive: cfg.Transport.KeepAlive,
+	}).DialContext
+	transport.MaxIdleConnsPerHost = cfg.Transport.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.Transport.IdleConnTimeout
+	transport.ResponseHeaderTimeout = cfg.Transport.HeaderTimeout()
+	transport.ExpectContinueTimeout = cfg.Transport.ExpectContinueTimeout
+
+	var protocols http.Protocols
+
+	switch cfg.Protocol {
+	case config.AutoUpstreamProtocol:
+		return transport, nil
+	case config.HTTP1UpstreamProtocol:
+		protocols.SetHTTP1(true)
+	case config.HTTP2UpstreamProtocol, config.GRPCUpstreamProtocol:
+		// without HTTP/1 in the set, http:// backends are reached with h2c
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	transport.Protocols = &protocols
+
+	return transport, nil
+}
+
+func healthCheckType(protocol config.UpstreamProtocol) backend.HealthCheckType {
+	if protocol == config.GRPCUpstreamProtocol {
+		return backend.GRPCHealthCheck
+	}
+
+	return backend.HTTPHealthCheck
+}
+
+// newRoutes creates proxy routes, routes with enabled caching share the response cache.
+// Every route gets an access list, so its rules can be set by the admin API.
+func newRoutes(
+	cfg config.Config,
+	pools []*pool.Pool,
+	responseCache *cache.Cache,
+	geo *access.GeoDB,
+) ([]proxy.Route, error) {
+	// nil pointer must not become a non-nil interface
+	var locator access.Locator
+	if geo != nil {
+		locator = geo
+	}
+
+	poolsByName := make(map[string]*pool.Pool, len(pools))
+	for _, p := range pools {
+		poolsByName[p.Name] = p
+	}
+
+	routes := make([]proxy.Route, 0, len(cfg.YAML.Routes))
+
+	for i, routeCfg := range cfg.YAML.Routes {
+		rules, err := rewrite.New(routeCfg.Rewrite)
+		if err != nil {
+			return nil, fmt.Errorf("error creating rewrite rules of route #%d: %w", i+1, err)
+		}
+
+		accessList, err := access.New(access.Rules{
+			Allow:          routeCfg.Access.Allow,
+			Deny:           routeCfg.Access.Deny,
+			AllowCountries: routeCfg.Access.AllowCountries,
+			DenyCountries:  routeCfg.Access.DenyCountries,
+		}, locator)
+		if err != nil {
+			return nil, fmt.Errorf("error creating access rules of route #%d: %w", i+1, err)
+		}
+
+		var redirect *rewrite.Redirect
+
+		if routeCfg.Redirect != nil {
+			redirect, err = rewrite.NewRedirect(*routeCfg.Redirect)
+			if err != nil {
+				return nil, fmt.Errorf("error creating redirect of route #%d: %w", i+1, err)
+			}
+		}
+
+		var routeCache *cache.Cache
+		if routeCfg.Cache {
+			routeCache = responseCache
+		}
+
+		var group *coalesce.Group
+		if routeCfg.Coalesce.Enabled {
+			group = coalesce.New(coalesce.Options{
+				VaryHeaders:     routeCfg.Coalesce.VaryHeaders,
+				MaxBytes:        int64(routeCfg.Coalesce.MaxSizeKB) << 10,
+				IdentityHeaders: identityHeaders(cfg.YAML.TLS.ClientAuth),
+				PerClient:       rules.PerClient(),
+				Timeout:         routeCfg.Timeout,
+			})
+		}
+
+		var compressor *compress.Compressor
+
+		if !routeCfg.Compression.Disabled {
+			compressor, err = compress.New(compress.Options{
+				Level:                routeCfg.Compression.Level,
+				MinSize:              routeCfg.Compression.MinSize,
+				ContentTypes:         routeCfg.Compression.ContentTypes,
+				DecompressRequests:   routeCfg.Compression.Decompress(),
+				MaxDecompressedBytes: int64(*routeCfg.Compression.MaxDecompressedSizeMB) << 20,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error creating compression of route #%d: %w", i+1, err)
+			}
+		}
+
+		routes = append(routes, proxy.Route{
+			Host:       routeCfg.Host,
+			PathPrefix: routeCfg.PathPrefix,
+			Methods:    routeCfg.Methods,
+			Headers:    routeCfg.Headers,
+			Pool:       poolsByName[routeCfg.Pool],
+			Rewrite:    rules,
+			Access:     accessList,
+			Priority:   requestPriority(routeCfg.Priority),
+			Timeout:    routeCfg.Timeout,
+			Cache:      routeCache,
+			Coalesce:   group,
+			Compress:   compressor,
+			Redirect:   redirect,
+		})
+	}
+
+	return routes, nil
+}
+
+// newConcurrencyLimiter creates an adaptive concurrency limiter, name identifies it in logs.
+func newConcurrencyLimiter(cfg config.ConcurrencyLimit, name string) *concurrency.Limiter {
+	var alg concurrency.Algorithm
+
+	switch cfg.Type {
+	case config.AIMDConcurrencyLimit:
+		alg = &concurrency.AIMD{Timeout: cfg.Timeout}
+	case config.GradientConcurrencyLimit:
+		alg = &concurrency.Gradient{}
+	}
+
+	slog.Info("concurrency limit enabled",
+		slog.String("name", name),
+		slog.String("type", string(cfg.Type)),
+		slog.Int("initialLimit", cfg.InitialLimit),
+	)
+
+	return concurrency.New(alg, concurrency.Options{
+		Name:         name,
+		InitialLimit: cfg.InitialLimit,
+		MinLimit:     cfg.MinLimit,
+		MaxLimit:     cfg.MaxLimit,
+		RetryAfter:   cfg.RetryAfter,
+	})
+}
+
+func requestPriority(priority config.RequestPriority) concurrency.Priority {
+	switch priority {
+	case config.LowPriority:
+		return concurrency.LowPriority
+	case config.HighPriority:
+		return concurrency.HighPriority
+	case config.NormalPriority:
+	}
+
+	return concurrency.NormalPriority
+}
+
+//nolint:ireturn
+func newLoadBalancer(balancerType config.BalancerType, backends []*backend.Backend) balancer.Balancer {
+	balancerBackends := pool.BalancerBackends(backends)
+
+	var loadBalancer balancer.Balancer
+
+	switch balancerType {
+	case config.LeastConnectionsType:
+		loadBalancer = balancer.NewLeastConnections(balancerBackends)
+	case config.RandomType:
+		loadBalancer = balancer.NewRandom(balancerBackends)
+	case config.RoundRobinType:
+		loadBalancer = balancer.NewRoundRobin(balancerBackends)
+	}
+
+	return loadBalancer
+}
+
+//nolint:ireturn
+func newRateLimiter(cfg config.RateLimit, pgRepo *postgres.Repository, closer *Closer) ratelimit.Limiter {
+	var rateLimiter ratelimit.Limiter
+
+	switch cfg.Type {
+	case config.TokenBucketType:
+		tokenBucket := tokenbucket.NewUserBucket(pgRepo,
+			cfg.Capacity,
+			cfg.TokenRate,
+			cfg.TokenInterval,
+		)
+		closer.Add(tokenBucket.Stop)
+
+		rateLimiter = tokenBucket
+	case config.LeakyBucketType:
+		rateLimiter = leakybucket.NewUserBucket(pgRepo,
+			cfg.Capacity,
+			cfg.TokenRate,
+			cfg.TokenInterval,
+		)
+	}
+
+	return rateLimiter
+}
+
+// identityHeaders returns headers, that forward client identities to backends.
+func identityHeaders(cfg config.ClientAuth) []string {
+	if cfg.Header == "" {
+		return nil
+	}
+
+	return []string{cfg.Header}
+}
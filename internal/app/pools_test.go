@@ -0,0 +1,110 @@
+package app_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/app"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+)
+
+func TestUpstreamTransportTLS(t *testing.T) {
+	t.Parallel()
+
+	skip := true
+
+	transport, err := app.NewUpstreamTransport(config.Pool{
+		UpstreamTLS: &config.UpstreamTLS{ServerName: "backend.internal", InsecureSkipVerify: &skip},
+		Protocol:    config.AutoUpstreamProtocol,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "backend.internal", transport.TLSClientConfig.ServerName)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestUpstreamTransportTimeouts(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(upstream.Close)
+
+	limit := time.Millisecond * 50
+	unlimited := time.Duration(0)
+
+	tests := []struct {
+		name    string
+		timeout *time.Duration
+		wantErr bool
+	}{
+		{name: "limited", timeout: &limit, wantErr: true},
+		{name: "unlimited", timeout: &unlimited},
+		{name: "unset", timeout: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := app.NewUpstreamTransport(config.Pool{
+				UpstreamTLS: &config.UpstreamTLS{},
+				Protocol:    config.AutoUpstreamProtocol,
+				Transport: config.Transport{
+					DialTimeout:           time.Second,
+					ResponseHeaderTimeout: tt.timeout,
+				},
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, upstream.URL, nil)
+			require.NoError(t, err)
+
+			resp, err := transport.RoundTrip(req)
+			if tt.wantErr {
+				require.ErrorContains(t, err, "timeout awaiting response headers")
+				return
+			}
+
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		})
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Parallel()
+
+	srv := app.NewServer(config.Server{ReadHeaderTimeout: time.Millisecond * 100})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = srv.Serve(ln) }()
+
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	// headers are never finished, so the server closes the connection
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second*5)))
+
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/tlsconfig"
+)
+
+// serverConfig contains optional settings of a listener.
+type serverConfig struct {
+	settings config.Server
+	// host is the listen address, all interfaces are used if it's empty.
+	host string
+	// protocols are HTTP/1 and HTTP/2 over TLS if it's nil.
+	protocols *http.Protocols
+}
+
+func newServer(r http.Handler, port string, sc serverConfig) *http.Server {
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(sc.host, port),
+		Handler:           r,
+		ReadTimeout:       sc.settings.ReadTimeout,
+		ReadHeaderTimeout: sc.settings.ReadHeaderTimeout,
+		WriteTimeout:      sc.settings.WriteTimeout,
+		IdleTimeout:       sc.settings.IdleTimeout,
+		MaxHeaderBytes:    sc.settings.MaxHeaderBytes,
+		Protocols:         sc.protocols,
+	}
+
+	return srv
+}
+
+// newProtocols returns protocols of the proxy listeners.
+// HTTP/2 is negotiated over TLS when enabled, cleartext HTTP/2 is served only with h2c.
+func newProtocols(cfg config.HTTP2) *http.Protocols {
+	var protocols http.Protocols
+
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(*cfg.Enabled)
+	protocols.SetUnencryptedHTTP2(cfg.H2C)
+
+	return &protocols
+}
+
+func startHTTP(closer *Closer, r http.Handler, port string, sc serverConfig) {
+	srv := newServer(r, port, sc)
+
+	slog.Info("starting http server", slog.String("addr", srv.Addr))
+	closer.AddWithCtx(srv.Shutdown)
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("failed to start http server", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func startHTTPS(closer *Closer, r http.Handler, port string, tlsConfig *tls.Config, sc serverConfig) {
+	srv := newServer(r, port, sc)
+	srv.TLSConfig = tlsConfig
+
+	slog.Info("starting https server", slog.String("addr", srv.Addr))
+	closer.AddWithCtx(srv.Shutdown)
+
+	// certificates are provided by tlsConfig.GetCertificate
+	if err := srv.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("failed to start https server", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// newTLSConfig loads certificates and starts watching them for changes.
+func newTLSConfig(ctx context.Context, cfg config.TLS) (*tls.Config, error) {
+	pairs := make([]tlsconfig.KeyPair, 0, len(cfg.Certificates))
+	for _, c := range cfg.Certificates {
+		pairs = append(pairs, tlsconfig.KeyPair{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+
+	store, err := tlsconfig.NewCertStore(pairs)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS certificates: %w", err)
+	}
+
+	tlsConfig, err := tlsconfig.NewServerConfig(store, cfg.MinVersion, cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("error creating TLS config: %w", err)
+	}
+
+	if cfg.ClientAuth.Enabled {
+		if err := tlsconfig.RequireClientCerts(tlsConfig, cfg.ClientAuth.CAFile); err != nil {
+			return nil, fmt.Errorf("error loading client CA bundle: %w", err)
+		}
+	}
+
+	if *cfg.ReloadInterval > 0 {
+		go store.WatchReload(ctx, *cfg.ReloadInterval)
+	}
+
+	return tlsConfig, nil
+}
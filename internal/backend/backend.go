@@ -3,21 +3,103 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync/atomic"
 	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.BackendComponent)
+
+// ErrUnhealthyStatus is returned when health check responds with a non-200 status.
+var ErrUnhealthyStatus = errors.New("unhealthy status code")
+
+// minSlowStartWeight is a weight of a backend at the beginning of slow start, so it gets a few requests.
+const minSlowStartWeight = 0.01
+
+// A list of cluster-wide health decisions.
+const (
+	// clusterHealthUnknown means there is no cluster decision, the local health is used.
+	clusterHealthUnknown int32 = iota
+	clusterHealthUp
+	clusterHealthDown
 )
 
+// HealthCheckType is a kind of active health checks.
+type HealthCheckType int
+
+// A list of available health check types.
+const (
+	// HTTPHealthCheck sends GET requests to the health check path.
+	HTTPHealthCheck HealthCheckType = iota
+	// GRPCHealthCheck calls grpc.health.v1.Health/Check.
+	GRPCHealthCheck
+	// TCPHealthCheck opens a TCP connection to the backend address.
+	TCPHealthCheck
+	// NoHealthCheck disables active health checks, backend is considered healthy.
+	NoHealthCheck
+)
+
+// HealthCheck contains the result of the last health check.
+type HealthCheck struct {
+	Time    time.Time     `json:"time"`
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"` // nanoseconds
+}
+
+// Status is a snapshot of backend state.
+type Status struct {
+	URL string `json:"url"`
+	// Healthy tells, whether the backend receives requests: it passes health checks, isn't ejected, draining
+	// or marked down by the cluster.
+	Healthy bool `json:"healthy"`
+	// HealthCheckPassed is the result of active health checks of this replica.
+	HealthCheckPassed bool  `json:"healthCheckPassed"`
+	Connections       int64 `json:"connections"`
+	// MaxConnections is a limit of concurrent requests, 0 means no limit.
+	MaxConnections int64 `json:"maxConnections"`
+	// Weight is a part of the full load, that the backend gets, it's below 1 during slow start.
+	Weight   float64 `json:"weight"`
+	Draining bool    `json:"draining"`
+	Ejected  bool    `json:"ejected"`
+	// ClusterHealthy is a decision of the cluster quorum, it's nil without cluster mode or quorum.
+	ClusterHealthy *bool        `json:"clusterHealthy,omitempty"`
+	LastCheck      *HealthCheck `json:"lastCheck"`
+	ProxyErrors    ProxyErrors  `json:"proxyErrors"`
+}
+
 // Backend represents a server, which accepts requests from load balancer.
 type Backend struct {
-	url          *url.URL
-	healthy      atomic.Bool
-	healthTicker *time.Ticker
-	connections  atomic.Int64
-	proxy        *httputil.ReverseProxy
+	url           *url.URL
+	healthy       atomic.Bool
+	draining      atomic.Bool
+	ejectedUntil  atomic.Int64 // unix nano
+	lastCheck     atomic.Pointer[HealthCheck]
+	healthTicker  *time.Ticker
+	healthClient  *http.Client
+	healthPath    string
+	healthTimeout time.Duration
+	healthType    HealthCheckType
+	// grpcHealthService is checked by gRPC health checks, empty means the whole server.
+	grpcHealthService string
+	passive           passiveHealth
+	connections       atomic.Int64
+	maxConnections    int64
+	// healthySince is the time, when the backend was added to a pool with other backends or became healthy
+	// (unix nano), it's 0 for backends, that are healthy since the start.
+	healthySince atomic.Int64
+	slowStart    time.Duration
+	// clusterHealth is a decision of the cluster quorum, the backend is unhealthy, when it's down.
+	clusterHealth atomic.Int32
+	proxy         *httputil.ReverseProxy
 }
 
 // Address returns the url of a backend.
@@ -25,37 +107,200 @@ func (b *Backend) Address() *url.URL {
 	return b.url
 }
 
-// Healthy returns current health status (atomic).
+// Healthy returns true if the backend passes health checks and is neither draining nor ejected (atomic).
+// In cluster mode the backend is also unhealthy, when the cluster quorum sees it down.
 func (b *Backend) Healthy() bool {
-	return b.healthy.Load()
+	if b.draining.Load() || b.clusterHealth.Load() == clusterHealthDown {
+		return false
+	}
+
+	return b.LocallyHealthy()
+}
+
+// LocallyHealthy returns true if the backend passes health checks of this replica and isn't ejected by it.
+func (b *Backend) LocallyHealthy() bool {
+	return b.healthy.Load() && !b.Ejected()
+}
+
+// SetClusterHealth stores the decision of the cluster quorum about the backend.
+func (b *Backend) SetClusterHealth(healthy bool) {
+	state := clusterHealthDown
+	if healthy {
+		state = clusterHealthUp
+	}
+
+	prev := b.clusterHealth.Swap(state)
+	if prev == state {
+		return
+	}
+
+	if healthy && prev == clusterHealthDown {
+		b.healthySince.Store(time.Now().UnixNano())
+	}
+
+	logger.Info("backend cluster health changed",
+		slog.String("addr", b.url.Host),
+		slog.Bool("healthy", healthy),
+	)
+}
+
+// ResetClusterHealth removes the cluster decision, e.g. when there is no quorum, so the local health is used.
+func (b *Backend) ResetClusterHealth() {
+	if b.clusterHealth.Swap(clusterHealthUnknown) != clusterHealthUnknown {
+		logger.Info("backend cluster health reset", slog.String("addr", b.url.Host))
+	}
 }
 
-// StartHealthChecks starts the periodic health checks for the backend on "/health" path.
+// Ejected returns true if the backend is temporarily excluded from balancing.
+func (b *Backend) Ejected() bool {
+	return time.Now().UnixNano() < b.ejectedUntil.Load()
+}
+
+// Eject excludes the backend from balancing for the given duration.
+func (b *Backend) Eject(d time.Duration) {
+	b.ejectedUntil.Store(time.Now().Add(d).UnixNano())
+
+	logger.Warn("backend ejected",
+		slog.String("addr", b.url.Host),
+		slog.Duration("duration", d),
+	)
+}
+
+// SetDraining marks the backend as draining, so it doesn't receive new requests.
+func (b *Backend) SetDraining(draining bool) {
+	b.draining.Store(draining)
+}
+
+// Status returns a snapshot of the backend state.
+func (b *Backend) Status() Status {
+	return Status{
+		URL:               b.url.String(),
+		Healthy:           b.Healthy(),
+		HealthCheckPassed: b.healthy.Load(),
+		Connections:       b.connections.Load(),
+		MaxConnections:    b.maxConnections,
+		Weight:            b.Weight(),
+		Draining:          b.draining.Load(),
+		Ejected:           b.Ejected(),
+		ClusterHealthy:    b.clusterHealthy(),
+		LastCheck:         b.lastCheck.Load(),
+		ProxyErrors:       b.passive.snapshot(),
+	}
+}
+
+// clusterHealthy returns the cluster decision or nil, if there is none.
+func (b *Backend) clusterHealthy() *bool {
+	state := b.clusterHealth.Load()
+	if state == clusterHealthUnknown {
+		return nil
+	}
+
+	healthy := state == clusterHealthUp
+
+	return &healthy
+}
+
+// StartHealthChecks starts the periodic health checks for the backend.
 func (b *Backend) StartHealthChecks(ctx context.Context) {
-	select {
-	case <-ctx.Done():
-		b.healthTicker.Stop()
+	defer b.healthTicker.Stop()
 
+	if b.healthType == NoHealthCheck {
 		return
-	case <-b.healthTicker.C:
-		// not going to make a custom http client for this
-		//nolint:noctx
-		resp, err := http.Get(b.url.String() + "/health")
-		if err != nil {
-			b.healthy.Store(false)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-b.healthTicker.C:
+			b.checkHealth(ctx)
 		}
+	}
+}
 
-		//nolint:errcheck
-		defer resp.Body.Close()
+func (b *Backend) checkHealth(ctx context.Context) {
+	start := time.Now()
+	err := b.probe(ctx)
 
-		if resp.StatusCode != http.StatusOK {
-			b.healthy.Store(false)
-			return
-		}
+	check := &HealthCheck{
+		Time:    start,
+		OK:      err == nil,
+		Latency: time.Since(start),
+	}
 
-		b.healthy.Store(true)
+	if err != nil {
+		check.Error = err.Error()
+
+		logger.Debug("backend health check failed",
+			slog.String("addr", b.url.Host),
+			slog.Any("error", err),
+		)
 	}
+
+	b.lastCheck.Store(check)
+	b.setHealthy(check.OK)
+}
+
+func (b *Backend) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, b.healthTimeout)
+	defer cancel()
+
+	switch b.healthType {
+	case GRPCHealthCheck:
+		return b.probeGRPC(ctx)
+	case TCPHealthCheck:
+		return b.probeTCP(ctx)
+	case HTTPHealthCheck, NoHealthCheck:
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url.JoinPath(b.healthPath).String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating health check request: %w", err)
+	}
+
+	resp, err := b.healthClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending health check request: %w", err)
+	}
+
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d", ErrUnhealthyStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (b *Backend) probeTCP(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", b.url.Host)
+	if err != nil {
+		return fmt.Errorf("error connecting to backend: %w", err)
+	}
+
+	//nolint:errcheck
+	conn.Close()
+
+	return nil
+}
+
+// setHealthy stores health status and logs it if the status has changed.
+func (b *Backend) setHealthy(healthy bool) {
+	if b.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		b.healthySince.Store(time.Now().UnixNano())
+	}
+
+	logger.Info("backend health changed",
+		slog.String("addr", b.url.Host),
+		slog.Bool("healthy", healthy),
+	)
 }
 
 // GetConnections returns current connections count (atomic).
@@ -63,11 +308,59 @@ func (b *Backend) GetConnections() int64 {
 	return b.connections.Load()
 }
 
-// ServeHTTP passes the request to the backend server using reverse proxy.
-func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// Saturated returns true if the backend has reached its connections limit (atomic).
+func (b *Backend) Saturated() bool {
+	return b.maxConnections > 0 && b.connections.Load() >= b.maxConnections
+}
+
+// Weight returns a part of the full load, that the backend should get. During slow start after the backend
+// was added, became healthy or returned from ejection, it grows linearly from minSlowStartWeight to 1.
+func (b *Backend) Weight() float64 {
+	if b.slowStart <= 0 {
+		return 1
+	}
+
+	since := max(b.healthySince.Load(), b.ejectedUntil.Load())
+
+	elapsed := time.Since(time.Unix(0, since))
+	if elapsed >= b.slowStart {
+		return 1
+	}
+
+	return max(float64(elapsed)/float64(b.slowStart), minSlowStartWeight)
+}
+
+// TryAcquire reserves a connection slot for a proxied request, it fails when the backend is saturated.
+// The check and the reservation are atomic, so concurrent requests don't exceed the connections limit.
+func (b *Backend) TryAcquire() (release func(), ok bool) {
+	for {
+		connections := b.connections.Load()
+		if b.maxConnections > 0 && connections >= b.maxConnections {
+			return nil, false
+		}
+
+		if b.connections.CompareAndSwap(connections, connections+1) {
+			return func() {
+				b.connections.Add(-1)
+			}, true
+		}
+	}
+}
+
+// TrackConnection counts a connection, proxied outside of ServeHTTP (e.g. by layer-4 proxy),
+// release must be called when it's closed.
+func (b *Backend) TrackConnection() (release func()) {
 	b.connections.Add(1)
-	defer b.connections.Add(-1)
 
+	return func() {
+		b.connections.Add(-1)
+	}
+}
+
+// ServeHTTP passes the request to the backend server using reverse proxy. The connection slot is reserved
+// by TryAcquire before, upgraded connections keep it until they are closed, as reverse proxy copies them
+// before returning.
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	b.proxy.ServeHTTP(w, r)
 }
 
@@ -77,24 +370,33 @@ type Balancer interface {
 	UpdateBackends(backends []*Backend)
 }
 
+// Options contains settings shared by backends of a pool.
+type Options struct {
+	// Transport is used for proxied requests and health checks, http.DefaultTransport if it's nil.
+	Transport           http.RoundTripper
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	HealthCheckType     HealthCheckType
+	// GRPCHealthService is a service name for gRPC health checks, empty means the whole server.
+	GRPCHealthService string
+	PassiveHealth     PassiveHealth
+	// MaxConnections limits concurrent requests of every backend, 0 means no limit.
+	MaxConnections int64
+	// SlowStart is a time, during which weight of a new or recovered backend grows to full, 0 disables it.
+	SlowStart time.Duration
+}
+
 // NewBackendServers creates an array of backend servers from config URLs and starts health checks on them.
-func NewBackendServers(ctx context.Context, backends []string, healthCheckInterval time.Duration) ([]*Backend, error) {
+func NewBackendServers(ctx context.Context, backends []string, opts Options) ([]*Backend, error) {
 	res := make([]*Backend, 0, len(backends))
 
 	for _, b := range backends {
-		parsedURL, err := url.Parse(b)
+		srv, err := newBackend(b, opts)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing backend url: %w", err)
-		}
-
-		srv := &Backend{
-			url:          parsedURL,
-			proxy:        httputil.NewSingleHostReverseProxy(parsedURL),
-			healthTicker: time.NewTicker(healthCheckInterval),
+			return nil, err
 		}
 
-		srv.healthy.Store(true)
-
 		go srv.StartHealthChecks(ctx)
 
 		res = append(res, srv)
@@ -102,3 +404,36 @@ func NewBackendServers(ctx context.Context, backends []string, healthCheckInterv
 
 	return res, nil
 }
+
+// newBackend creates a healthy backend without starting health checks.
+func newBackend(rawURL string, opts Options) (*Backend, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing backend url: %w", err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(parsedURL)
+	proxy.Transport = opts.Transport
+	proxy.ErrorLog = slog.NewLogLogger(logger.Handler(), slog.LevelWarn)
+
+	srv := &Backend{
+		url:               parsedURL,
+		proxy:             proxy,
+		healthTicker:      time.NewTicker(opts.HealthCheckInterval),
+		healthClient:      &http.Client{Transport: opts.Transport},
+		healthPath:        opts.HealthCheckPath,
+		healthTimeout:     opts.HealthCheckTimeout,
+		healthType:        opts.HealthCheckType,
+		grpcHealthService: opts.GRPCHealthService,
+		passive:           passiveHealth{settings: opts.PassiveHealth},
+		maxConnections:    opts.MaxConnections,
+		slowStart:         opts.SlowStart,
+	}
+
+	proxy.ErrorHandler = srv.proxyError
+	proxy.ModifyResponse = srv.recordSuccess
+
+	srv.healthy.Store(true)
+
+	return srv, nil
+}
@@ -0,0 +1,160 @@
+package backend_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+)
+
+func TestSlowStart(t *testing.T) {
+	t.Parallel()
+
+	slowStart := time.Millisecond * 200
+
+	registry := backend.NewRegistry(t.Context(), backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.NoHealthCheck,
+		SlowStart:           slowStart,
+	})
+	t.Cleanup(registry.Close)
+
+	initial, err := registry.Reconcile([]string{"http://localhost:1"})
+	require.NoError(t, err)
+
+	// backends of a new pool get the full load
+	assert.Equal(t, 1.0, initial[0].Weight())
+
+	backends, err := registry.Reconcile([]string{"http://localhost:1", "http://localhost:2"})
+	require.NoError(t, err)
+
+	b := backends[1]
+
+	// a backend, added to the pool, warms up
+	assert.Less(t, b.Weight(), 0.5)
+	assert.Greater(t, b.Weight(), 0.0)
+	require.Eventually(t, func() bool { return b.Weight() == 1 }, time.Second, time.Millisecond*10)
+
+	// a backend returning from ejection warms up again
+	b.Eject(time.Millisecond * 10)
+	require.Eventually(t, func() bool { return !b.Ejected() }, time.Second, time.Millisecond)
+	assert.Less(t, b.Status().Weight, 0.5)
+	require.Eventually(t, func() bool { return b.Weight() == 1 }, time.Second, time.Millisecond*10)
+}
+
+func TestSaturated(t *testing.T) {
+	t.Parallel()
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{"http://localhost:1"}, backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.NoHealthCheck,
+		MaxConnections:      1,
+	})
+	require.NoError(t, err)
+
+	b := backends[0]
+	assert.False(t, b.Saturated())
+
+	release := b.TrackConnection()
+	assert.True(t, b.Saturated())
+
+	release()
+	assert.False(t, b.Saturated())
+	assert.Equal(t, 1.0, b.Weight(), "slow start is disabled")
+}
+
+func TestClusterHealth(t *testing.T) {
+	t.Parallel()
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{"http://localhost:1"}, backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.NoHealthCheck,
+	})
+	require.NoError(t, err)
+
+	b := backends[0]
+	assert.Nil(t, b.Status().ClusterHealthy)
+
+	// the cluster quorum makes the backend down
+	b.SetClusterHealth(false)
+	assert.False(t, b.Healthy())
+	assert.True(t, b.LocallyHealthy())
+	assert.False(t, b.Status().Healthy)
+	assert.True(t, b.Status().HealthCheckPassed)
+	require.NotNil(t, b.Status().ClusterHealthy)
+	assert.False(t, *b.Status().ClusterHealthy)
+
+	// but doesn't override local ejection
+	b.Eject(time.Hour)
+	b.SetClusterHealth(true)
+	assert.False(t, b.Healthy())
+	assert.False(t, b.LocallyHealthy())
+	require.NotNil(t, b.Status().ClusterHealthy)
+	assert.True(t, *b.Status().ClusterHealthy)
+
+	// local health is used without the quorum
+	b.ResetClusterHealth()
+	assert.False(t, b.Healthy())
+	assert.Nil(t, b.Status().ClusterHealthy)
+}
+
+func TestTryAcquire(t *testing.T) {
+	t.Parallel()
+
+	const maxConnections = 3
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{"http://localhost:1"}, backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.NoHealthCheck,
+		MaxConnections:      maxConnections,
+	})
+	require.NoError(t, err)
+
+	b := backends[0]
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		releases []func()
+	)
+
+	start := make(chan struct{})
+
+	// slots are held until all attempts are done, so only the limit of them succeeds
+	for range 100 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			if release, ok := b.TryAcquire(); ok {
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	assert.Len(t, releases, maxConnections)
+	assert.Equal(t, int64(maxConnections), b.GetConnections())
+	assert.True(t, b.Saturated())
+
+	for _, release := range releases {
+		release()
+	}
+
+	assert.Zero(t, b.GetConnections())
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+	// grpcServing is SERVING value of grpc.health.v1.HealthCheckResponse.ServingStatus.
+	grpcServing = 1
+	// grpcFrameHeaderSize is the size of compressed flag and message length prefix.
+	grpcFrameHeaderSize = 5
+	// maxGRPCHealthResponse limits the size of the read health check response.
+	maxGRPCHealthResponse = 1024
+)
+
+var (
+	// ErrGRPCStatus is returned when gRPC health check call finishes with a non-OK status.
+	ErrGRPCStatus = errors.New("unhealthy gRPC status")
+	// ErrNotServing is returned when gRPC health check reports a status other than SERVING.
+	ErrNotServing = errors.New("gRPC service is not serving")
+	// ErrInvalidGRPCResponse is returned when gRPC health check response can't be decoded.
+	ErrInvalidGRPCResponse = errors.New("invalid gRPC health check response")
+)
+
+// probeGRPC calls grpc.health.v1.Health/Check. Messages are encoded by hand,
+// as the protocol has only one field in request and response.
+func (b *Backend) probeGRPC(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		b.url.JoinPath(grpcHealthCheckPath).String(),
+		bytes.NewReader(encodeHealthCheckRequest(b.grpcHealthService)),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating health check request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := b.healthClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending health check request: %w", err)
+	}
+
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d", ErrUnhealthyStatus, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCHealthResponse))
+	if err != nil {
+		return fmt.Errorf("error reading health check response: %w", err)
+	}
+
+	// errors without a message are sent in headers (trailers-only response)
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+
+	if status != "0" {
+		return fmt.Errorf("%w: %s %s", ErrGRPCStatus, status, message)
+	}
+
+	serving, err := decodeHealthCheckResponse(body)
+	if err != nil {
+		return err
+	}
+
+	if serving != grpcServing {
+		return fmt.Errorf("%w: status %d", ErrNotServing, serving)
+	}
+
+	return nil
+}
+
+// encodeHealthCheckRequest creates a framed HealthCheckRequest{service = 1}.
+func encodeHealthCheckRequest(service string) []byte {
+	var msg []byte
+
+	if service != "" {
+		msg = append(msg, 1<<3|2) // field 1, length-delimited
+		msg = binary.AppendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+
+	frame := make([]byte, 0, grpcFrameHeaderSize+len(msg))
+	frame = append(frame, 0) // not compressed
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(msg)))
+
+	return append(frame, msg...)
+}
+
+// decodeHealthCheckResponse reads ServingStatus (field 1) from a framed HealthCheckResponse.
+// Missing field means the default UNKNOWN (0) status.
+func decodeHealthCheckResponse(frame []byte) (uint64, error) {
+	if len(frame) < grpcFrameHeaderSize || frame[0] != 0 {
+		return 0, fmt.Errorf("%w: bad frame header", ErrInvalidGRPCResponse)
+	}
+
+	size := binary.BigEndian.Uint32(frame[1:grpcFrameHeaderSize])
+
+	msg := frame[grpcFrameHeaderSize:]
+	if uint64(len(msg)) != uint64(size) {
+		return 0, fmt.Errorf("%w: bad message length", ErrInvalidGRPCResponse)
+	}
+
+	var status uint64
+
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, fmt.Errorf("%w: bad field key", ErrInvalidGRPCResponse)
+		}
+
+		msg = msg[n:]
+
+		var value uint64
+
+		switch key & 7 {
+		case 0: // varint
+			value, n = binary.Uvarint(msg)
+		case 1: // fixed64
+			n = 8
+		case 2: // length-delimited
+			var l uint64
+
+			l, n = binary.Uvarint(msg)
+			if n > 0 && l <= uint64(len(msg)-n) {
+				n += int(l)
+			} else {
+				n = 0
+			}
+		case 5: // fixed32
+			n = 4
+		default:
+			n = 0
+		}
+
+		if n <= 0 || n > len(msg) {
+			return 0, fmt.Errorf("%w: bad field value", ErrInvalidGRPCResponse)
+		}
+
+		msg = msg[n:]
+
+		if key == 1<<3 {
+			status = value
+		}
+	}
+
+	return status, nil
+}
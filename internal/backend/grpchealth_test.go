@@ -0,0 +1,85 @@
+package backend_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+)
+
+// healthServer implements grpc.health.v1.Health/Check, only "ok" service is serving.
+func healthServer(w http.ResponseWriter, r *http.Request) {
+	req, _ := io.ReadAll(r.Body)
+
+	// request frame: 5 bytes header, field key, service length, service
+	var service string
+	if len(req) > 7 {
+		service = string(req[7:])
+	}
+
+	status := byte(2) // NOT_SERVING
+	if service == "ok" {
+		status = 1 // SERVING
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+
+	frame := binary.BigEndian.AppendUint32([]byte{0}, 2)
+	_, _ = w.Write(append(frame, 1<<3, status))
+
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func newGRPCBackend(t *testing.T, service string) *backend.Backend {
+	t.Helper()
+
+	var protocols http.Protocols
+
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(healthServer))
+	srv.Config.Protocols = &protocols
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{srv.URL}, backend.Options{
+		Transport:           &http.Transport{Protocols: &protocols},
+		HealthCheckInterval: time.Millisecond * 10,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.GRPCHealthCheck,
+		GRPCHealthService:   service,
+	})
+	require.NoError(t, err)
+
+	return backends[0]
+}
+
+func lastCheck(b *backend.Backend) *backend.HealthCheck {
+	return b.Status().LastCheck
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	serving := newGRPCBackend(t, "ok")
+	notServing := newGRPCBackend(t, "other")
+
+	assert.Eventually(t, func() bool {
+		return lastCheck(serving) != nil && lastCheck(notServing) != nil
+	}, time.Second, time.Millisecond*10)
+
+	assert.True(t, lastCheck(serving).OK, lastCheck(serving).Error)
+	assert.True(t, serving.Healthy())
+
+	assert.False(t, lastCheck(notServing).OK)
+	assert.Contains(t, lastCheck(notServing).Error, backend.ErrNotServing.Error())
+	assert.False(t, notServing.Healthy())
+}
@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+// ProxyErrorKind is a class of errors of proxied requests.
+type ProxyErrorKind string
+
+// A list of proxy error kinds.
+const (
+	DialError       ProxyErrorKind = "dial"
+	TimeoutError    ProxyErrorKind = "timeout"
+	TLSError        ProxyErrorKind = "tls"
+	ClientCanceled  ProxyErrorKind = "clientCanceled"
+	UpstreamFailure ProxyErrorKind = "upstream"
+	// RequestTooLarge is returned when the request body exceeds its limit, e.g. after decompression.
+	RequestTooLarge ProxyErrorKind = "requestTooLarge"
+)
+
+// PassiveHealth contains settings of passive health tracking, based on errors of proxied requests.
+type PassiveHealth struct {
+	// MaxFailures is the amount of consecutive failures, after which the backend is ejected, 0 disables ejection.
+	MaxFailures int
+	// EjectDuration is the time the ejected backend doesn't receive requests.
+	EjectDuration time.Duration
+}
+
+// ProxyErrors contains counters of proxy errors by kind.
+type ProxyErrors struct {
+	Dial            int64 `json:"dial"`
+	Timeout         int64 `json:"timeout"`
+	TLS             int64 `json:"tls"`
+	ClientCanceled  int64 `json:"clientCanceled"`
+	Upstream        int64 `json:"upstream"`
+	RequestTooLarge int64 `json:"requestTooLarge"`
+	// ConsecutiveFailures are failures since the last successful response, client errors are not counted.
+	ConsecutiveFailures int64 `json:"consecutiveFailures"`
+}
+
+// passiveHealth counts proxy errors and ejects the backend after too many consecutive failures.
+type passiveHealth struct {
+	settings PassiveHealth
+
+	dial, timeout, tls, clientCanceled, upstream, requestTooLarge atomic.Int64
+	consecutive                                                   atomic.Int64
+}
+
+func (ph *passiveHealth) snapshot() ProxyErrors {
+	return ProxyErrors{
+		Dial:                ph.dial.Load(),
+		Timeout:             ph.timeout.Load(),
+		TLS:                 ph.tls.Load(),
+		ClientCanceled:      ph.clientCanceled.Load(),
+		Upstream:            ph.upstream.Load(),
+		RequestTooLarge:     ph.requestTooLarge.Load(),
+		ConsecutiveFailures: ph.consecutive.Load(),
+	}
+}
+
+// classifyProxyError returns the kind of the error and the response status.
+func classifyProxyError(r *http.Request, err error) (ProxyErrorKind, int) {
+	var (
+		netErr       net.Error
+		opErr        *net.OpError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		maxBytesErr  *http.MaxBytesError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		return ClientCanceled, problem.StatusClientClosedRequest
+	case errors.As(err, &maxBytesErr):
+		return RequestTooLarge, http.StatusRequestEntityTooLarge
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr):
+		return TLSError, http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return TimeoutError, http.StatusGatewayTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return DialError, http.StatusServiceUnavailable
+	}
+
+	return UpstreamFailure, http.StatusBadGateway
+}
+
+var errorTitles = map[ProxyErrorKind]struct{ title, detail string }{
+	DialError:       {"Backend unavailable", "Unable to connect to the backend"},
+	TimeoutError:    {"Gateway timeout", "Backend didn't respond in time"},
+	TLSError:        {"Bad gateway", "TLS handshake with the backend failed"},
+	ClientCanceled:  {"Client closed request", "Request was canceled by the client"},
+	UpstreamFailure: {"Bad gateway", "Backend connection failed"},
+	RequestTooLarge: {"Request too large", "Request body is larger than allowed"},
+}
+
+// proxyError responds to failed proxied requests with problem details and records the failure.
+func (b *Backend) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	kind, status := classifyProxyError(r, err)
+	b.recordFailure(kind)
+
+	level := slog.LevelWarn
+	if kind == ClientCanceled || kind == RequestTooLarge {
+		level = slog.LevelDebug
+	}
+
+	logger.Log(r.Context(), level, "failed to proxy request",
+		slog.String("addr", b.url.Host),
+		slog.String("kind", string(kind)),
+		slog.Int("status", status),
+		slog.Any("error", err),
+	)
+
+	text := errorTitles[kind]
+	problem.WriteRequest(w, r, text.title, text.detail, status)
+}
+
+func (b *Backend) recordFailure(kind ProxyErrorKind) {
+	ph := &b.passive
+
+	switch kind {
+	case DialError:
+		ph.dial.Add(1)
+	case TimeoutError:
+		ph.timeout.Add(1)
+	case TLSError:
+		ph.tls.Add(1)
+	case ClientCanceled:
+		// not a fault of the backend
+		ph.clientCanceled.Add(1)
+		return
+	case RequestTooLarge:
+		ph.requestTooLarge.Add(1)
+		return
+	case UpstreamFailure:
+		ph.upstream.Add(1)
+	}
+
+	failures := ph.consecutive.Add(1)
+
+	if ph.settings.MaxFailures > 0 && failures >= int64(ph.settings.MaxFailures) {
+		ph.consecutive.Store(0)
+		b.Eject(ph.settings.EjectDuration)
+	}
+}
+
+// recordSuccess resets consecutive failures, when the backend responds.
+func (b *Backend) recordSuccess(*http.Response) error {
+	b.passive.consecutive.Store(0)
+	return nil
+}
@@ -0,0 +1,160 @@
+package backend_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+func newBackend(t *testing.T, rawURL string, passive backend.PassiveHealth) *backend.Backend {
+	t.Helper()
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{rawURL}, backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		PassiveHealth:       passive,
+	})
+	require.NoError(t, err)
+
+	return backends[0]
+}
+
+// closedAddr returns an address, where nothing is listening.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	return addr
+}
+
+func proxyRequest(b *backend.Backend, r *http.Request) (int, problem.ResponseError) {
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, r)
+
+	var resp problem.ResponseError
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+
+	return w.Code, resp
+}
+
+func TestProxyErrors(t *testing.T) {
+	t.Parallel()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(slow.Close)
+
+	reading := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	t.Cleanup(reading.Close)
+
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(untrusted.Close)
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(t.Context(), time.Millisecond*50)
+	t.Cleanup(cancelTimeout)
+
+	canceledCtx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	tests := []struct {
+		name       string
+		url        string
+		ctx        context.Context
+		body       io.ReadCloser
+		wantStatus int
+		wantErrors backend.ProxyErrors
+	}{
+		{
+			name:       "dial",
+			url:        "http://" + closedAddr(t),
+			ctx:        t.Context(),
+			wantStatus: http.StatusServiceUnavailable,
+			wantErrors: backend.ProxyErrors{Dial: 1, ConsecutiveFailures: 1},
+		},
+		{
+			name:       "timeout",
+			url:        slow.URL,
+			ctx:        timeoutCtx,
+			wantStatus: http.StatusGatewayTimeout,
+			wantErrors: backend.ProxyErrors{Timeout: 1, ConsecutiveFailures: 1},
+		},
+		{
+			name:       "tls",
+			url:        untrusted.URL,
+			ctx:        t.Context(),
+			wantStatus: http.StatusBadGateway,
+			wantErrors: backend.ProxyErrors{TLS: 1, ConsecutiveFailures: 1},
+		},
+		{
+			name:       "client canceled",
+			url:        slow.URL,
+			ctx:        canceledCtx,
+			wantStatus: problem.StatusClientClosedRequest,
+			wantErrors: backend.ProxyErrors{ClientCanceled: 1},
+		},
+		{
+			name:       "request too large",
+			url:        reading.URL,
+			ctx:        t.Context(),
+			body:       http.MaxBytesReader(nil, io.NopCloser(strings.NewReader("too large body")), 4),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantErrors: backend.ProxyErrors{RequestTooLarge: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := newBackend(t, tt.url, backend.PassiveHealth{})
+
+			r := httptest.NewRequestWithContext(tt.ctx, http.MethodGet, "/", nil)
+			if tt.body != nil {
+				r.Method = http.MethodPost
+				r.Body = tt.body
+				r.ContentLength = -1
+			}
+
+			status, resp := proxyRequest(b, r)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.Equal(t, tt.wantErrors, b.Status().ProxyErrors)
+		})
+	}
+}
+
+func TestPassiveEjection(t *testing.T) {
+	t.Parallel()
+
+	b := newBackend(t, "http://"+closedAddr(t), backend.PassiveHealth{
+		MaxFailures:   2,
+		EjectDuration: time.Minute,
+	})
+
+	proxyRequest(b, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, b.Healthy())
+
+	proxyRequest(b, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, b.Healthy())
+	assert.True(t, b.Status().Ejected)
+}
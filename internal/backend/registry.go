@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// registered is a backend with the function, that stops its health checks.
+type registered struct {
+	backend *Backend
+	stop    context.CancelFunc
+}
+
+// Registry keeps backends of a pool by URL, so changes of the backend list reuse existing backends
+// with their connections, health and ejection state.
+type Registry struct {
+	ctx  context.Context //nolint:containedctx
+	opts Options
+
+	mu       sync.Mutex
+	backends map[string]registered
+	list     []*Backend
+}
+
+// NewRegistry creates an empty registry, health checks of its backends run until ctx is done
+// or the backends are removed.
+func NewRegistry(ctx context.Context, opts Options) *Registry {
+	return &Registry{
+		ctx:      ctx,
+		opts:     opts,
+		backends: make(map[string]registered),
+	}
+}
+
+// Reconcile makes the registry contain backends with the URLs. Existing backends are reused, health checks
+// are started for new ones and stopped for removed ones. Invalid URLs are skipped and returned as an error.
+// Backends are returned in the order of the URLs.
+func (r *Registry) Reconcile(urls []string) ([]*Backend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+
+	desired := make(map[string]registered, len(urls))
+	list := make([]*Backend, 0, len(urls))
+	seen := make(map[*Backend]struct{}, len(urls))
+	// backends of a new pool get the full load at once, there are no other backends to take it
+	warmUp := len(r.backends) > 0
+
+	for _, rawURL := range urls {
+		b, err := r.get(rawURL, desired, warmUp)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, ok := seen[b]; ok {
+			continue
+		}
+
+		seen[b] = struct{}{}
+		list = append(list, b)
+	}
+
+	for key, reg := range r.backends {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+
+		reg.stop()
+
+		logger.Info("backend removed", slog.String("addr", reg.backend.url.Host))
+	}
+
+	r.backends = desired
+	r.list = list
+
+	return list, errors.Join(errs...)
+}
+
+// get returns the existing backend with the URL or creates it, the backend is added to desired.
+// New backends start with slow start, if warmUp is true.
+func (r *Registry) get(rawURL string, desired map[string]registered, warmUp bool) (*Backend, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing backend url: %w", err)
+	}
+
+	// URLs are compared after parsing, so equal URLs written differently aren't duplicated
+	key := parsedURL.String()
+
+	if reg, ok := desired[key]; ok {
+		return reg.backend, nil
+	}
+
+	if reg, ok := r.backends[key]; ok {
+		desired[key] = reg
+		return reg.backend, nil
+	}
+
+	b, err := newBackend(rawURL, r.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if warmUp {
+		b.healthySince.Store(time.Now().UnixNano())
+	}
+
+	ctx, stop := context.WithCancel(r.ctx)
+	desired[key] = registered{backend: b, stop: stop}
+
+	go b.StartHealthChecks(ctx)
+
+	logger.Info("backend added", slog.String("addr", b.url.Host))
+
+	return b, nil
+}
+
+// Backends returns the current backends.
+func (r *Registry) Backends() []*Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.list
+}
+
+// Close stops health checks of all backends.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reg := range r.backends {
+		reg.stop()
+	}
+
+	r.backends = make(map[string]registered)
+	r.list = nil
+}
@@ -0,0 +1,92 @@
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+)
+
+func TestRegistryReconcile(t *testing.T) {
+	t.Parallel()
+
+	registry := backend.NewRegistry(t.Context(), backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	t.Cleanup(registry.Close)
+
+	first, err := registry.Reconcile([]string{"http://10.0.0.1:80", "http://10.0.0.2:80", "http://10.0.0.1:80"})
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+
+	// state of kept backends is preserved
+	release := first[1].TrackConnection()
+	defer release()
+
+	first[1].Eject(time.Minute)
+
+	second, err := registry.Reconcile([]string{"http://10.0.0.3:80", "http://10.0.0.2:80", "://invalid"})
+	require.Error(t, err)
+	require.Len(t, second, 2)
+
+	assert.Equal(t, "10.0.0.3:80", second[0].Address().Host)
+	assert.Same(t, first[1], second[1])
+	assert.Equal(t, int64(1), second[1].GetConnections())
+	assert.True(t, second[1].Ejected())
+	assert.Equal(t, second, registry.Backends())
+}
+
+// roundTripFunc is an http.RoundTripper, that calls the function.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRegistryStopsHealthChecks(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan *http.Request, 1)
+
+	registry := backend.NewRegistry(t.Context(), backend.Options{
+		// health checks hang, until they are canceled
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Context().Err() == nil {
+				started <- r
+			}
+
+			<-r.Context().Done()
+
+			return nil, r.Context().Err()
+		}),
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Millisecond,
+		HealthCheckTimeout:  time.Hour,
+	})
+	t.Cleanup(registry.Close)
+
+	first, err := registry.Reconcile([]string{"http://10.0.0.1:80"})
+	require.NoError(t, err)
+
+	check := <-started
+
+	// reconciling the same URL keeps the backend with its health checks
+	second, err := registry.Reconcile([]string{"http://10.0.0.1:80"})
+	require.NoError(t, err)
+	assert.Same(t, first[0], second[0])
+	require.NoError(t, check.Context().Err())
+
+	_, err = registry.Reconcile(nil)
+	require.NoError(t, err)
+
+	select {
+	case <-check.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("health checks of the removed backend weren't stopped")
+	}
+}
@@ -3,15 +3,22 @@ package balancer
 
 import (
 	"errors"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
 )
 
+var logger = logging.Component(logging.BalancerComponent)
+
 var (
 	// ErrNoBackends is returned when there are no backends available (none were set).
 	ErrNoBackends = errors.New("no backends available")
 	// ErrNoHealthyBackends is returned when there are no healthy backends available.
 	ErrNoHealthyBackends = errors.New("no healthy backends available")
+	// ErrAllSaturated is returned when all healthy backends have reached their connections limit.
+	ErrAllSaturated = errors.New("all backends are saturated")
 )
 
 // BackendServer defines the interface for backend servers.
@@ -21,6 +28,11 @@ type BackendServer interface {
 	Address() *url.URL
 	Healthy() bool
 	GetConnections() int64
+	Saturated() bool
+	// TryAcquire atomically reserves a connection slot, unless the backend is saturated.
+	TryAcquire() (release func(), ok bool)
+	// Weight is a part of the full load, that the backend should get, it's below 1 during slow start.
+	Weight() float64
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
@@ -29,3 +41,50 @@ type Balancer interface {
 	Next() (BackendServer, error)
 	UpdateBackends(backends []BackendServer)
 }
+
+// Acquire selects a backend and reserves its connection slot, release must be called when the request
+// is completed. The backend can be saturated by concurrent requests after it's selected, then another one
+// is selected.
+//
+//nolint:ireturn
+func Acquire(b Balancer) (BackendServer, func(), error) {
+	for {
+		backend, err := b.Next()
+		if err != nil {
+			return nil, nil, err //nolint:wrapcheck
+		}
+
+		if release, ok := backend.TryAcquire(); ok {
+			return backend, release, nil
+		}
+	}
+}
+
+// available returns true if the backend can get a new request. Saturated backends are noted,
+// so the balancer can tell them apart from unhealthy ones.
+func available(b BackendServer, saturated *bool) bool {
+	if !b.Healthy() {
+		return false
+	}
+
+	if b.Saturated() {
+		*saturated = true
+		return false
+	}
+
+	return true
+}
+
+// unavailableError returns the error of a balancer, that has backends, but can't select any of them.
+func unavailableError(saturated bool) error {
+	if saturated {
+		return ErrAllSaturated
+	}
+
+	return ErrNoHealthyBackends
+}
+
+// accept returns true with the probability equal to the weight, so backends in slow start get a part of requests.
+func accept(weight float64) bool {
+	return weight >= 1 || rand.Float64() < weight
+}
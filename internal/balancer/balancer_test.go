@@ -0,0 +1,46 @@
+package balancer_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer/mocks"
+)
+
+// mockBackend creates a mock backend with the host, that reports the saturation and the weight.
+// These calls are optional, because balancers skip them for unhealthy backends.
+func mockBackend(t *testing.T, host string, saturated bool, weight float64) *mocks.BackendServer {
+	t.Helper()
+
+	b := mocks.NewBackendServer(t)
+	b.On("Saturated").Return(saturated).Maybe()
+	b.On("Weight").Return(weight).Maybe()
+	b.On("Address").Return(&url.URL{Host: host}).Maybe()
+
+	return b
+}
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	// b1 isn't saturated when it's selected, but concurrent requests take its last slot before the reservation
+	b1 := mockBackend(t, "backend1", false, 1)
+	b1.On("Healthy").Return(true)
+	b1.On("TryAcquire").Return(nil, false).Once()
+
+	b2 := mockBackend(t, "backend2", false, 1)
+	b2.On("Healthy").Return(true)
+	b2.On("TryAcquire").Return(func() {}, true).Once()
+
+	selected, release, err := balancer.Acquire(balancer.NewRoundRobin([]balancer.BackendServer{b1, b2}))
+	require.NoError(t, err)
+	assert.Equal(t, b2, selected)
+	assert.NotNil(t, release)
+
+	_, _, err = balancer.Acquire(balancer.NewRoundRobin(nil))
+	require.ErrorIs(t, err, balancer.ErrNoBackends)
+}
@@ -33,26 +33,34 @@ func (lc *LeastConnections) Next() (BackendServer, error) {
 
 	var selected BackendServer
 
-	var minConns int64 = math.MaxInt64
+	minLoad := math.Inf(1)
+	saturated := false
 
 	for _, backend := range backends {
+		if !available(backend, &saturated) {
+			continue
+		}
+
+		// connections are divided by the weight, so backends in slow start look busier than they are
 		backendConns := backend.GetConnections()
+		weight := backend.Weight()
+		load := float64(backendConns+1) / weight
 
-		if backend.Healthy() && backendConns < minConns {
+		if load < minLoad {
 			selected = backend
-			minConns = backendConns
+			minLoad = load
 
-			if minConns == 0 {
+			if backendConns == 0 && weight >= 1 {
 				break
 			}
 		}
 	}
 
 	if selected == nil {
-		return nil, ErrNoHealthyBackends
+		return nil, unavailableError(saturated)
 	}
 
-	slog.Debug("selected backend with least connections",
+	logger.Debug("selected backend with least connections",
 		slog.String("addr", selected.Address().Host),
 		slog.Int64("connections", selected.GetConnections()),
 	)
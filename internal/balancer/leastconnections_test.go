@@ -1,7 +1,6 @@
 package balancer_test
 
 import (
-	"net/url"
 	"sync"
 	"testing"
 
@@ -18,20 +17,16 @@ func TestLeastConnections(t *testing.T) {
 	t.Run("get a healthy backend with least connections", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("GetConnections").Return(int64(30))
 		b1.On("Healthy").Return(true)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
-		b2.On("GetConnections").Return(int64(10))
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(false)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
-		b3 := mocks.NewBackendServer(t)
+		b3 := mockBackend(t, "backend3", false, 1)
 		b3.On("GetConnections").Return(int64(20))
 		b3.On("Healthy").Return(true)
-		b3.On("Address").Return(&url.URL{Host: "backend3"}).Maybe()
 
 		lc := balancer.NewLeastConnections([]balancer.BackendServer{b1, b2, b3})
 
@@ -52,15 +47,11 @@ func TestLeastConnections(t *testing.T) {
 	t.Run("returns error when no healthy backend is available", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
-		b1.On("GetConnections").Return(int64(0))
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(false)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
-		b2.On("GetConnections").Return(int64(0))
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(false)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
 		lc := balancer.NewLeastConnections([]balancer.BackendServer{b1, b2})
 
@@ -68,16 +59,55 @@ func TestLeastConnections(t *testing.T) {
 		require.ErrorIs(t, err, balancer.ErrNoHealthyBackends)
 	})
 
+	t.Run("skip saturated backends", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", true, 1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("GetConnections").Return(int64(5))
+		b2.On("Healthy").Return(true)
+
+		lc := balancer.NewLeastConnections([]balancer.BackendServer{b1, b2})
+
+		selected, err := lc.Next()
+		require.NoError(t, err)
+		assert.Equal(t, b2, selected)
+
+		lc.UpdateBackends([]balancer.BackendServer{b1})
+
+		_, err = lc.Next()
+		require.ErrorIs(t, err, balancer.ErrAllSaturated)
+	})
+
+	t.Run("divide connections by weight during slow start", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 0.1)
+		b1.On("GetConnections").Return(int64(0))
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("GetConnections").Return(int64(3))
+		b2.On("Healthy").Return(true)
+
+		lc := balancer.NewLeastConnections([]balancer.BackendServer{b1, b2})
+
+		selected, err := lc.Next()
+		require.NoError(t, err)
+		assert.Equal(t, b2, selected)
+	})
+
 	t.Run("update backends array successfully", func(t *testing.T) {
 		t.Parallel()
 
 		b1 := mocks.NewBackendServer(t)
 		lc := balancer.NewLeastConnections([]balancer.BackendServer{b1})
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("GetConnections").Return(int64(0))
 		b2.On("Healthy").Return(true)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
 		lc.UpdateBackends([]balancer.BackendServer{b2})
 
@@ -105,10 +135,9 @@ func TestLeastConnections(t *testing.T) {
 			go func() {
 				defer wg.Done()
 
-				b := mocks.NewBackendServer(t)
+				b := mockBackend(t, "backend1", false, 1)
 				b.On("GetConnections").Return(int64(1)).Maybe()
 				b.On("Healthy").Return(true).Maybe()
-				b.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
 				lc.UpdateBackends([]balancer.BackendServer{b})
 			}()
@@ -70,11 +70,77 @@ func (_m *BackendServer) Healthy() bool {
 	return r0
 }
 
+// Saturated provides a mock function with no fields
+func (_m *BackendServer) Saturated() bool {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Saturated")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // ServeHTTP provides a mock function with given fields: w, r
 func (_m *BackendServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_m.Called(w, r)
 }
 
+// TryAcquire provides a mock function with no fields
+func (_m *BackendServer) TryAcquire() (func(), bool) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for TryAcquire")
+	}
+
+	var r0 func()
+	var r1 bool
+	if rf, ok := ret.Get(0).(func() (func(), bool)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() func()); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(func())
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() bool); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// Weight provides a mock function with no fields
+func (_m *BackendServer) Weight() float64 {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Weight")
+	}
+
+	var r0 float64
+	if rf, ok := ret.Get(0).(func() float64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	return r0
+}
+
 // NewBackendServer creates a new instance of BackendServer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewBackendServer(t interface {
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log/slog"
 	"math/big"
+	"slices"
 	"sync/atomic"
 )
 
 var _ Balancer = (*Random)(nil)
 
+// randomWeightScale is a resolution of backend weights in random selection.
+const randomWeightScale = 1000
+
 // Random implements random balancing.
 type Random struct {
 	backends atomic.Pointer[[]BackendServer]
@@ -23,7 +27,7 @@ func NewRandom(backends []BackendServer) *Random {
 	return r
 }
 
-// Next returns a random backend server.
+// Next returns a random backend server, backends in slow start are selected less often.
 //
 //nolint:ireturn
 func (r *Random) Next() (BackendServer, error) {
@@ -33,28 +37,36 @@ func (r *Random) Next() (BackendServer, error) {
 		return nil, ErrNoBackends
 	}
 
-	var selected BackendServer
+	candidates := make([]BackendServer, 0, len(backends))
+	// cumulative weights of candidates, scaled to integers
+	bounds := make([]int64, 0, len(backends))
+	saturated := false
+
+	var total int64
 
-	// try to get a healthy backend with upper limit
-	for range len(backends) * 5 {
-		randomIdx, err := rand.Int(rand.Reader, big.NewInt(int64(len(backends))))
-		if err != nil {
-			return nil, fmt.Errorf("error getting random backend: %w", err)
+	for _, backend := range backends {
+		if !available(backend, &saturated) {
+			continue
 		}
 
-		randomBackend := backends[randomIdx.Int64()]
+		total += max(int64(backend.Weight()*randomWeightScale), 1)
+		candidates = append(candidates, backend)
+		bounds = append(bounds, total)
+	}
 
-		if randomBackend.Healthy() {
-			selected = randomBackend
-			break
-		}
+	if len(candidates) == 0 {
+		return nil, unavailableError(saturated)
 	}
 
-	if selected == nil {
-		return nil, ErrNoHealthyBackends
+	point, err := rand.Int(rand.Reader, big.NewInt(total))
+	if err != nil {
+		return nil, fmt.Errorf("error getting random backend: %w", err)
 	}
 
-	slog.Debug("selected backend using random",
+	idx, _ := slices.BinarySearch(bounds, point.Int64()+1)
+	selected := candidates[idx]
+
+	logger.Debug("selected backend using random",
 		slog.String("addr", selected.Address().Host),
 	)
 
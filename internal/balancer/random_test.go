@@ -1,7 +1,6 @@
 package balancer_test
 
 import (
-	"net/url"
 	"sync"
 	"testing"
 
@@ -18,21 +17,17 @@ func TestRandom(t *testing.T) {
 	t.Run("get the healthy backend", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(true).Maybe()
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(true).Maybe()
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
-		b3 := mocks.NewBackendServer(t)
+		b3 := mockBackend(t, "backend3", false, 1)
 		b3.On("Healthy").Return(true).Maybe()
-		b3.On("Address").Return(&url.URL{Host: "backend3"}).Maybe()
 
-		b4 := mocks.NewBackendServer(t)
+		b4 := mockBackend(t, "backend4", false, 1)
 		b4.On("Healthy").Return(false).Maybe()
-		b4.On("Address").Return(&url.URL{Host: "backend4"}).Maybe()
 
 		random := balancer.NewRandom([]balancer.BackendServer{b1, b2, b3, b4})
 
@@ -52,28 +47,73 @@ func TestRandom(t *testing.T) {
 	t.Run("return error when no healthy backends are available", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(false)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(false)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
 		random := balancer.NewRandom([]balancer.BackendServer{b1, b2})
 		_, err := random.Next()
 		require.ErrorIs(t, err, balancer.ErrNoHealthyBackends)
 	})
 
+	t.Run("skip saturated backends", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", true, 1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true)
+
+		random := balancer.NewRandom([]balancer.BackendServer{b1, b2})
+
+		for range 10 {
+			selected, err := random.Next()
+			require.NoError(t, err)
+			assert.Equal(t, b2, selected)
+		}
+
+		random.UpdateBackends([]balancer.BackendServer{b1})
+
+		_, err := random.Next()
+		require.ErrorIs(t, err, balancer.ErrAllSaturated)
+	})
+
+	t.Run("select backends in slow start less often", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 0.1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true)
+
+		random := balancer.NewRandom([]balancer.BackendServer{b1, b2})
+
+		selections := map[balancer.BackendServer]int{}
+
+		for range 1000 {
+			selected, err := random.Next()
+			require.NoError(t, err)
+
+			selections[selected]++
+		}
+
+		// the expected amount is about 90
+		assert.Less(t, selections[b1], 200)
+		assert.Greater(t, selections[b2], 800)
+	})
+
 	t.Run("update backends successfully", func(t *testing.T) {
 		t.Parallel()
 
 		b1 := mocks.NewBackendServer(t)
 		random := balancer.NewRandom([]balancer.BackendServer{b1})
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(true)
-		b2.On("Address").Return(&url.URL{Host: "backend2"})
 
 		random.UpdateBackends([]balancer.BackendServer{b2})
 
@@ -101,9 +141,8 @@ func TestRandom(t *testing.T) {
 			go func() {
 				defer wg.Done()
 
-				b := mocks.NewBackendServer(t)
+				b := mockBackend(t, "backend", false, 1)
 				b.On("Healthy").Return(true).Maybe()
-				b.On("Address").Return(&url.URL{Host: "backend"}).Maybe()
 
 				random.UpdateBackends([]balancer.BackendServer{b})
 			}()
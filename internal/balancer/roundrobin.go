@@ -2,6 +2,8 @@ package balancer
 
 import (
 	"log/slog"
+	"slices"
+	"sync"
 	"sync/atomic"
 )
 
@@ -11,6 +13,10 @@ var _ Balancer = (*RoundRobin)(nil)
 type RoundRobin struct {
 	counter  atomic.Uint64
 	backends atomic.Pointer[[]BackendServer]
+	// fallbacks rotates backends, that are selected when all of them skip their turns
+	fallbacks atomic.Uint64
+	// mu serializes updates of backends together with the counter
+	mu sync.Mutex
 }
 
 // NewRoundRobin creates a new RoundRobin balancer.
@@ -31,37 +37,73 @@ func (rr *RoundRobin) Next() (BackendServer, error) {
 		return nil, ErrNoBackends
 	}
 
-	var selected BackendServer
+	var (
+		selected BackendServer
+		skipped  []BackendServer
+	)
+
+	saturated := false
 
 	for range backends {
-		nextIdx := rr.counter.Load() % uint64(len(backends))
+		// every call gets its own turn, even when calls are concurrent
+		nextIdx := (rr.counter.Add(1) - 1) % uint64(len(backends))
 		nextBackend := backends[nextIdx]
 
-		rr.counter.Add(1)
+		if !available(nextBackend, &saturated) {
+			continue
+		}
 
-		if nextBackend.Healthy() {
+		// backends in slow start skip some of their turns
+		if accept(nextBackend.Weight()) {
 			selected = nextBackend
 
 			break
 		}
+
+		skipped = append(skipped, nextBackend)
+	}
+
+	if selected == nil && len(skipped) > 0 {
+		// all available backends skipped their turns, e.g. all of them are in slow start,
+		// so they take turns separately, otherwise the first of them would get all requests
+		selected = skipped[(rr.fallbacks.Add(1)-1)%uint64(len(skipped))]
 	}
 
 	if selected == nil {
-		return nil, ErrNoHealthyBackends
+		return nil, unavailableError(saturated)
 	}
 
-	slog.Debug("selected backend using round robin",
+	logger.Debug("selected backend using round robin",
 		slog.String("addr", selected.Address().Host),
 	)
 
 	return selected, nil
 }
 
-// UpdateBackends updates the list of available backends.
+// UpdateBackends updates the list of available backends. The rotation continues from the backend,
+// that would be selected next, or the first one after it, that is still in the list.
 func (rr *RoundRobin) UpdateBackends(backends []BackendServer) {
 	// create a new slice and copy to prevent external modification
 	copied := make([]BackendServer, len(backends))
 	copy(copied, backends)
 
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	var counter uint64
+
+	if old := rr.backends.Load(); old != nil && len(*old) > 0 {
+		size := uint64(len(*old))
+		next := rr.counter.Load() % size
+
+		for i := range size {
+			if idx := slices.Index(copied, (*old)[(next+i)%size]); idx >= 0 {
+				counter = uint64(idx)
+				break
+			}
+		}
+	}
+
+	rr.counter.Store(counter)
 	rr.backends.Store(&copied)
 }
@@ -1,7 +1,6 @@
 package balancer_test
 
 import (
-	"net/url"
 	"sync"
 	"testing"
 
@@ -18,21 +17,17 @@ func TestRoundRobin(t *testing.T) {
 	t.Run("get all healthy backends in order", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(true)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(false)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
-		b3 := mocks.NewBackendServer(t)
+		b3 := mockBackend(t, "backend3", false, 1)
 		b3.On("Healthy").Return(true)
-		b3.On("Address").Return(&url.URL{Host: "backend3"}).Maybe()
 
-		b4 := mocks.NewBackendServer(t)
+		b4 := mockBackend(t, "backend4", false, 1)
 		b4.On("Healthy").Return(true)
-		b4.On("Address").Return(&url.URL{Host: "backend4"}).Maybe()
 
 		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2, b3, b4})
 
@@ -56,17 +51,14 @@ func TestRoundRobin(t *testing.T) {
 	t.Run("get only healthy backend twice", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(false)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(true)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
-		b3 := mocks.NewBackendServer(t)
+		b3 := mockBackend(t, "backend3", false, 1)
 		b3.On("Healthy").Return(false)
-		b3.On("Address").Return(&url.URL{Host: "backend3"}).Maybe()
 
 		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2, b3})
 
@@ -90,28 +82,157 @@ func TestRoundRobin(t *testing.T) {
 	t.Run("return error when no healthy backends are available", func(t *testing.T) {
 		t.Parallel()
 
-		b1 := mocks.NewBackendServer(t)
+		b1 := mockBackend(t, "backend1", false, 1)
 		b1.On("Healthy").Return(false)
-		b1.On("Address").Return(&url.URL{Host: "backend1"}).Maybe()
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(false)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
 		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2})
 		_, err := rr.Next()
 		require.ErrorIs(t, err, balancer.ErrNoHealthyBackends)
 	})
 
+	t.Run("skip saturated backends", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", true, 1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true)
+
+		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2})
+
+		for range 3 {
+			selected, err := rr.Next()
+			require.NoError(t, err)
+			assert.Equal(t, b2, selected)
+		}
+
+		rr.UpdateBackends([]balancer.BackendServer{b1})
+
+		_, err := rr.Next()
+		require.ErrorIs(t, err, balancer.ErrAllSaturated)
+	})
+
+	t.Run("skip turns of backends in slow start", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 0)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true)
+
+		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2})
+
+		for range 3 {
+			selected, err := rr.Next()
+			require.NoError(t, err)
+			assert.Equal(t, b2, selected)
+		}
+
+		// the backend is still selected, when there is no other one
+		rr.UpdateBackends([]balancer.BackendServer{b1})
+
+		selected, err := rr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, b1, selected)
+	})
+
+	t.Run("rotate backends when all of them are in slow start", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 0)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 0)
+		b2.On("Healthy").Return(true)
+
+		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2})
+
+		for _, want := range []balancer.BackendServer{b1, b2, b1, b2} {
+			selected, err := rr.Next()
+			require.NoError(t, err)
+			assert.Equal(t, want, selected)
+		}
+	})
+
+	t.Run("continue rotation after update", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true).Maybe()
+
+		b3 := mockBackend(t, "backend3", false, 1)
+		b3.On("Healthy").Return(true)
+
+		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2, b3})
+
+		selected, err := rr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, b1, selected)
+
+		// b2 was next, but it's removed, so the rotation continues from b3
+		rr.UpdateBackends([]balancer.BackendServer{b3, b1})
+
+		for _, want := range []balancer.BackendServer{b3, b1, b3} {
+			selected, err = rr.Next()
+			require.NoError(t, err)
+			assert.Equal(t, want, selected)
+		}
+	})
+
+	t.Run("distribute concurrent requests evenly", func(t *testing.T) {
+		t.Parallel()
+
+		b1 := mockBackend(t, "backend1", false, 1)
+		b1.On("Healthy").Return(true)
+
+		b2 := mockBackend(t, "backend2", false, 1)
+		b2.On("Healthy").Return(true)
+
+		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1, b2})
+
+		var (
+			wg         sync.WaitGroup
+			mu         sync.Mutex
+			selections = map[balancer.BackendServer]int{}
+		)
+
+		for range 100 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				selected, err := rr.Next()
+				assert.NoError(t, err)
+
+				mu.Lock()
+				selections[selected]++
+				mu.Unlock()
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Equal(t, 50, selections[b1])
+		assert.Equal(t, 50, selections[b2])
+	})
+
 	t.Run("update backends successfully", func(t *testing.T) {
 		t.Parallel()
 
 		b1 := mocks.NewBackendServer(t)
 		rr := balancer.NewRoundRobin([]balancer.BackendServer{b1})
 
-		b2 := mocks.NewBackendServer(t)
+		b2 := mockBackend(t, "backend2", false, 1)
 		b2.On("Healthy").Return(true)
-		b2.On("Address").Return(&url.URL{Host: "backend2"}).Maybe()
 
 		rr.UpdateBackends([]balancer.BackendServer{b2})
 
@@ -139,9 +260,8 @@ func TestRoundRobin(t *testing.T) {
 			go func() {
 				defer wg.Done()
 
-				b := mocks.NewBackendServer(t)
+				b := mockBackend(t, "backend", false, 1)
 				b.On("Healthy").Return(true).Maybe()
-				b.On("Address").Return(&url.URL{Host: "backend"}).Maybe()
 
 				rr.UpdateBackends([]balancer.BackendServer{b})
 			}()
@@ -0,0 +1,379 @@
+// Package cluster shares backend health observations, ejections and rate limit usage between replicas
+// of the load balancer over a gossip protocol, so replicas agree, which backends are down.
+package cluster
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+var logger = logging.Component(logging.ClusterComponent)
+
+// ErrNoSecret is returned when the cluster is created without a secret.
+var ErrNoSecret = errors.New("cluster secret is required")
+
+// topRejectedClients is the amount of clients with the most rejections, shared in rate limit summaries.
+const topRejectedClients = 5
+
+// Observation is a view of a replica on a backend.
+type Observation struct {
+	// Up is true, if the backend passes health checks of the replica and isn't ejected by it.
+	Up      bool `json:"up"`
+	Ejected bool `json:"ejected"`
+}
+
+// RateLimitSummary contains rate limit usage of a pool on a replica.
+type RateLimitSummary struct {
+	Rejected    int64                        `json:"rejected"`
+	TopRejected []ratelimit.ClientRejections `json:"topRejected"`
+}
+
+// NodeState is a state of a replica, that is spread over the cluster.
+type NodeState struct {
+	Node string `json:"node"`
+	// Version is a creation time of the state (unix nano), newer states replace older ones.
+	Version int64 `json:"version"`
+	// Backends are observations by pool name and backend URL.
+	Backends   map[string]map[string]Observation `json:"backends"`
+	RateLimits map[string]RateLimitSummary       `json:"rateLimits"`
+}
+
+// Member is a replica with its last known state.
+type Member struct {
+	NodeState
+
+	Local    bool      `json:"local"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Status contains the cluster settings and its members.
+type Status struct {
+	Node    string   `json:"node"`
+	Quorum  int      `json:"quorum"`
+	Members []Member `json:"members"`
+}
+
+// Options contains settings of the cluster.
+type Options struct {
+	// Node is a unique name of this replica.
+	Node string
+	// Peers are "host:port" gossip addresses of other replicas.
+	Peers    []string
+	Interval time.Duration
+	// Fanout is the amount of peers, that receive every gossip round.
+	Fanout int
+	// Quorum is the amount of replicas, that must see a backend down to make it down cluster-wide.
+	Quorum int
+	// StateTTL is a time, after which state of a silent replica is forgotten.
+	StateTTL time.Duration
+	// Secret encrypts and authenticates gossip messages.
+	Secret string
+	// Client is used for gossip requests, a client with the interval as a timeout is used if it's nil.
+	Client *http.Client
+}
+
+// member is a state of a replica with the time, when it was received.
+type member struct {
+	state NodeState
+	seen  time.Time
+}
+
+// Cluster keeps states of replicas and decides health of backends of the pools by quorum.
+// Only states of peers are kept: the configured ones and replicas, that sent messages sealed with the secret.
+type Cluster struct {
+	opts  Options
+	pools []*pool.Pool
+	aead  cipher.AEAD
+
+	mu      sync.Mutex
+	members map[string]member
+	// peerNodes are node names of the configured peers by their addresses, learned from their responses.
+	peerNodes map[string]string
+	// senders are node names of replicas, that sent gossip messages to this one, they are peers too.
+	senders map[string]struct{}
+}
+
+// New creates a cluster of the pools.
+func New(pools []*pool.Pool, opts Options) (*Cluster, error) {
+	if opts.Secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	aead, err := newAEAD(opts.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cluster cipher: %w", err)
+	}
+
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Interval}
+	}
+
+	c := &Cluster{
+		opts:      opts,
+		pools:     pools,
+		aead:      aead,
+		members:   make(map[string]member),
+		peerNodes: make(map[string]string, len(opts.Peers)),
+		senders:   make(map[string]struct{}),
+	}
+
+	c.refreshLocal()
+
+	return c, nil
+}
+
+// Run gossips with peers and updates health of backends every interval until ctx is done.
+func (c *Cluster) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Round(ctx)
+		}
+	}
+}
+
+// Round refreshes the local state, exchanges states with random peers and updates health of backends.
+func (c *Cluster) Round(ctx context.Context) {
+	c.refreshLocal()
+
+	var wg sync.WaitGroup
+
+	for _, peer := range c.pickPeers() {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := c.exchange(ctx, peer); err != nil {
+				logger.Debug("failed to gossip with peer", slog.String("peer", peer), slog.Any("error", err))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	c.decide()
+}
+
+// Status returns the cluster settings and its live members, the local one goes first.
+func (c *Cluster) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members := make([]Member, 0, len(c.members))
+	for _, m := range c.members {
+		members = append(members, Member{
+			NodeState: m.state,
+			Local:     m.state.Node == c.opts.Node,
+			LastSeen:  m.seen,
+		})
+	}
+
+	slices.SortFunc(members, func(a, b Member) int {
+		switch {
+		case a.Local:
+			return -1
+		case b.Local:
+			return 1
+		}
+
+		return strings.Compare(a.Node, b.Node)
+	})
+
+	return Status{
+		Node:    c.opts.Node,
+		Quorum:  c.opts.Quorum,
+		Members: members,
+	}
+}
+
+// pickPeers returns up to fanout random peers.
+func (c *Cluster) pickPeers() []string {
+	peers := slices.Clone(c.opts.Peers)
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+
+	return peers[:min(c.opts.Fanout, len(peers))]
+}
+
+// refreshLocal stores the current state of this replica with a new version.
+func (c *Cluster) refreshLocal() {
+	state := NodeState{
+		Node:       c.opts.Node,
+		Version:    time.Now().UnixNano(),
+		Backends:   make(map[string]map[string]Observation, len(c.pools)),
+		RateLimits: make(map[string]RateLimitSummary, len(c.pools)),
+	}
+
+	for _, p := range c.pools {
+		backends := p.GetBackends()
+
+		observations := make(map[string]Observation, len(backends))
+		for _, b := range backends {
+			observations[b.Address().String()] = Observation{
+				Up:      b.LocallyHealthy(),
+				Ejected: b.Ejected(),
+			}
+		}
+
+		state.Backends[p.Name] = observations
+		state.RateLimits[p.Name] = RateLimitSummary{
+			Rejected:    p.Limiter.Rejected(),
+			TopRejected: p.Limiter.TopRejected(topRejectedClients),
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.members[c.opts.Node] = member{state: state, seen: time.Now()}
+}
+
+// addPeer stores the node name of the configured peer. The state of the node, that had the address before,
+// is forgotten.
+func (c *Cluster) addPeer(peer, node string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.peerNodes[peer]
+	if ok && prev == node {
+		return
+	}
+
+	if ok {
+		delete(c.members, prev)
+	}
+
+	c.peerNodes[peer] = node
+}
+
+// addSender stores the node name of the replica, that sent an authenticated message, so its states are accepted
+// before this replica exchanges with it.
+func (c *Cluster) addSender(node string) {
+	if node == "" || node == c.opts.Node {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.senders[node] = struct{}{}
+}
+
+// isPeer returns true if the node is one of the configured peers or sent messages to this replica,
+// c.mu must be held.
+func (c *Cluster) isPeer(node string) bool {
+	if _, ok := c.senders[node]; ok {
+		return true
+	}
+
+	for _, peerNode := range c.peerNodes {
+		if peerNode == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+// merge stores states of the peers, that are newer than the known ones. States of this replica are ignored,
+// as it's the only source of them, states of other nodes are ignored, as they can't vote.
+func (c *Cluster) merge(states []NodeState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for _, state := range states {
+		if state.Node == "" || state.Node == c.opts.Node || !c.isPeer(state.Node) {
+			continue
+		}
+
+		known, ok := c.members[state.Node]
+		if ok && known.state.Version >= state.Version {
+			continue
+		}
+
+		if !ok {
+			logger.Info("cluster member joined", slog.String("node", state.Node))
+		}
+
+		c.members[state.Node] = member{state: state, seen: now}
+	}
+}
+
+// states returns states of live members and forgets the expired ones.
+func (c *Cluster) states() []NodeState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make([]NodeState, 0, len(c.members))
+
+	for node, m := range c.members {
+		if node != c.opts.Node && time.Since(m.seen) > c.opts.StateTTL {
+			delete(c.members, node)
+			delete(c.senders, node)
+
+			logger.Warn("cluster member left", slog.String("node", node))
+
+			continue
+		}
+
+		res = append(res, m.state)
+	}
+
+	return res
+}
+
+// decide updates health of backends: a backend is down, if at least quorum replicas see it down.
+// Otherwise, or if less than quorum replicas observe the backend, the local health is used.
+func (c *Cluster) decide() {
+	states := c.states()
+
+	for _, p := range c.pools {
+		for _, b := range p.GetBackends() {
+			addr := b.Address().String()
+
+			var voters, down int
+
+			for _, state := range states {
+				observation, ok := state.Backends[p.Name][addr]
+				if !ok {
+					continue
+				}
+
+				voters++
+
+				if !observation.Up {
+					down++
+				}
+			}
+
+			if voters < c.opts.Quorum {
+				b.ResetClusterHealth()
+				continue
+			}
+
+			b.SetClusterHealth(down < c.opts.Quorum)
+		}
+	}
+}
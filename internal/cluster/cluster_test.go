@@ -0,0 +1,243 @@
+package cluster_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/cluster"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+const backendURL = "http://localhost:1"
+
+type denyAll struct{}
+
+func (denyAll) ClientAllowed(string) bool {
+	return false
+}
+
+type replica struct {
+	cluster *cluster.Cluster
+	backend *backend.Backend
+	limiter *ratelimit.RejectionTracker
+}
+
+// newReplicas creates replicas with the same backend, that gossip with each other over HTTP.
+func newReplicas(t *testing.T, secrets []string, quorum int) []*replica {
+	t.Helper()
+
+	replicas := make([]*replica, len(secrets))
+	addrs := make([]string, len(secrets))
+
+	for i := range secrets {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			replicas[i].cluster.Handler().ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+
+		addrs[i] = strings.TrimPrefix(srv.URL, "http://")
+	}
+
+	for i, secret := range secrets {
+		backends, err := backend.NewBackendServers(t.Context(), []string{backendURL}, backend.Options{
+			HealthCheckInterval: time.Hour,
+			HealthCheckTimeout:  time.Second,
+			HealthCheckType:     backend.NoHealthCheck,
+		})
+		require.NoError(t, err)
+
+		limiter := ratelimit.NewRejectionTracker(denyAll{}, 0)
+		p := &pool.Pool{Name: "api", Limiter: limiter, Backends: backends}
+
+		var peers []string
+
+		for j, addr := range addrs {
+			if j != i {
+				peers = append(peers, addr)
+			}
+		}
+
+		c, err := cluster.New([]*pool.Pool{p}, cluster.Options{
+			Node:     string(rune('a' + i)),
+			Peers:    peers,
+			Interval: time.Second,
+			Fanout:   len(peers),
+			Quorum:   quorum,
+			StateTTL: time.Minute,
+			Secret:   secret,
+		})
+		require.NoError(t, err)
+
+		replicas[i] = &replica{cluster: c, backend: backends[0], limiter: limiter}
+	}
+
+	return replicas
+}
+
+// gossip runs rounds on all replicas twice, so the states are spread to everyone.
+func gossip(t *testing.T, replicas []*replica) {
+	t.Helper()
+
+	for range 2 {
+		for _, r := range replicas {
+			r.cluster.Round(t.Context())
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	t.Parallel()
+
+	replicas := newReplicas(t, []string{"secret", "secret", "secret"}, 2)
+
+	// a single replica, that sees the backend down, is outvoted, but keeps its own ejection
+	replicas[0].backend.Eject(time.Hour)
+	gossip(t, replicas)
+
+	for _, r := range replicas {
+		require.NotNil(t, r.backend.Status().ClusterHealthy)
+		assert.True(t, *r.backend.Status().ClusterHealthy)
+	}
+
+	assert.False(t, replicas[0].backend.Healthy())
+	assert.True(t, replicas[1].backend.Healthy())
+	assert.True(t, replicas[2].backend.Healthy())
+
+	// the quorum makes the backend down on all replicas
+	replicas[1].backend.Eject(time.Hour)
+	gossip(t, replicas)
+
+	for _, r := range replicas {
+		assert.False(t, r.backend.Healthy())
+	}
+
+	assert.True(t, replicas[2].backend.LocallyHealthy())
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	replicas := newReplicas(t, []string{"secret", "secret"}, 2)
+
+	replicas[1].limiter.ClientAllowed("client")
+	gossip(t, replicas)
+
+	status := replicas[0].cluster.Status()
+	assert.Equal(t, "a", status.Node)
+	require.Len(t, status.Members, 2)
+	assert.True(t, status.Members[0].Local)
+
+	remote := status.Members[1]
+	assert.Equal(t, "b", remote.Node)
+	assert.Equal(t, cluster.Observation{Up: true}, remote.Backends["api"][backendURL])
+	assert.Equal(t, cluster.RateLimitSummary{
+		Rejected:    1,
+		TopRejected: []ratelimit.ClientRejections{{Identifier: "client", Rejections: 1}},
+	}, remote.RateLimits["api"])
+}
+
+func TestNoQuorum(t *testing.T) {
+	t.Parallel()
+
+	// messages of replicas with another secret are rejected, so there are not enough voters
+	replicas := newReplicas(t, []string{"secret", "other"}, 2)
+
+	replicas[0].backend.Eject(time.Hour)
+	gossip(t, replicas)
+
+	for _, r := range replicas {
+		assert.Nil(t, r.backend.Status().ClusterHealthy)
+		assert.Len(t, r.cluster.Status().Members, 1)
+	}
+
+	assert.False(t, replicas[0].backend.Healthy(), "local health is used")
+	assert.True(t, replicas[1].backend.Healthy())
+}
+
+func TestUnknownNode(t *testing.T) {
+	t.Parallel()
+
+	replicas := newReplicas(t, []string{"secret", "secret"}, 2)
+	gossip(t, replicas)
+
+	srv := httptest.NewServer(replicas[0].cluster.Handler())
+	t.Cleanup(srv.Close)
+
+	// a replica with the secret, that isn't configured as a peer of others
+	outsider, err := cluster.New(nil, cluster.Options{
+		Node:     "x",
+		Peers:    []string{strings.TrimPrefix(srv.URL, "http://")},
+		Interval: time.Second,
+		Fanout:   1,
+		Quorum:   1,
+		StateTTL: time.Minute,
+		Secret:   "secret",
+	})
+	require.NoError(t, err)
+
+	outsider.Round(t.Context())
+	gossip(t, replicas)
+
+	// it becomes a peer of the replica, it sends messages to
+	members := replicas[0].cluster.Status().Members
+	require.Len(t, members, 3)
+	assert.Equal(t, "x", members[2].Node)
+
+	// but its state, relayed by the peer, is ignored by others
+	members = replicas[1].cluster.Status().Members
+	require.Len(t, members, 2)
+	assert.NotEqual(t, "x", members[1].Node)
+
+	assert.Len(t, outsider.Status().Members, 2, "only states of peers are accepted")
+}
+
+func TestInboundPeer(t *testing.T) {
+	t.Parallel()
+
+	replicas := newReplicas(t, []string{"secret", "secret"}, 2)
+
+	// the state of the peer, that sends a message first, is accepted
+	replicas[1].cluster.Round(t.Context())
+
+	members := replicas[0].cluster.Status().Members
+	require.Len(t, members, 2)
+	assert.Equal(t, "b", members[1].Node)
+}
+
+func TestNewWithoutSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := cluster.New(nil, cluster.Options{Node: "a", Interval: time.Second})
+	require.ErrorIs(t, err, cluster.ErrNoSecret)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	replicas := newReplicas(t, []string{"secret"}, 1)
+	handler := replicas[0].cluster.Handler()
+
+	t.Run("reject unencrypted message", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/gossip", strings.NewReader("[]")))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("reject other methods", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gossip", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrInvalidMessage is returned when a gossip message isn't sealed with the cluster secret.
+	ErrInvalidMessage = errors.New("invalid gossip message")
+	// ErrUnexpectedStatus is returned when a peer responds with a non-200 status.
+	ErrUnexpectedStatus = errors.New("unexpected status code")
+)
+
+const (
+	gossipPath = "/gossip"
+	// NodeHeader contains the name of the replica, that sent the message, it's authenticated with the body.
+	NodeHeader = "X-Cluster-Node"
+	// maxMessageSize limits gossip message bodies.
+	maxMessageSize = 4 << 20
+)
+
+// newAEAD creates AES-256-GCM with the key derived from the secret, it encrypts and authenticates messages,
+// as they contain client identifiers.
+//
+//nolint:ireturn
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCM: %w", err)
+	}
+
+	return aead, nil
+}
+
+// Handler returns the handler of gossip messages from peers. A peer sends the states it knows
+// and receives the states known by this replica.
+func (c *Cluster) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+gossipPath, c.handleGossip)
+
+	return mux
+}
+
+func (c *Cluster) handleGossip(w http.ResponseWriter, r *http.Request) {
+	states, err := c.readMessage(http.MaxBytesReader(w, r.Body, maxMessageSize), r.Header)
+
+	switch {
+	case errors.Is(err, ErrInvalidMessage):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the node name is authenticated with the message, so the sender is a peer, even if it isn't configured
+	// or this replica hasn't exchanged with it yet
+	c.addSender(r.Header.Get(NodeHeader))
+	c.merge(states)
+
+	body, err := json.Marshal(c.states())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(NodeHeader, c.opts.Node)
+
+	//nolint:errcheck
+	w.Write(c.seal(body))
+}
+
+// exchange sends the known states to the peer and merges the states known by it. The peer is identified
+// by the node name in its response, so states of this node are accepted from other replicas too.
+func (c *Cluster) exchange(ctx context.Context, peer string) error {
+	body, err := json.Marshal(c.states())
+	if err != nil {
+		return fmt.Errorf("error encoding gossip message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+peer+gossipPath,
+		bytes.NewReader(c.seal(body)))
+	if err != nil {
+		return fmt.Errorf("error creating gossip request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(NodeHeader, c.opts.Node)
+
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending gossip request: %w", err)
+	}
+
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	states, err := c.readMessage(io.LimitReader(resp.Body, maxMessageSize), resp.Header)
+	if err != nil {
+		return err
+	}
+
+	c.addPeer(peer, resp.Header.Get(NodeHeader))
+	c.merge(states)
+
+	return nil
+}
+
+// readMessage decrypts the message, verifies it together with the node header and decodes states from it.
+func (c *Cluster) readMessage(r io.Reader, header http.Header) ([]NodeState, error) {
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading gossip message: %w", err)
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(msg) < nonceSize {
+		return nil, ErrInvalidMessage
+	}
+
+	body, err := c.aead.Open(nil, msg[:nonceSize], msg[nonceSize:], []byte(header.Get(NodeHeader)))
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	var states []NodeState
+	if err := json.Unmarshal(body, &states); err != nil {
+		return nil, fmt.Errorf("error decoding gossip message: %w", err)
+	}
+
+	return states, nil
+}
+
+// seal encrypts the body with a random nonce, that is prepended to it. The node name of this replica
+// is authenticated together with the body.
+func (c *Cluster) seal(body []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+
+	//nolint:errcheck
+	rand.Read(nonce)
+
+	return c.aead.Seal(nonce, nonce, body, []byte(c.opts.Node))
+}
@@ -0,0 +1,34 @@
+package concurrency
+
+import "time"
+
+// DefaultBackoffRatio is used by AIMD, when no ratio is set.
+const DefaultBackoffRatio = 0.9
+
+// AIMD increases the limit by one after successful requests and decreases it multiplicatively
+// after dropped requests or requests slower than the timeout.
+type AIMD struct {
+	// Timeout is a latency, that is considered as overload.
+	Timeout time.Duration
+	// BackoffRatio multiplies the limit on overload, DefaultBackoffRatio is used if it's 0.
+	BackoffRatio float64
+}
+
+// Update implements Algorithm.
+func (a *AIMD) Update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped || (a.Timeout > 0 && rtt > a.Timeout) {
+		ratio := a.BackoffRatio
+		if ratio == 0 {
+			ratio = DefaultBackoffRatio
+		}
+
+		return limit * ratio
+	}
+
+	// the limit isn't raised, when requests don't use it, as it wouldn't be tested
+	if float64(inflight)*2 >= limit {
+		return limit + 1
+	}
+
+	return limit
+}
@@ -0,0 +1,59 @@
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// gradientTolerance is allowed growth of short-term latency over long-term one, before the limit is decreased.
+	gradientTolerance = 1.5
+	// gradientSmoothing is a weight of a new limit, applied to avoid oscillation.
+	gradientSmoothing = 0.2
+	// gradientWindow is the amount of samples in the long-term latency average.
+	gradientWindow = 600
+	// gradientMinGradient limits the decrease of the limit after one request.
+	gradientMinGradient = 0.5
+	// gradientDropRatio multiplies the limit after dropped requests.
+	gradientDropRatio = 0.9
+)
+
+// Gradient compares latency of every request with the long-term average, like Gradient2 of Netflix
+// concurrency-limits. When latency grows, the backend queues requests, so the limit is decreased proportionally,
+// otherwise it's increased by the square root of the limit, that is an allowed queue.
+type Gradient struct {
+	longRTT float64 // exponential moving average in nanoseconds
+}
+
+// Update implements Algorithm.
+func (g *Gradient) Update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped {
+		return limit * gradientDropRatio
+	}
+
+	shortRTT := float64(rtt)
+	if shortRTT <= 0 {
+		return limit
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = shortRTT
+	} else {
+		g.longRTT += (shortRTT - g.longRTT) * 2 / (gradientWindow + 1)
+	}
+
+	// after a long overload the average is too high, so it's pulled to the current latency faster
+	if g.longRTT/shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+
+	// the limit isn't raised, when requests don't use it, as it wouldn't be tested
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+
+	gradient := max(gradientMinGradient, min(1, gradientTolerance*g.longRTT/shortRTT))
+	newLimit := limit*gradient + math.Sqrt(limit)
+
+	return limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+}
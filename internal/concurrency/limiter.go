@@ -0,0 +1,193 @@
+// Package concurrency contains adaptive limits of concurrent requests to backends,
+// that are adjusted by latency of the requests.
+package concurrency
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.ConcurrencyComponent)
+
+// Priority is a class of requests, requests with lower priority are shed first.
+// The zero value is NormalPriority.
+type Priority int
+
+// A list of request priorities.
+const (
+	LowPriority Priority = iota - 1
+	NormalPriority
+	HighPriority
+)
+
+// share returns a part of the limit, that requests of the priority can use.
+func (p Priority) share() float64 {
+	switch {
+	case p <= LowPriority:
+		return 0.75
+	case p == NormalPriority:
+		return 0.9
+	default:
+		return 1
+	}
+}
+
+// Outcome is a result of a limited request.
+type Outcome int
+
+// A list of request outcomes.
+const (
+	// Success is a completed request, its latency is used to adjust the limit.
+	Success Outcome = iota
+	// Dropped is a request, that timed out, it's a sign of overload.
+	Dropped
+	// Ignored is a request, that says nothing about the backend, e.g. the client has left.
+	Ignored
+)
+
+// Algorithm adjusts the limit after every request.
+// It's called under the limiter lock, so implementations don't need synchronization.
+type Algorithm interface {
+	// Update returns a new limit after the request, that took rtt while inflight requests were running.
+	Update(limit float64, rtt time.Duration, inflight int, dropped bool) float64
+}
+
+// Options contains settings of the limiter.
+type Options struct {
+	// Name identifies the limiter in logs, e.g. pool name.
+	Name         string
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// RetryAfter is suggested to shed requests.
+	RetryAfter time.Duration
+}
+
+// ShedStats contains amounts of rejected requests by priority.
+type ShedStats struct {
+	Low    int64 `json:"low"`
+	Normal int64 `json:"normal"`
+	High   int64 `json:"high"`
+}
+
+// Stats is a snapshot of the limiter state.
+type Stats struct {
+	Limit    int       `json:"limit"`
+	Inflight int       `json:"inflight"`
+	Shed     ShedStats `json:"shed"`
+}
+
+// Limiter limits concurrent requests by the limit, that is adjusted by the algorithm.
+type Limiter struct {
+	alg  Algorithm
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+
+	shedLow    atomic.Int64
+	shedNormal atomic.Int64
+	shedHigh   atomic.Int64
+}
+
+// New creates a limiter with the algorithm, limits are corrected to be at least 1.
+func New(alg Algorithm, opts Options) *Limiter {
+	opts.MinLimit = max(opts.MinLimit, 1)
+	opts.MaxLimit = max(opts.MaxLimit, opts.MinLimit)
+	opts.InitialLimit = min(max(opts.InitialLimit, opts.MinLimit), opts.MaxLimit)
+
+	return &Limiter{
+		alg:   alg,
+		opts:  opts,
+		limit: float64(opts.InitialLimit),
+	}
+}
+
+// RetryAfter returns the delay, that is suggested to shed requests.
+func (l *Limiter) RetryAfter() time.Duration {
+	return l.opts.RetryAfter
+}
+
+// Acquire admits the request, if running requests don't exceed the part of the limit available to the priority.
+// Release must be called with the latency and outcome of admitted requests.
+func (l *Limiter) Acquire(priority Priority) (release func(rtt time.Duration, outcome Outcome), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// at least one request is admitted, even if the share rounds down
+	available := max(int(math.Floor(l.limit*priority.share())), 1)
+	if l.inflight >= available {
+		l.countShed(priority)
+		return nil, false
+	}
+
+	l.inflight++
+
+	var released atomic.Bool
+
+	return func(rtt time.Duration, outcome Outcome) {
+		if released.Swap(true) {
+			return
+		}
+
+		l.release(rtt, outcome)
+	}, true
+}
+
+func (l *Limiter) countShed(priority Priority) {
+	switch {
+	case priority <= LowPriority:
+		l.shedLow.Add(1)
+	case priority == NormalPriority:
+		l.shedNormal.Add(1)
+	default:
+		l.shedHigh.Add(1)
+	}
+}
+
+func (l *Limiter) release(rtt time.Duration, outcome Outcome) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+
+	if outcome == Ignored {
+		return
+	}
+
+	limit := l.alg.Update(l.limit, rtt, inflight, outcome == Dropped)
+	limit = min(max(limit, float64(l.opts.MinLimit)), float64(l.opts.MaxLimit))
+
+	if int(limit) != int(l.limit) {
+		logger.Debug("concurrency limit changed",
+			slog.String("name", l.opts.Name),
+			slog.Int("limit", int(limit)),
+			slog.Duration("rtt", rtt),
+		)
+	}
+
+	l.limit = limit
+}
+
+// Stats returns a snapshot of the limiter state.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Stats{
+		Limit:    int(l.limit),
+		Inflight: l.inflight,
+		Shed: ShedStats{
+			Low:    l.shedLow.Load(),
+			Normal: l.shedNormal.Load(),
+			High:   l.shedHigh.Load(),
+		},
+	}
+}
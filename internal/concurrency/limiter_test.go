@@ -0,0 +1,128 @@
+package concurrency_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+)
+
+// fixed is an algorithm, that never changes the limit.
+type fixed struct{}
+
+func (fixed) Update(limit float64, _ time.Duration, _ int, _ bool) float64 {
+	return limit
+}
+
+func TestLimiterPriorities(t *testing.T) {
+	t.Parallel()
+
+	l := concurrency.New(fixed{}, concurrency.Options{InitialLimit: 10, MaxLimit: 10})
+
+	admit := func(priority concurrency.Priority) int {
+		admitted := 0
+
+		for {
+			if _, ok := l.Acquire(priority); !ok {
+				return admitted
+			}
+
+			admitted++
+		}
+	}
+
+	// low priority is shed first, high priority can use the rest of the limit
+	assert.Equal(t, 7, admit(concurrency.LowPriority))
+	assert.Equal(t, 2, admit(concurrency.NormalPriority))
+	assert.Equal(t, 1, admit(concurrency.HighPriority))
+
+	stats := l.Stats()
+	assert.Equal(t, 10, stats.Inflight)
+	assert.Equal(t, concurrency.ShedStats{Low: 1, Normal: 1, High: 1}, stats.Shed)
+}
+
+func TestLimiterRelease(t *testing.T) {
+	t.Parallel()
+
+	l := concurrency.New(fixed{}, concurrency.Options{InitialLimit: 1})
+
+	release, ok := l.Acquire(concurrency.HighPriority)
+	require.True(t, ok)
+
+	_, ok = l.Acquire(concurrency.HighPriority)
+	require.False(t, ok)
+
+	release(time.Millisecond, concurrency.Success)
+	release(time.Millisecond, concurrency.Success)
+	assert.Equal(t, 0, l.Stats().Inflight)
+
+	_, ok = l.Acquire(concurrency.HighPriority)
+	assert.True(t, ok)
+}
+
+func TestAIMD(t *testing.T) {
+	t.Parallel()
+
+	l := concurrency.New(&concurrency.AIMD{Timeout: time.Second}, concurrency.Options{
+		InitialLimit: 10,
+		MinLimit:     5,
+		MaxLimit:     100,
+	})
+
+	run := func(rtt time.Duration, outcome concurrency.Outcome) {
+		release, ok := l.Acquire(concurrency.HighPriority)
+		require.True(t, ok)
+
+		// keep the limit used, so it can grow
+		releases := make([]func(time.Duration, concurrency.Outcome), 0, l.Stats().Limit)
+		for range l.Stats().Limit / 2 {
+			r, _ := l.Acquire(concurrency.HighPriority)
+			releases = append(releases, r)
+		}
+
+		release(rtt, outcome)
+
+		for _, r := range releases {
+			r(0, concurrency.Ignored)
+		}
+	}
+
+	run(time.Millisecond, concurrency.Success)
+	assert.Equal(t, 11, l.Stats().Limit)
+
+	run(time.Second*2, concurrency.Success)
+	assert.Equal(t, 9, l.Stats().Limit)
+
+	for range 20 {
+		run(0, concurrency.Dropped)
+	}
+
+	assert.Equal(t, 5, l.Stats().Limit)
+
+	run(time.Millisecond, concurrency.Ignored)
+	assert.Equal(t, 5, l.Stats().Limit)
+}
+
+func TestGradient(t *testing.T) {
+	t.Parallel()
+
+	var g concurrency.Gradient
+
+	limit := 20.0
+	for range 50 {
+		limit = g.Update(limit, time.Millisecond*10, int(limit), false)
+	}
+
+	assert.Greater(t, limit, 20.0, "stable latency raises the limit")
+
+	grown := limit
+	for range 50 {
+		limit = g.Update(limit, time.Millisecond*100, int(limit), false)
+	}
+
+	assert.Less(t, limit, grown, "growing latency lowers the limit")
+	assert.Equal(t, limit, g.Update(limit, time.Millisecond, 0, false), "unused limit is kept")
+}
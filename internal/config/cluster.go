@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrInvalidCluster is returned when cluster configuration is invalid.
+var ErrInvalidCluster = errors.New("invalid cluster config")
+
+// Cluster contains settings of sharing backend health, ejections and rate limit usage between replicas
+// of the load balancer. The gossip listener uses CLUSTER_PORT, messages are encrypted with CLUSTER_SECRET.
+type Cluster struct {
+	Enabled bool `yaml:"enabled"`
+	// Node is a unique name of the replica, the host name is used if it's empty.
+	Node string `yaml:"node"`
+	// Peers are "host:port" gossip addresses of other replicas.
+	Peers []string `yaml:"peers"`
+	// Interval between gossip rounds.
+	Interval time.Duration `env-default:"1s" yaml:"interval"`
+	// Fanout is the amount of peers, that receive every gossip round.
+	Fanout int `env-default:"3" yaml:"fanout"`
+	// Quorum is the amount of replicas, that must see a backend down, 0 means the majority of replicas.
+	Quorum int `yaml:"quorum"`
+	// StateTTL is a time, after which state of a silent replica is forgotten.
+	StateTTL time.Duration `env-default:"10s" yaml:"stateTTL"`
+}
+
+func (c *configYAML) applyClusterDefaults() {
+	if !c.Cluster.Enabled {
+		return
+	}
+
+	if c.Cluster.Node == "" {
+		// the error is handled by validation of the empty name
+		c.Cluster.Node, _ = os.Hostname()
+	}
+
+	if c.Cluster.Quorum == 0 {
+		c.Cluster.Quorum = (len(c.Cluster.Peers)+1)/2 + 1
+	}
+}
+
+func (c *configYAML) validateCluster() error {
+	if !c.Cluster.Enabled {
+		return nil
+	}
+
+	if c.Cluster.Node == "" {
+		return fmt.Errorf("%w: node name is required", ErrInvalidCluster)
+	}
+
+	if c.Cluster.Interval <= 0 || c.Cluster.StateTTL <= c.Cluster.Interval {
+		return fmt.Errorf("%w: stateTTL must be longer than interval", ErrInvalidCluster)
+	}
+
+	if c.Cluster.Fanout < 1 {
+		return fmt.Errorf("%w: fanout must be positive", ErrInvalidCluster)
+	}
+
+	if c.Cluster.Quorum < 1 || c.Cluster.Quorum > len(c.Cluster.Peers)+1 {
+		return fmt.Errorf("%w: quorum must be between 1 and the amount of replicas", ErrInvalidCluster)
+	}
+
+	return nil
+}
+
+// ClusterENV contains the gossip listener port and the shared secret of cluster messages.
+type ClusterENV struct {
+	Port string `env:"CLUSTER_PORT" env-default:"7946"`
+	// Secret encrypts and authenticates gossip messages, it's required in cluster mode.
+	Secret string `env:"CLUSTER_SECRET"`
+}
+
+// validateClusterSecret requires the secret in cluster mode, as gossip messages contain backend health
+// and client identifiers.
+func (c *Config) validateClusterSecret() error {
+	if c.YAML.Cluster.Enabled && c.ENV.Cluster.Secret == "" {
+		return fmt.Errorf("%w: CLUSTER_SECRET is required", ErrInvalidCluster)
+	}
+
+	return nil
+}
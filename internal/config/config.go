@@ -2,19 +2,83 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+var (
+	// ErrInvalidAdmin is returned when the admin API configuration is insecure.
+	ErrInvalidAdmin = errors.New("invalid admin API config")
+	// ErrInvalidTLS is returned when TLS configuration is invalid.
+	ErrInvalidTLS = errors.New("invalid TLS config")
+)
+
 // RateLimiterType is a type of rate limiter.
 type RateLimiterType string
 
 // BalancerType is a type of load balancer.
 type BalancerType string
 
+// LogFormat is a format of application logs.
+type LogFormat string
+
+// A list of available application log formats.
+const (
+	TextLogFormat LogFormat = "text"
+	JSONLogFormat LogFormat = "json"
+)
+
+// AccessLogFormat is a format of access log entries.
+type AccessLogFormat string
+
+// AccessLogOutput is a sink for access log entries.
+type AccessLogOutput string
+
+// A list of available access log formats and outputs.
+const (
+	JSONAccessLogFormat     AccessLogFormat = "json"
+	CommonAccessLogFormat   AccessLogFormat = "common"
+	CombinedAccessLogFormat AccessLogFormat = "combined"
+	TemplateAccessLogFormat AccessLogFormat = "template"
+	StdoutAccessLogOutput   AccessLogOutput = "stdout"
+	FileAccessLogOutput     AccessLogOutput = "file"
+	SyslogAccessLogOutput   AccessLogOutput = "syslog"
+)
+
+// ClientIdentity is a field of client certificate, used as a client identity.
+type ClientIdentity string
+
+// A list of available client certificate identities.
+const (
+	SubjectClientIdentity ClientIdentity = "subject"
+	SANClientIdentity     ClientIdentity = "san"
+)
+
+// ConcurrencyLimitType is an algorithm of adaptive concurrency limits.
+type ConcurrencyLimitType string
+
+// A list of available concurrency limit algorithms.
+const (
+	AIMDConcurrencyLimit     ConcurrencyLimitType = "aimd"
+	GradientConcurrencyLimit ConcurrencyLimitType = "gradient"
+)
+
+// RequestPriority is a class of requests, requests with lower priority are shed first on overload.
+type RequestPriority string
+
+// A list of available request priorities.
+const (
+	LowPriority    RequestPriority = "low"
+	NormalPriority RequestPriority = "normal"
+	HighPriority   RequestPriority = "high"
+)
+
 // A list of available balancers and rate limiters algorithms.
 const (
 	LeastConnectionsType BalancerType    = "least-connections"
@@ -36,6 +100,23 @@ type Postgres struct {
 type Balancer struct {
 	Type                  BalancerType  `env-default:"least-connections" yaml:"type"`
 	BackendsCheckInterval time.Duration `env-default:"10s"               yaml:"backendsCheckInterval"`
+	// MaxConnections limits concurrent requests of every backend, 0 means no limit.
+	MaxConnections int `yaml:"maxConnections"`
+	// SlowStart is a time, during which new and recovered backends get a growing part of requests, 0 disables it.
+	SlowStart time.Duration `yaml:"slowStart"`
+}
+
+// Queue contains settings of waiting for a backend, when all backends of a pool are unavailable or saturated.
+type Queue struct {
+	Enabled bool          `yaml:"enabled"`
+	MaxSize int           `env-default:"100" yaml:"maxSize"`
+	MaxWait time.Duration `env-default:"5s"  yaml:"maxWait"`
+	// PriorityHeader contains an integer priority of the request, higher priorities are served first.
+	// It must be set by a trusted proxy, as clients can send any value.
+	PriorityHeader string `yaml:"priorityHeader"`
+	// ClientPriorities are priorities of clients (rate limit keys or certificate identities),
+	// used when the request has no priority header.
+	ClientPriorities map[string]int `yaml:"clientPriorities"`
 }
 
 // RateLimit contains configuration for rate limiters.
@@ -46,17 +127,280 @@ type RateLimit struct {
 	TokenInterval time.Duration   `env-default:"5s"           yaml:"tokenInterval"`
 }
 
+// ConcurrencyLimit contains settings of an adaptive limit of concurrent requests to backends.
+// The limit is adjusted by latency of requests, requests over it are rejected with 503.
+type ConcurrencyLimit struct {
+	Enabled      bool                 `yaml:"enabled"`
+	Type         ConcurrencyLimitType `env-default:"gradient" yaml:"type"`
+	InitialLimit int                  `env-default:"20"       yaml:"initialLimit"`
+	MinLimit     int                  `env-default:"5"        yaml:"minLimit"`
+	MaxLimit     int                  `env-default:"1000"     yaml:"maxLimit"`
+	// Timeout is a latency, that is considered as overload by "aimd".
+	Timeout time.Duration `env-default:"1s" yaml:"timeout"`
+	// RetryAfter is sent in Retry-After header of rejected requests.
+	RetryAfter time.Duration `env-default:"1s" yaml:"retryAfter"`
+}
+
+// AccessLogFile contains settings for the rotating access log file.
+type AccessLogFile struct {
+	Path       string `env-default:"./logs/access.log" yaml:"path"`
+	MaxSizeMB  int    `env-default:"100"               yaml:"maxSizeMB"`
+	MaxBackups int    `env-default:"5"                 yaml:"maxBackups"`
+}
+
+// AccessLogSyslog contains settings for sending access log to syslog.
+type AccessLogSyslog struct {
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	Tag     string `env-default:"balancer" yaml:"tag"`
+}
+
+// AccessLog contains configuration for access logging.
+type AccessLog struct {
+	Enabled       *bool           `yaml:"enabled"`
+	Format        AccessLogFormat `env-default:"json"   yaml:"format"`
+	Template      string          `yaml:"template"`
+	Output        AccessLogOutput `env-default:"stdout" yaml:"output"`
+	BufferSize    int             `env-default:"1024"   yaml:"bufferSize"`
+	SampleSuccess float64         `env-default:"1"      yaml:"sampleSuccess"`
+	// TrustedProxies are IPs and CIDRs of proxies, whose X-Forwarded-For header is logged as the remote address.
+	TrustedProxies []string        `yaml:"trustedProxies"`
+	File           AccessLogFile   `yaml:"file"`
+	Syslog         AccessLogSyslog `yaml:"syslog"`
+}
+
+// Log contains configuration for application logs.
+// Levels are parsed with slog.Level.UnmarshalText ("debug", "info", "warn", "error").
+type Log struct {
+	Level      string            `env-default:"info" yaml:"level"`
+	Format     LogFormat         `env-default:"text" yaml:"format"`
+	Components map[string]string `yaml:"components"`
+}
+
+// TLSCertificate contains paths to PEM encoded certificate and key files.
+type TLSCertificate struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// HSTS contains settings of Strict-Transport-Security header.
+type HSTS struct {
+	Enabled           bool          `yaml:"enabled"`
+	MaxAge            time.Duration `env-default:"8760h" yaml:"maxAge"`
+	IncludeSubdomains bool          `yaml:"includeSubdomains"`
+	Preload           bool          `yaml:"preload"`
+}
+
+// ClientAuth contains settings of client certificate authentication on the HTTPS listener.
+type ClientAuth struct {
+	Enabled bool   `yaml:"enabled"`
+	CAFile  string `yaml:"caFile"`
+	// Identity is a certificate field, that replaces Rate-Limit-Key header and remote address as a client identifier.
+	Identity ClientIdentity `env-default:"subject" yaml:"identity"`
+	// Header is used to forward the verified identity to backends, empty disables forwarding.
+	Header string `env-default:"X-Client-Identity" yaml:"header"`
+}
+
+// TLS contains configuration for the HTTPS listener.
+type TLS struct {
+	Enabled bool `yaml:"enabled"`
+	// Certificates are selected by SNI, the first one is used when no certificate matches.
+	Certificates []TLSCertificate `yaml:"certificates"`
+	MinVersion   string           `env-default:"1.2" yaml:"minVersion"`
+	CipherSuites []string         `yaml:"cipherSuites"`
+	// ReloadInterval is a period of checking certificate files for changes, 0 disables reloading.
+	ReloadInterval *time.Duration `yaml:"reloadInterval"`
+	RedirectHTTP   bool           `yaml:"redirectHTTP"`
+	HSTS           HSTS           `yaml:"hsts"`
+	ClientAuth     ClientAuth     `yaml:"clientAuth"`
+}
+
+// Server contains settings of HTTP listeners.
+type Server struct {
+	ReadTimeout       time.Duration `env-default:"10s" yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `env-default:"5s"  yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `env-default:"10s" yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `env-default:"10s" yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `env-default:"1048576" yaml:"maxHeaderBytes"`
+}
+
+// HTTP2 contains settings of HTTP/2 on the listeners.
+type HTTP2 struct {
+	// Enabled allows HTTP/2 negotiation on the HTTPS listener.
+	Enabled *bool `yaml:"enabled"`
+	// H2C allows cleartext HTTP/2 with prior knowledge on the HTTP listener.
+	H2C bool `yaml:"h2c"`
+}
+
+// Upgrade contains settings of upgraded connections (WebSocket and other HTTP Upgrade protocols).
+type Upgrade struct {
+	// MaxPerClient limits concurrent upgraded connections of a client, 0 means no limit.
+	MaxPerClient *int `yaml:"maxPerClient"`
+	// DrainTimeout is how long shutdown waits for upgraded connections to be closed by clients or backends,
+	// before closing them, 0 closes them right away.
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+}
+
+// ErrorPages contains settings of HTML error pages.
+type ErrorPages struct {
+	// Dir contains "429.html", "502.html", "503.html", "504.html" and "maintenance.html" templates,
+	// empty disables HTML pages.
+	Dir string `yaml:"dir"`
+}
+
+// Maintenance contains the initial state of the maintenance mode, it can be changed by the admin API.
+type Maintenance struct {
+	Enabled bool `yaml:"enabled"`
+	// RetryAfter is sent in Retry-After header, 0 omits it.
+	RetryAfter *time.Duration `yaml:"retryAfter"`
+	// AllowedIPs are IPs and CIDRs, that still reach the backends.
+	AllowedIPs []string `yaml:"allowedIPs"`
+}
+
+// CacheDisk contains settings of the disk tier of the response cache.
+type CacheDisk struct {
+	// Dir keeps responses evicted from memory, empty disables the disk tier. Its entries are removed on start.
+	Dir       string `yaml:"dir"`
+	MaxSizeMB int    `env-default:"1024" yaml:"maxSizeMB"`
+}
+
+// Cache contains settings of the response cache, shared by routes with enabled caching.
+type Cache struct {
+	MaxSizeMB int `env-default:"64" yaml:"maxSizeMB"`
+	// MaxEntrySizeKB limits a body of a single response, larger responses are not stored.
+	MaxEntrySizeKB int       `env-default:"1024" yaml:"maxEntrySizeKB"`
+	Disk           CacheDisk `yaml:"disk"`
+}
+
+// Compression contains settings of response compression, routes can override them.
+type Compression struct {
+	Disabled bool `yaml:"disabled"`
+	// Level from 1 (fastest) to 9 (best) is used for brotli, zstd, gzip and deflate.
+	Level int `env-default:"5" yaml:"level"`
+	// MinSize is the smallest compressed response body in bytes.
+	MinSize int `env-default:"1024" yaml:"minSize"`
+	// ContentTypes are compressed media types, "text/*" matches all subtypes. Empty uses text, JSON, XML and SVG.
+	ContentTypes []string `yaml:"contentTypes"`
+	// DecompressRequests decodes gzip, deflate, brotli and zstd request bodies before they are sent to backends.
+	// It's a pointer, so a route can turn decompression off with false.
+	DecompressRequests *bool `yaml:"decompressRequests"`
+	// MaxDecompressedSizeMB limits decoded request bodies, 0 means no limit.
+	MaxDecompressedSizeMB *int `yaml:"maxDecompressedSizeMB"`
+}
+
+// GeoIP contains settings of the country database, used by access rules of routes.
+type GeoIP struct {
+	// Database is a MaxMind format (.mmdb) country or city database, empty disables country rules.
+	Database string `yaml:"database"`
+	// ReloadInterval is a period of checking the file for changes, 0 disables reloading.
+	ReloadInterval *time.Duration `yaml:"reloadInterval"`
+}
+
 // configYAML contains values from /config/config.yaml.
 type configYAML struct {
-	Backends  []string  `env-required:"true" yaml:"backends"`
-	Balancer  Balancer  `yaml:"balancer"`
-	RateLimit RateLimit `yaml:"rateLimit"`
+	Backends    []string    `yaml:"backends"`
+	Discovery   *Discovery  `yaml:"discovery"`
+	Balancer    Balancer    `yaml:"balancer"`
+	HealthCheck HealthCheck `yaml:"healthCheck"`
+	UpstreamTLS UpstreamTLS `yaml:"upstreamTLS"`
+	// Transport is used by pools without their own transport settings.
+	Transport Transport `yaml:"transport"`
+	// UpstreamProtocol is used by pools without their own protocol.
+	UpstreamProtocol UpstreamProtocol `env-default:"auto" yaml:"upstreamProtocol"`
+	RateLimit        RateLimit        `yaml:"rateLimit"`
+	// ConcurrencyLimit limits requests to backends of all pools together.
+	ConcurrencyLimit ConcurrencyLimit `yaml:"concurrencyLimit"`
+	Queue            Queue            `yaml:"queue"`
+	Pools            []Pool           `yaml:"pools"`
+	Routes           []Route          `yaml:"routes"`
+	TLS              TLS              `yaml:"tls"`
+	Server           Server           `yaml:"server"`
+	HTTP2            HTTP2            `yaml:"http2"`
+	Upgrade          Upgrade          `yaml:"upgrade"`
+	ErrorPages       ErrorPages       `yaml:"errorPages"`
+	Maintenance      Maintenance      `yaml:"maintenance"`
+	Cache            Cache            `yaml:"cache"`
+	Compression      Compression      `yaml:"compression"`
+	GeoIP            GeoIP            `yaml:"geoIP"`
+	L4               L4               `yaml:"l4"`
+	AccessLog        AccessLog        `yaml:"accessLog"`
+	Log              Log              `yaml:"log"`
+	Cluster          Cluster          `yaml:"cluster"`
 }
 
 // configENV contains values from .env.
 type configENV struct {
-	Port     string `env:"APP_PORT" env-default:"8080"`
-	Postgres Postgres
+	Port      string `env:"APP_PORT"   env-default:"8080"`
+	TLSPort   string `env:"TLS_PORT"   env-default:"8443"`
+	AdminPort string `env:"ADMIN_PORT" env-default:"8090"`
+	// AdminHost is the listen address of the admin API, it's only reachable locally by default.
+	AdminHost string `env:"ADMIN_HOST" env-default:"127.0.0.1"`
+	// AdminToken is a bearer token required by the admin API, it must be set if the API isn't bound to loopback.
+	AdminToken string `env:"ADMIN_TOKEN"`
+	Postgres   Postgres
+	Cluster    ClusterENV
+}
+
+// validateTLS forbids client certificate authentication, that can be bypassed over plain HTTP.
+func (c *configYAML) validateTLS() error {
+	if !c.TLS.ClientAuth.Enabled {
+		return nil
+	}
+
+	if !c.TLS.Enabled {
+		return fmt.Errorf("%w: clientAuth requires enabled TLS", ErrInvalidTLS)
+	}
+
+	// the proxy on the HTTP port would serve requests without client certificates
+	if !c.TLS.RedirectHTTP {
+		return fmt.Errorf("%w: clientAuth requires redirectHTTP", ErrInvalidTLS)
+	}
+
+	return nil
+}
+
+// validateAdmin forbids exposing the admin API without a token.
+func (c *configENV) validateAdmin() error {
+	if c.AdminToken != "" || c.AdminHost == "localhost" {
+		return nil
+	}
+
+	if addr, err := netip.ParseAddr(c.AdminHost); err == nil && addr.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("%w: ADMIN_TOKEN is required, when ADMIN_HOST isn't a loopback address", ErrInvalidAdmin)
+}
+
+// Defaults of the fields, where the zero value has a meaning. They are pointers set after reading the config,
+// because env-default also replaces zeros written in the config.
+const (
+	defaultAccessLogEnabled      = true
+	defaultHTTP2Enabled          = true
+	defaultMaxFailures           = 5
+	defaultTLSReloadInterval     = time.Second * 10
+	defaultUpgradesPerClient     = 10
+	defaultMaintenanceRetryAfter = time.Minute * 5
+	defaultMaxDecompressedSizeMB = 10
+	defaultGeoIPReloadInterval   = time.Minute
+)
+
+// setDefault sets the field to the value, if it's not set in the config.
+func setDefault[T any](field **T, value T) {
+	if *field == nil {
+		*field = &value
+	}
+}
+
+func (c *configYAML) applyDefaults() {
+	setDefault(&c.AccessLog.Enabled, defaultAccessLogEnabled)
+	setDefault(&c.HTTP2.Enabled, defaultHTTP2Enabled)
+	setDefault(&c.HealthCheck.Passive.MaxFailures, defaultMaxFailures)
+	setDefault(&c.TLS.ReloadInterval, defaultTLSReloadInterval)
+	setDefault(&c.Upgrade.MaxPerClient, defaultUpgradesPerClient)
+	setDefault(&c.Maintenance.RetryAfter, defaultMaintenanceRetryAfter)
+	setDefault(&c.Compression.MaxDecompressedSizeMB, defaultMaxDecompressedSizeMB)
+	setDefault(&c.GeoIP.ReloadInterval, defaultGeoIPReloadInterval)
 }
 
 // Config contains application configuration.
@@ -67,20 +411,65 @@ type Config struct {
 
 // MustInit reads .yaml config, then environment variables and returns a new global config.
 func MustInit() Config {
+	cfg, err := Load("./config/config.yaml", ".env")
+	if err != nil {
+		slog.Error("invalid configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+// Load reads the .yaml config and the .env file, then environment variables, fills unset fields and validates them.
+// Missing files are logged, defaults are used instead of them.
+func Load(yamlPath, envPath string) (Config, error) {
 	var cfg Config
 
-	if err := cleanenv.ReadConfig("./config/config.yaml", &cfg.YAML); err != nil {
-		slog.Info("failed to read ./config/config.yaml", slog.Any("error", err))
+	if err := cleanenv.ReadConfig(yamlPath, &cfg.YAML); err != nil {
+		slog.Info("failed to read "+yamlPath, slog.Any("error", err))
+	}
+
+	if err := cfg.YAML.validateTLS(); err != nil {
+		return Config{}, fmt.Errorf("invalid TLS configuration: %w", err)
 	}
 
-	if err := cleanenv.ReadConfig(".env", &cfg.ENV); err != nil {
-		slog.Info("failed to read .env", slog.Any("error", err))
+	cfg.YAML.applyDefaults()
+
+	if err := cfg.YAML.applyPoolDefaults(); err != nil {
+		return Config{}, fmt.Errorf("invalid pools configuration: %w", err)
+	}
+
+	if err := cfg.YAML.validatePools(); err != nil {
+		return Config{}, fmt.Errorf("invalid pools configuration: %w", err)
+	}
+
+	cfg.YAML.applyL4Defaults()
+
+	if err := cfg.YAML.validateL4(); err != nil {
+		return Config{}, fmt.Errorf("invalid layer-4 configuration: %w", err)
+	}
+
+	cfg.YAML.applyClusterDefaults()
+
+	if err := cfg.YAML.validateCluster(); err != nil {
+		return Config{}, fmt.Errorf("invalid cluster configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadConfig(envPath, &cfg.ENV); err != nil {
+		slog.Info("failed to read "+envPath, slog.Any("error", err))
 	}
 
 	if err := cleanenv.ReadEnv(&cfg.ENV); err != nil {
-		slog.Error("failed to read environment variables", slog.Any("error", err))
-		os.Exit(1)
+		return Config{}, fmt.Errorf("failed to read environment variables: %w", err)
 	}
 
-	return cfg
+	if err := cfg.ENV.validateAdmin(); err != nil {
+		return Config{}, fmt.Errorf("invalid admin API configuration: %w", err)
+	}
+
+	if err := cfg.validateClusterSecret(); err != nil {
+		return Config{}, fmt.Errorf("invalid cluster configuration: %w", err)
+	}
+
+	return cfg, nil
 }
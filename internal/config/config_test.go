@@ -0,0 +1,315 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+)
+
+const testEnv = "PG_USER=user\nPG_PASS=pass\nPG_HOST=localhost\nPG_DB=db\n"
+
+// load writes the yaml config and the required environment variables to files and loads them.
+func load(t *testing.T, yaml string) (config.Config, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	envPath := filepath.Join(dir, ".env")
+
+	require.NoError(t, os.WriteFile(yamlPath, []byte(yaml), 0o600))
+	require.NoError(t, os.WriteFile(envPath, []byte(testEnv), 0o600))
+
+	return config.Load(yamlPath, envPath)
+}
+
+func TestPoolUpstreamTLS(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+upstreamTLS:
+  caFile: "ca.pem"
+  certFile: "client.pem"
+  keyFile: "client.key"
+  serverName: "backend.internal"
+  insecureSkipVerify: true
+pools:
+  - name: "inherited"
+    backends: ["https://10.0.0.1"]
+  - name: "override"
+    backends: ["https://10.0.0.2"]
+    upstreamTLS:
+      serverName: "other.internal"
+      certFile: "other.pem"
+      keyFile: "other.key"
+      insecureSkipVerify: false
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.YAML.Pools, 2)
+
+	inherited := cfg.YAML.Pools[0].UpstreamTLS
+	assert.Equal(t, "ca.pem", inherited.CAFile)
+	assert.Equal(t, "backend.internal", inherited.ServerName)
+	assert.True(t, inherited.SkipVerify())
+
+	override := cfg.YAML.Pools[1].UpstreamTLS
+	assert.Equal(t, "ca.pem", override.CAFile, "unset fields are inherited")
+	assert.Equal(t, "other.internal", override.ServerName)
+	assert.Equal(t, "other.pem", override.CertFile)
+	assert.Equal(t, "other.key", override.KeyFile)
+	assert.False(t, override.SkipVerify(), "verification can be turned back on")
+}
+
+func TestClientAuth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tls  string
+		err  error
+	}{
+		{"without TLS", "tls:\n  clientAuth:\n    enabled: true\n", config.ErrInvalidTLS},
+		{"with proxy on HTTP port", "tls:\n  enabled: true\n  clientAuth:\n    enabled: true\n", config.ErrInvalidTLS},
+		{"with redirect", "tls:\n  enabled: true\n  redirectHTTP: true\n  clientAuth:\n    enabled: true\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := load(t, "backends: [\"http://10.0.0.1\"]\n"+tt.tls)
+			if tt.err == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestL4HealthCheck(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+backends: ["http://10.0.0.9"]
+l4:
+  listeners:
+    - {protocol: "udp", address: ":53", pool: "dns"}
+    - {protocol: "udp", address: ":5353", pool: "dns-checked"}
+    - {protocol: "tcp", address: ":5432", pool: "postgres"}
+  pools:
+    - name: "dns"
+      backends: ["10.0.0.1:53"]
+    - name: "dns-checked"
+      backends: ["10.0.0.2:53"]
+      healthCheck:
+        disabled: false
+    - name: "postgres"
+      backends: ["10.0.0.3:5432"]
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.YAML.L4.Pools, 3)
+
+	assert.True(t, cfg.YAML.L4.Pools[0].HealthCheck.IsDisabled(), "pools used only by udp aren't probed over tcp")
+	assert.False(t, cfg.YAML.L4.Pools[1].HealthCheck.IsDisabled())
+	assert.False(t, cfg.YAML.L4.Pools[2].HealthCheck.IsDisabled())
+}
+
+func TestPoolTransport(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+transport:
+  dialTimeout: 5s
+  responseHeaderTimeout: 10s
+pools:
+  - name: "inherited"
+    backends: ["http://10.0.0.1"]
+  - name: "unlimited"
+    backends: ["http://10.0.0.2"]
+    transport:
+      dialTimeout: 1s
+      responseHeaderTimeout: 0s
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.YAML.Pools, 2)
+
+	inherited := cfg.YAML.Pools[0].Transport
+	assert.Equal(t, time.Second*5, inherited.DialTimeout)
+	assert.Equal(t, time.Second*10, inherited.HeaderTimeout())
+	assert.Equal(t, time.Second, inherited.ExpectContinueTimeout, "defaults are applied to unset fields")
+
+	unlimited := cfg.YAML.Pools[1].Transport
+	assert.Equal(t, time.Second, unlimited.DialTimeout)
+	assert.Equal(t, time.Duration(0), unlimited.HeaderTimeout(), "a pool can turn off the limit")
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+backends: ["http://10.0.0.1"]
+server:
+  readHeaderTimeout: 2s
+  writeTimeout: 1m
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Second*2, cfg.YAML.Server.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, cfg.YAML.Server.WriteTimeout)
+	assert.Equal(t, time.Second*10, cfg.YAML.Server.ReadTimeout, "defaults are applied to unset fields")
+}
+
+func TestZeroValues(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := load(t, `backends: ["http://10.0.0.1"]`)
+		require.NoError(t, err)
+
+		assert.Equal(t, 5, *cfg.YAML.HealthCheck.Passive.MaxFailures)
+		assert.Equal(t, 5, *cfg.YAML.Pools[0].HealthCheck.Passive.MaxFailures)
+		assert.Equal(t, time.Second*10, *cfg.YAML.TLS.ReloadInterval)
+		assert.Equal(t, 10, *cfg.YAML.Upgrade.MaxPerClient)
+		assert.Equal(t, time.Minute*5, *cfg.YAML.Maintenance.RetryAfter)
+		assert.Equal(t, 10, *cfg.YAML.Compression.MaxDecompressedSizeMB)
+		assert.Equal(t, time.Minute, *cfg.YAML.GeoIP.ReloadInterval)
+		assert.True(t, *cfg.YAML.AccessLog.Enabled)
+		assert.True(t, *cfg.YAML.HTTP2.Enabled)
+	})
+
+	t.Run("top-level zeros", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := load(t, `
+backends: ["http://10.0.0.1"]
+healthCheck:
+  passive:
+    maxFailures: 0
+tls:
+  reloadInterval: 0s
+upgrade:
+  maxPerClient: 0
+maintenance:
+  retryAfter: 0s
+compression:
+  maxDecompressedSizeMB: 0
+geoIP:
+  reloadInterval: 0s
+accessLog:
+  enabled: false
+http2:
+  enabled: false
+`)
+		require.NoError(t, err)
+
+		assert.Equal(t, 0, *cfg.YAML.HealthCheck.Passive.MaxFailures)
+		assert.Equal(t, 0, *cfg.YAML.Pools[0].HealthCheck.Passive.MaxFailures)
+		assert.Equal(t, time.Duration(0), *cfg.YAML.TLS.ReloadInterval)
+		assert.Equal(t, 0, *cfg.YAML.Upgrade.MaxPerClient)
+		assert.Equal(t, time.Duration(0), *cfg.YAML.Maintenance.RetryAfter)
+		assert.Equal(t, 0, *cfg.YAML.Compression.MaxDecompressedSizeMB)
+		assert.Equal(t, time.Duration(0), *cfg.YAML.GeoIP.ReloadInterval)
+		assert.False(t, *cfg.YAML.AccessLog.Enabled)
+		assert.False(t, *cfg.YAML.HTTP2.Enabled)
+	})
+
+	t.Run("overridden by zeros", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := load(t, `
+pools:
+  - name: "unchecked"
+    backends: ["http://10.0.0.1"]
+    healthCheck:
+      passive:
+        maxFailures: 0
+routes:
+  - pathPrefix: "/upload"
+    pool: "unchecked"
+    compression:
+      maxDecompressedSizeMB: 0
+`)
+		require.NoError(t, err)
+		require.Len(t, cfg.YAML.Routes, 1)
+
+		assert.Equal(t, 0, *cfg.YAML.Pools[0].HealthCheck.Passive.MaxFailures)
+		assert.Equal(t, 0, *cfg.YAML.Routes[0].Compression.MaxDecompressedSizeMB)
+	})
+}
+
+func TestRouteCompression(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+backends: ["http://10.0.0.1"]
+compression:
+  level: 7
+  decompressRequests: true
+routes:
+  - pathPrefix: "/inherited"
+    pool: "default"
+    compression:
+      minSize: 100
+  - pathPrefix: "/raw"
+    pool: "default"
+    compression:
+      decompressRequests: false
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.YAML.Routes, 2)
+
+	inherited := cfg.YAML.Routes[0].Compression
+	assert.Equal(t, 7, inherited.Level)
+	assert.Equal(t, 100, inherited.MinSize)
+	assert.True(t, inherited.Decompress())
+
+	assert.False(t, cfg.YAML.Routes[1].Compression.Decompress(), "decompression can be turned off")
+}
+
+func TestDiscoveryDefaults(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := load(t, `
+pools:
+  - name: "k8s"
+    discovery:
+      type: "kubernetes"
+      interval: 10s
+      kubernetes:
+        namespace: "prod"
+        service: "api"
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.YAML.Pools, 1)
+
+	discovery := cfg.YAML.Pools[0].Discovery
+	require.NotNil(t, discovery)
+
+	assert.Equal(t, time.Second*10, discovery.Interval)
+	assert.Equal(t, "http", discovery.Scheme, "defaults are applied to unset fields")
+	assert.Equal(t, "prod", discovery.Kubernetes.Namespace)
+	assert.Equal(t, "https://kubernetes.default.svc", discovery.Kubernetes.Address)
+	assert.Equal(t, "/var/run/secrets/kubernetes.io/serviceaccount/token", discovery.Kubernetes.TokenFile)
+}
+
+func TestClusterSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := load(t, `
+backends: ["http://10.0.0.1"]
+cluster:
+  enabled: true
+  node: "a"
+  peers: ["b:7946"]
+`)
+	require.ErrorIs(t, err, config.ErrInvalidCluster, "gossip isn't allowed without CLUSTER_SECRET")
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// DiscoveryType is a source of backend addresses of a pool.
+type DiscoveryType string
+
+// A list of available discovery types.
+const (
+	DNSDiscoveryType        DiscoveryType = "dns"
+	FileDiscoveryType       DiscoveryType = "file"
+	ConsulDiscoveryType     DiscoveryType = "consul"
+	KubernetesDiscoveryType DiscoveryType = "kubernetes"
+)
+
+// DNSRecordType is a type of DNS records, that contain backend addresses.
+type DNSRecordType string
+
+// A list of available DNS record types.
+const (
+	ARecord    DNSRecordType = "A"
+	AAAARecord DNSRecordType = "AAAA"
+	SRVRecord  DNSRecordType = "SRV"
+)
+
+// ErrInvalidDiscovery is returned when discovery configuration is invalid.
+var ErrInvalidDiscovery = errors.New("invalid discovery")
+
+// DNSDiscovery contains settings of discovering backends by DNS records.
+type DNSDiscovery struct {
+	// Name is a fully qualified domain name, search domains aren't applied.
+	Name       string        `yaml:"name"`
+	RecordType DNSRecordType `env-default:"A" yaml:"recordType"`
+	// Port of backends, it's required for A and AAAA records, SRV records contain ports.
+	Port int `yaml:"port"`
+	// Server is "host:port" of a DNS server, the first nameserver of /etc/resolv.conf is used if it's empty.
+	Server string `yaml:"server"`
+}
+
+// FileDiscovery contains settings of reading backends from a file. The file is read again every interval,
+// its changes aren't watched.
+type FileDiscovery struct {
+	// Path of a JSON or YAML list of backend URLs.
+	Path string `yaml:"path"`
+}
+
+// ConsulDiscovery contains settings of discovering healthy instances of a Consul service.
+type ConsulDiscovery struct {
+	Address    string `env-default:"http://127.0.0.1:8500" yaml:"address"`
+	Service    string `yaml:"service"`
+	Tag        string `yaml:"tag"`
+	Datacenter string `yaml:"datacenter"`
+	Token      string `yaml:"token"`
+}
+
+// KubernetesDiscovery contains settings of discovering ready addresses of Kubernetes service endpoints.
+// Defaults are suitable for running inside the cluster with a service account.
+type KubernetesDiscovery struct {
+	Address   string `env-default:"https://kubernetes.default.svc" yaml:"address"`
+	Namespace string `env-default:"default"                        yaml:"namespace"`
+	Service   string `yaml:"service"`
+	// PortName selects a port of the endpoints, the first port is used if it's empty.
+	PortName  string `yaml:"portName"`
+	TokenFile string `env-default:"/var/run/secrets/kubernetes.io/serviceaccount/token"  yaml:"tokenFile"`
+	CAFile    string `env-default:"/var/run/secrets/kubernetes.io/serviceaccount/ca.crt" yaml:"caFile"`
+}
+
+// Discovery contains settings of updating backends of a pool from an external source.
+// Backends, that are still discovered, keep their connections and health.
+type Discovery struct {
+	Type DiscoveryType `yaml:"type"`
+	// Interval between discoveries, DNS records are resolved again earlier, when their TTL is shorter.
+	Interval time.Duration `env-default:"30s" yaml:"interval"`
+	// Scheme of discovered backends, files contain full URLs.
+	Scheme     string              `env-default:"http" yaml:"scheme"`
+	DNS        DNSDiscovery        `yaml:"dns"`
+	File       FileDiscovery       `yaml:"file"`
+	Consul     ConsulDiscovery     `yaml:"consul"`
+	Kubernetes KubernetesDiscovery `yaml:"kubernetes"`
+}
+
+// applyDefaults fills unset fields from their env-default tags. Discoveries of pools aren't reached by cleanenv,
+// when the config is read, because pools are a list.
+func (d *Discovery) applyDefaults() error {
+	if err := cleanenv.ReadEnv(d); err != nil {
+		return fmt.Errorf("error applying discovery defaults: %w", err)
+	}
+
+	return nil
+}
+
+func (d *Discovery) validate() error {
+	switch d.Type {
+	case DNSDiscoveryType:
+		return d.DNS.validate()
+	case FileDiscoveryType:
+		if d.File.Path == "" {
+			return fmt.Errorf("%w: file path is required", ErrInvalidDiscovery)
+		}
+	case ConsulDiscoveryType:
+		if d.Consul.Service == "" {
+			return fmt.Errorf("%w: consul service is required", ErrInvalidDiscovery)
+		}
+	case KubernetesDiscoveryType:
+		if d.Kubernetes.Service == "" {
+			return fmt.Errorf("%w: kubernetes service is required", ErrInvalidDiscovery)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidDiscovery, d.Type)
+	}
+
+	return nil
+}
+
+func (d *DNSDiscovery) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("%w: dns name is required", ErrInvalidDiscovery)
+	}
+
+	switch d.RecordType {
+	case ARecord, AAAARecord:
+		if d.Port <= 0 {
+			return fmt.Errorf("%w: dns port is required for %s records", ErrInvalidDiscovery, d.RecordType)
+		}
+	case SRVRecord:
+	default:
+		return fmt.Errorf("%w: unknown dns record type %q", ErrInvalidDiscovery, d.RecordType)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// L4Protocol is a transport protocol of a layer-4 listener.
+type L4Protocol string
+
+// A list of available layer-4 protocols.
+const (
+	TCPProtocol L4Protocol = "tcp"
+	UDPProtocol L4Protocol = "udp"
+)
+
+const (
+	defaultL4DialTimeout  = time.Second * 5
+	defaultTCPIdleTimeout = time.Hour
+	defaultUDPIdleTimeout = time.Minute
+)
+
+// ErrInvalidL4 is returned when layer-4 listener or pool config is invalid.
+var ErrInvalidL4 = errors.New("invalid layer-4 config")
+
+// L4HealthCheck contains configuration for TCP connect health checks.
+type L4HealthCheck struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// Disabled turns off health checks, e.g. for UDP services without a TCP port.
+	// Checks of pools used only by UDP listeners are disabled, unless it's set to false.
+	Disabled *bool `yaml:"disabled"`
+}
+
+// IsDisabled returns true if health checks of the pool are turned off.
+func (h L4HealthCheck) IsDisabled() bool {
+	return h.Disabled != nil && *h.Disabled
+}
+
+// L4Pool contains configuration for a named group of TCP or UDP backends.
+// Unset fields are inherited from the top-level sections of the config.
+type L4Pool struct {
+	Name string `yaml:"name"`
+	// Backends are "host:port" addresses.
+	Backends    []string      `yaml:"backends"`
+	Balancer    Balancer      `yaml:"balancer"`
+	HealthCheck L4HealthCheck `yaml:"healthCheck"`
+	// RateLimit limits new connections (or UDP sessions) per source IP,
+	// pools without it use own limiters with the global settings.
+	RateLimit *RateLimit `yaml:"rateLimit"`
+}
+
+// L4Listener contains configuration for a TCP or UDP listener, that proxies everything to the pool.
+type L4Listener struct {
+	Name     string     `yaml:"name"`
+	Protocol L4Protocol `yaml:"protocol"`
+	Address  string     `yaml:"address"`
+	Pool     string     `yaml:"pool"`
+	// DialTimeout limits connecting to TCP backends.
+	DialTimeout time.Duration `yaml:"dialTimeout"`
+	// IdleTimeout closes TCP connections and UDP sessions without traffic.
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+}
+
+// L4 contains configuration for layer-4 load balancing.
+type L4 struct {
+	Listeners []L4Listener `yaml:"listeners"`
+	Pools     []L4Pool     `yaml:"pools"`
+}
+
+func (c *configYAML) applyL4Defaults() {
+	protocols := make(map[string][]L4Protocol, len(c.L4.Pools))
+	for _, l := range c.L4.Listeners {
+		protocols[l.Pool] = append(protocols[l.Pool], l.Protocol)
+	}
+
+	for i := range c.L4.Pools {
+		p := &c.L4.Pools[i]
+
+		if p.Balancer.Type == "" {
+			p.Balancer.Type = c.Balancer.Type
+		}
+
+		if p.Balancer.BackendsCheckInterval == 0 {
+			p.Balancer.BackendsCheckInterval = c.Balancer.BackendsCheckInterval
+		}
+
+		if p.HealthCheck.Timeout == 0 {
+			p.HealthCheck.Timeout = c.HealthCheck.Timeout
+		}
+
+		// UDP services often don't listen on TCP, so the TCP probe would eject all their backends
+		if p.HealthCheck.Disabled == nil {
+			udpOnly := len(protocols[p.Name]) > 0 && !slices.Contains(protocols[p.Name], TCPProtocol)
+			p.HealthCheck.Disabled = &udpOnly
+		}
+
+		if p.RateLimit == nil {
+			p.RateLimit = &RateLimit{}
+		}
+
+		p.RateLimit.applyDefaults(c.RateLimit)
+	}
+
+	for i := range c.L4.Listeners {
+		l := &c.L4.Listeners[i]
+
+		if l.DialTimeout == 0 {
+			l.DialTimeout = defaultL4DialTimeout
+		}
+
+		if l.IdleTimeout == 0 {
+			l.IdleTimeout = defaultTCPIdleTimeout
+			if l.Protocol == UDPProtocol {
+				l.IdleTimeout = defaultUDPIdleTimeout
+			}
+		}
+	}
+}
+
+func (c *configYAML) validateL4() error {
+	names := make(map[string]struct{}, len(c.Pools)+len(c.L4.Pools))
+
+	// names of HTTP pools are already validated, they share the namespace in the admin API
+	for _, p := range c.Pools {
+		names[p.Name] = struct{}{}
+	}
+
+	for _, p := range c.L4.Pools {
+		if p.Name == "" {
+			return fmt.Errorf("%w: pool name is required", ErrInvalidL4)
+		}
+
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("%w: duplicate pool name %q", ErrInvalidL4, p.Name)
+		}
+
+		if len(p.Backends) == 0 {
+			return fmt.Errorf("%w: pool %q has no backends", ErrInvalidL4, p.Name)
+		}
+
+		switch p.Balancer.Type {
+		case LeastConnectionsType, RandomType, RoundRobinType:
+		default:
+			return fmt.Errorf("%w: pool %q has unknown balancer type %q", ErrInvalidL4, p.Name, p.Balancer.Type)
+		}
+
+		switch p.RateLimit.Type {
+		case TokenBucketType, LeakyBucketType:
+		default:
+			return fmt.Errorf("%w: pool %q has unknown rate limiter type %q", ErrInvalidL4, p.Name, p.RateLimit.Type)
+		}
+
+		names[p.Name] = struct{}{}
+	}
+
+	l4Pools := make(map[string]struct{}, len(c.L4.Pools))
+	for _, p := range c.L4.Pools {
+		l4Pools[p.Name] = struct{}{}
+	}
+
+	for i, l := range c.L4.Listeners {
+		switch l.Protocol {
+		case TCPProtocol, UDPProtocol:
+		default:
+			return fmt.Errorf("%w: listener #%d has unknown protocol %q", ErrInvalidL4, i+1, l.Protocol)
+		}
+
+		if l.Address == "" {
+			return fmt.Errorf("%w: listener #%d has no address", ErrInvalidL4, i+1)
+		}
+
+		if _, ok := l4Pools[l.Pool]; !ok {
+			return fmt.Errorf("%w: listener #%d refers to unknown pool %q", ErrInvalidL4, i+1, l.Pool)
+		}
+	}
+
+	return nil
+}
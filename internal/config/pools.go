@@ -0,0 +1,511 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultPoolName is a name of the pool created from top-level backends.
+const DefaultPoolName = "default"
+
+var (
+	// ErrNoPools is returned when neither backends nor pools are configured.
+	ErrNoPools = errors.New("no backends or pools configured")
+	// ErrInvalidPool is returned when pool configuration is invalid.
+	ErrInvalidPool = errors.New("invalid pool")
+	// ErrInvalidRoute is returned when route configuration is invalid.
+	ErrInvalidRoute = errors.New("invalid route")
+	// ErrInvalidConcurrencyLimit is returned when concurrency limit configuration is invalid.
+	ErrInvalidConcurrencyLimit = errors.New("invalid concurrency limit")
+)
+
+// HealthCheck contains configuration for active health checks of backends.
+type HealthCheck struct {
+	Path    string        `env-default:"/health" yaml:"path"`
+	Timeout time.Duration `env-default:"5s"      yaml:"timeout"`
+	// Service is checked by grpc.health.v1 in pools with "grpc" protocol, empty checks the whole server.
+	Service string        `yaml:"service"`
+	Passive PassiveHealth `yaml:"passive"`
+}
+
+// PassiveHealth contains settings of ejecting backends after failed proxied requests.
+type PassiveHealth struct {
+	// MaxFailures is the amount of consecutive dial, timeout, TLS or connection errors, 0 disables ejection.
+	MaxFailures   *int          `yaml:"maxFailures"`
+	EjectDuration time.Duration `env-default:"30s" yaml:"ejectDuration"`
+}
+
+// UpstreamTLS contains settings of TLS connections to https:// backends.
+type UpstreamTLS struct {
+	CAFile     string `yaml:"caFile"`   // PEM bundle, system roots are used if empty
+	CertFile   string `yaml:"certFile"` // client certificate for mTLS
+	KeyFile    string `yaml:"keyFile"`
+	ServerName string `yaml:"serverName"` // overrides SNI and verified name
+	// InsecureSkipVerify is a pointer, so a pool can turn verification back on with false.
+	InsecureSkipVerify *bool `yaml:"insecureSkipVerify"`
+}
+
+// SkipVerify returns true if verification of backend certificates is disabled.
+func (t *UpstreamTLS) SkipVerify() bool {
+	return t.InsecureSkipVerify != nil && *t.InsecureSkipVerify
+}
+
+func (t *UpstreamTLS) applyDefaults(parent UpstreamTLS) {
+	if t.CAFile == "" {
+		t.CAFile = parent.CAFile
+	}
+
+	// the certificate and the key are inherited together, so they always match
+	if t.CertFile == "" && t.KeyFile == "" {
+		t.CertFile = parent.CertFile
+		t.KeyFile = parent.KeyFile
+	}
+
+	if t.ServerName == "" {
+		t.ServerName = parent.ServerName
+	}
+
+	if t.InsecureSkipVerify == nil {
+		t.InsecureSkipVerify = parent.InsecureSkipVerify
+	}
+}
+
+// Transport contains settings of connections to backends of a pool.
+type Transport struct {
+	DialTimeout time.Duration `env-default:"30s" yaml:"dialTimeout"`
+	KeepAlive   time.Duration `env-default:"30s" yaml:"keepAlive"`
+	// MaxIdleConnsPerHost is the amount of kept idle connections to every backend.
+	MaxIdleConnsPerHost int           `env-default:"32"  yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout     time.Duration `env-default:"90s" yaml:"idleConnTimeout"`
+	// ResponseHeaderTimeout limits waiting for response headers after the request is sent, 0 means no limit.
+	// It's a pointer, so a pool can turn off the limit of the top-level section with 0.
+	ResponseHeaderTimeout *time.Duration `yaml:"responseHeaderTimeout"`
+	ExpectContinueTimeout time.Duration  `env-default:"1s" yaml:"expectContinueTimeout"`
+}
+
+// HeaderTimeout returns the limit of waiting for response headers, 0 means no limit.
+func (t *Transport) HeaderTimeout() time.Duration {
+	if t.ResponseHeaderTimeout == nil {
+		return 0
+	}
+
+	return *t.ResponseHeaderTimeout
+}
+
+func (t *Transport) applyDefaults(parent Transport) {
+	if t.DialTimeout == 0 {
+		t.DialTimeout = parent.DialTimeout
+	}
+
+	if t.KeepAlive == 0 {
+		t.KeepAlive = parent.KeepAlive
+	}
+
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = parent.MaxIdleConnsPerHost
+	}
+
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = parent.IdleConnTimeout
+	}
+
+	if t.ResponseHeaderTimeout == nil {
+		t.ResponseHeaderTimeout = parent.ResponseHeaderTimeout
+	}
+
+	if t.ExpectContinueTimeout == 0 {
+		t.ExpectContinueTimeout = parent.ExpectContinueTimeout
+	}
+}
+
+// UpstreamProtocol is an HTTP protocol used for connections to backends.
+type UpstreamProtocol string
+
+// A list of available upstream protocols.
+const (
+	// AutoUpstreamProtocol uses HTTP/1.1 for http:// backends and negotiates HTTP/2 with https:// backends.
+	AutoUpstreamProtocol UpstreamProtocol = "auto"
+	// HTTP1UpstreamProtocol always uses HTTP/1.1.
+	HTTP1UpstreamProtocol UpstreamProtocol = "http1"
+	// HTTP2UpstreamProtocol always uses HTTP/2: h2 with https:// backends and h2c with http:// backends.
+	HTTP2UpstreamProtocol UpstreamProtocol = "http2"
+	// GRPCUpstreamProtocol uses HTTP/2 like HTTP2UpstreamProtocol and checks health with grpc.health.v1.
+	GRPCUpstreamProtocol UpstreamProtocol = "grpc"
+)
+
+// Pool contains configuration for a named group of backends.
+// Unset fields are inherited from the top-level sections of the config.
+type Pool struct {
+	Name        string           `yaml:"name"`
+	Backends    []string         `yaml:"backends"`
+	Balancer    Balancer         `yaml:"balancer"`
+	HealthCheck HealthCheck      `yaml:"healthCheck"`
+	UpstreamTLS *UpstreamTLS     `yaml:"upstreamTLS"`
+	Protocol    UpstreamProtocol `yaml:"protocol"`
+	Transport   Transport        `yaml:"transport"`
+	// RateLimit is a rate limit policy of the pool, the global rate limiter is used if it's not set.
+	RateLimit *RateLimit `yaml:"rateLimit"`
+	// ConcurrencyLimit limits requests to backends of the pool in addition to the global limit,
+	// unset fields are inherited from the global one.
+	ConcurrencyLimit *ConcurrencyLimit `yaml:"concurrencyLimit"`
+	// Queue overrides the global queue settings, unset fields are inherited.
+	Queue *Queue `yaml:"queue"`
+	// Discovery updates backends of the pool, configured backends are used until the first discovery.
+	Discovery *Discovery `yaml:"discovery"`
+}
+
+// HeaderRewrite contains header modifications, applied in order: remove, set, add.
+// Values are text/template strings over rewrite.Vars, e.g. "{{.ClientIP}}" or "{{.RequestID}}".
+type HeaderRewrite struct {
+	Add    map[string]string `yaml:"add"`
+	Set    map[string]string `yaml:"set"`
+	Remove []string          `yaml:"remove"`
+}
+
+// PathRewrite replaces matches of the regular expression in the request path.
+type PathRewrite struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"` // may contain $1-style references
+}
+
+// Rewrite contains request and response rewriting rules of a route.
+// The path is rewritten in order: strip prefix, regex rewrites, add prefix.
+type Rewrite struct {
+	RequestHeaders  HeaderRewrite `yaml:"requestHeaders"`
+	ResponseHeaders HeaderRewrite `yaml:"responseHeaders"`
+	StripPrefix     string        `yaml:"stripPrefix"`
+	AddPrefix       string        `yaml:"addPrefix"`
+	Paths           []PathRewrite `yaml:"paths"`
+	// PreserveHost sends the original Host header instead of the backend host.
+	PreserveHost bool `yaml:"preserveHost"`
+}
+
+// Redirect makes the load balancer respond with a redirect instead of proxying.
+type Redirect struct {
+	Location string `yaml:"location"` // text/template string, e.g. "https://{{.Host}}{{.Path}}"
+	Status   int    `yaml:"status"`   // 301, 302, 303, 307 or 308, 302 by default
+}
+
+// Coalesce contains settings of sharing responses between identical concurrent GET requests of a route.
+type Coalesce struct {
+	Enabled bool `yaml:"enabled"`
+	// VaryHeaders must be equal in requests sharing a response, empty uses Accept, Accept-Encoding and Accept-Language.
+	VaryHeaders []string `yaml:"varyHeaders"`
+	// MaxSizeKB limits a shared response body, requests with larger responses are sent separately.
+	MaxSizeKB int `yaml:"maxSizeKB"`
+}
+
+// AccessRules contains allowed and denied clients of a route. Denied IPs are checked first, then allowed IPs,
+// denied and allowed countries. When allow rules are set, other clients are denied.
+type AccessRules struct {
+	Allow []string `yaml:"allow"` // IPs and CIDRs
+	Deny  []string `yaml:"deny"`
+	// AllowCountries and DenyCountries are ISO 3166-1 alpha-2 codes, they require the geo database.
+	AllowCountries []string `yaml:"allowCountries"`
+	DenyCountries  []string `yaml:"denyCountries"`
+}
+
+// Route maps requests to a pool. All set matchers must match the request.
+type Route struct {
+	Host       string            `yaml:"host"` // exact host or "*.example.com"
+	PathPrefix string            `yaml:"pathPrefix"`
+	Methods    []string          `yaml:"methods"`
+	Headers    map[string]string `yaml:"headers"`
+	Pool       string            `yaml:"pool"`
+	Rewrite    Rewrite           `yaml:"rewrite"`
+	Access     AccessRules       `yaml:"access"`
+	// Priority of requests is "low", "normal" or "high", lower priorities are shed first by concurrency limits.
+	Priority RequestPriority `yaml:"priority"`
+	// Timeout is a deadline of the whole request to the backend, 0 means no limit.
+	Timeout time.Duration `yaml:"timeout"`
+	// Cache stores responses of GET requests, according to their Cache-Control headers.
+	Cache    bool     `yaml:"cache"`
+	Coalesce Coalesce `yaml:"coalesce"`
+	// Compression overrides global compression settings, unset fields are inherited.
+	Compression *Compression `yaml:"compression"`
+	// Redirect is used instead of the pool, when it's set.
+	Redirect *Redirect `yaml:"redirect"`
+}
+
+// applyPoolDefaults creates the default pool and route from top-level settings if they are missing
+// and fills unset pool fields.
+func (c *configYAML) applyPoolDefaults() error {
+	if len(c.Pools) == 0 && (len(c.Backends) > 0 || c.Discovery != nil) {
+		c.Pools = []Pool{{
+			Name:      DefaultPoolName,
+			Backends:  c.Backends,
+			Discovery: c.Discovery,
+		}}
+	}
+
+	for i := range c.Pools {
+		p := &c.Pools[i]
+
+		if p.Balancer.Type == "" {
+			p.Balancer.Type = c.Balancer.Type
+		}
+
+		if p.Balancer.BackendsCheckInterval == 0 {
+			p.Balancer.BackendsCheckInterval = c.Balancer.BackendsCheckInterval
+		}
+
+		if p.Balancer.MaxConnections == 0 {
+			p.Balancer.MaxConnections = c.Balancer.MaxConnections
+		}
+
+		if p.Balancer.SlowStart == 0 {
+			p.Balancer.SlowStart = c.Balancer.SlowStart
+		}
+
+		if p.HealthCheck.Path == "" {
+			p.HealthCheck.Path = c.HealthCheck.Path
+		}
+
+		if p.HealthCheck.Timeout == 0 {
+			p.HealthCheck.Timeout = c.HealthCheck.Timeout
+		}
+
+		if p.HealthCheck.Passive.MaxFailures == nil {
+			p.HealthCheck.Passive.MaxFailures = c.HealthCheck.Passive.MaxFailures
+		}
+
+		if p.HealthCheck.Passive.EjectDuration == 0 {
+			p.HealthCheck.Passive.EjectDuration = c.HealthCheck.Passive.EjectDuration
+		}
+
+		if p.UpstreamTLS == nil {
+			p.UpstreamTLS = &UpstreamTLS{}
+		}
+
+		p.UpstreamTLS.applyDefaults(c.UpstreamTLS)
+
+		p.Transport.applyDefaults(c.Transport)
+
+		if p.Protocol == "" {
+			p.Protocol = c.UpstreamProtocol
+		}
+
+		if p.RateLimit != nil {
+			p.RateLimit.applyDefaults(c.RateLimit)
+		}
+
+		if p.ConcurrencyLimit != nil {
+			p.ConcurrencyLimit.applyDefaults(c.ConcurrencyLimit)
+		}
+
+		if p.Queue == nil {
+			p.Queue = &c.Queue
+		} else {
+			p.Queue.applyDefaults(c.Queue)
+		}
+
+		if p.Discovery != nil {
+			if err := p.Discovery.applyDefaults(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(c.Routes) == 0 && len(c.Pools) > 0 {
+		c.Routes = []Route{{Pool: c.Pools[0].Name}}
+	}
+
+	for i := range c.Routes {
+		r := &c.Routes[i]
+
+		if r.Priority == "" {
+			r.Priority = NormalPriority
+		}
+
+		if r.Compression == nil {
+			r.Compression = &c.Compression
+			continue
+		}
+
+		r.Compression.applyDefaults(c.Compression)
+	}
+
+	return nil
+}
+
+func (cp *Compression) applyDefaults(parent Compression) {
+	if cp.Level == 0 {
+		cp.Level = parent.Level
+	}
+
+	if cp.MinSize == 0 {
+		cp.MinSize = parent.MinSize
+	}
+
+	if len(cp.ContentTypes) == 0 {
+		cp.ContentTypes = parent.ContentTypes
+	}
+
+	if cp.DecompressRequests == nil {
+		cp.DecompressRequests = parent.DecompressRequests
+	}
+
+	if cp.MaxDecompressedSizeMB == nil {
+		cp.MaxDecompressedSizeMB = parent.MaxDecompressedSizeMB
+	}
+}
+
+// Decompress returns true if request bodies are decoded before they are sent to backends.
+func (cp *Compression) Decompress() bool {
+	return cp.DecompressRequests != nil && *cp.DecompressRequests
+}
+
+func (cl *ConcurrencyLimit) applyDefaults(parent ConcurrencyLimit) {
+	if cl.Type == "" {
+		cl.Type = parent.Type
+	}
+
+	if cl.InitialLimit == 0 {
+		cl.InitialLimit = parent.InitialLimit
+	}
+
+	if cl.MinLimit == 0 {
+		cl.MinLimit = parent.MinLimit
+	}
+
+	if cl.MaxLimit == 0 {
+		cl.MaxLimit = parent.MaxLimit
+	}
+
+	if cl.Timeout == 0 {
+		cl.Timeout = parent.Timeout
+	}
+
+	if cl.RetryAfter == 0 {
+		cl.RetryAfter = parent.RetryAfter
+	}
+}
+
+func (q *Queue) applyDefaults(parent Queue) {
+	if q.MaxSize == 0 {
+		q.MaxSize = parent.MaxSize
+	}
+
+	if q.MaxWait == 0 {
+		q.MaxWait = parent.MaxWait
+	}
+
+	if q.PriorityHeader == "" {
+		q.PriorityHeader = parent.PriorityHeader
+	}
+
+	if q.ClientPriorities == nil {
+		q.ClientPriorities = parent.ClientPriorities
+	}
+}
+
+func (rl *RateLimit) applyDefaults(parent RateLimit) {
+	if rl.Type == "" {
+		rl.Type = parent.Type
+	}
+
+	if rl.Capacity == 0 {
+		rl.Capacity = parent.Capacity
+	}
+
+	if rl.TokenRate == 0 {
+		rl.TokenRate = parent.TokenRate
+	}
+
+	if rl.TokenInterval == 0 {
+		rl.TokenInterval = parent.TokenInterval
+	}
+}
+
+func (cl *ConcurrencyLimit) validate() error {
+	switch cl.Type {
+	case AIMDConcurrencyLimit, GradientConcurrencyLimit:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidConcurrencyLimit, cl.Type)
+	}
+
+	if cl.MinLimit < 1 || cl.MaxLimit < cl.MinLimit {
+		return fmt.Errorf("%w: limits must be 1 <= minLimit <= maxLimit", ErrInvalidConcurrencyLimit)
+	}
+
+	return nil
+}
+
+func (c *configYAML) validatePools() error {
+	if len(c.Pools) == 0 {
+		return ErrNoPools
+	}
+
+	names := make(map[string]struct{}, len(c.Pools))
+
+	for _, p := range c.Pools {
+		if p.Name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidPool)
+		}
+
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidPool, p.Name)
+		}
+
+		if len(p.Backends) == 0 && p.Discovery == nil {
+			return fmt.Errorf("%w: %q has no backends", ErrInvalidPool, p.Name)
+		}
+
+		if p.Discovery != nil {
+			if err := p.Discovery.validate(); err != nil {
+				return fmt.Errorf("%w: %q has %w", ErrInvalidPool, p.Name, err)
+			}
+		}
+
+		switch p.Balancer.Type {
+		case LeastConnectionsType, RandomType, RoundRobinType:
+		default:
+			return fmt.Errorf("%w: %q has unknown balancer type %q", ErrInvalidPool, p.Name, p.Balancer.Type)
+		}
+
+		switch p.Protocol {
+		case AutoUpstreamProtocol, HTTP1UpstreamProtocol, HTTP2UpstreamProtocol, GRPCUpstreamProtocol:
+		default:
+			return fmt.Errorf("%w: %q has unknown protocol %q", ErrInvalidPool, p.Name, p.Protocol)
+		}
+
+		if p.RateLimit != nil {
+			switch p.RateLimit.Type {
+			case TokenBucketType, LeakyBucketType:
+			default:
+				return fmt.Errorf("%w: %q has unknown rate limiter type %q", ErrInvalidPool, p.Name, p.RateLimit.Type)
+			}
+		}
+
+		if p.ConcurrencyLimit != nil {
+			if err := p.ConcurrencyLimit.validate(); err != nil {
+				return fmt.Errorf("%w: %q has %w", ErrInvalidPool, p.Name, err)
+			}
+		}
+
+		names[p.Name] = struct{}{}
+	}
+
+	if err := c.ConcurrencyLimit.validate(); err != nil {
+		return err
+	}
+
+	for i, r := range c.Routes {
+		if r.Redirect != nil {
+			continue
+		}
+
+		switch r.Priority {
+		case LowPriority, NormalPriority, HighPriority:
+		default:
+			return fmt.Errorf("%w: route #%d has unknown priority %q", ErrInvalidRoute, i+1, r.Priority)
+		}
+
+		if _, ok := names[r.Pool]; !ok {
+			return fmt.Errorf("%w: route #%d refers to unknown pool %q", ErrInvalidRoute, i+1, r.Pool)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ConsulOptions contains settings of the Consul provider.
+type ConsulOptions struct {
+	// Address of the Consul HTTP API, e.g. "http://127.0.0.1:8500".
+	Address    string
+	Service    string
+	Tag        string
+	Datacenter string
+	Token      string
+	Scheme     string
+	// Client is used for requests to the API, http.DefaultClient if it's nil.
+	Client *http.Client
+}
+
+// Consul finds instances of a service, that pass Consul health checks.
+type Consul struct {
+	opts ConsulOptions
+}
+
+// consulEntry is a part of an entry of /v1/health/service response.
+type consulEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// NewConsul creates a Consul provider.
+func NewConsul(opts ConsulOptions) *Consul {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	return &Consul{opts: opts}
+}
+
+// Discover implements Provider.
+func (c *Consul) Discover(ctx context.Context) (Result, error) {
+	query := url.Values{"passing": {"true"}}
+
+	if c.opts.Tag != "" {
+		query.Set("tag", c.opts.Tag)
+	}
+
+	if c.opts.Datacenter != "" {
+		query.Set("dc", c.opts.Datacenter)
+	}
+
+	endpoint := c.opts.Address + "/v1/health/service/" + url.PathEscape(c.opts.Service) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("error creating consul request: %w", err)
+	}
+
+	if c.opts.Token != "" {
+		req.Header.Set("X-Consul-Token", c.opts.Token)
+	}
+
+	var entries []consulEntry
+	if err := getJSON(c.opts.Client, req, &entries); err != nil {
+		return Result{}, fmt.Errorf("error getting consul service %q: %w", c.opts.Service, err)
+	}
+
+	res := Result{URLs: make([]string, 0, len(entries))}
+
+	for _, e := range entries {
+		// service address is empty, when the service uses the address of its node
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+
+		res.URLs = append(res.URLs, backendURL(c.opts.Scheme, host, e.Service.Port))
+	}
+
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package discovery_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/discovery"
+)
+
+func TestConsul(t *testing.T) {
+	t.Parallel()
+
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/api" || r.Header.Get("X-Consul-Token") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+
+		assert.Equal(t, "true", r.URL.Query().Get("passing"))
+		assert.Equal(t, "v2", r.URL.Query().Get("tag"))
+		assert.Equal(t, "dc1", r.URL.Query().Get("dc"))
+
+		w.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck
+		w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8080}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2", "Port": 9090}}
+		]`))
+	}))
+	t.Cleanup(consul.Close)
+
+	opts := discovery.ConsulOptions{
+		Address:    consul.URL,
+		Service:    "api",
+		Tag:        "v2",
+		Datacenter: "dc1",
+		Token:      "secret",
+		Scheme:     "http",
+	}
+
+	res, err := discovery.NewConsul(opts).Discover(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:8080", "http://10.1.0.2:9090"}, res.URLs)
+
+	opts.Service = "unknown"
+
+	_, err = discovery.NewConsul(opts).Discover(t.Context())
+	require.ErrorIs(t, err, discovery.ErrUnexpectedStatus)
+}
@@ -0,0 +1,157 @@
+// Package discovery contains providers, that find backends of a pool in external sources,
+// and a watcher, that refreshes them periodically.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.DiscoveryComponent)
+
+// ErrUnexpectedStatus is returned when an HTTP API responds with a non-200 status.
+var ErrUnexpectedStatus = errors.New("unexpected status code")
+
+// minRefreshInterval limits refreshes of records with short TTL and retries of watchers without backends.
+const minRefreshInterval = time.Second
+
+// Result contains discovered backends.
+type Result struct {
+	// URLs of backends, e.g. "http://10.0.0.1:8080".
+	URLs []string
+	// TTL is a time, for which the result is valid, 0 means the refresh interval of the watcher is used.
+	TTL time.Duration
+}
+
+// Provider finds backends in an external source.
+type Provider interface {
+	Discover(ctx context.Context) (Result, error)
+}
+
+// WatcherOptions contains settings of the watcher.
+type WatcherOptions struct {
+	// Name identifies the watcher in logs, e.g. pool name.
+	Name string
+	// Interval between refreshes, a shorter TTL of the result is used instead.
+	Interval time.Duration
+	// Update is called with sorted URLs of backends, when they change.
+	Update func(urls []string)
+}
+
+// Watcher refreshes backends from the provider and reports their changes.
+type Watcher struct {
+	provider Provider
+	opts     WatcherOptions
+	current  []string
+	next     time.Duration
+}
+
+// NewWatcher creates a new watcher, current are the backends, that are used before the first refresh.
+func NewWatcher(provider Provider, current []string, opts WatcherOptions) *Watcher {
+	current = slices.Clone(current)
+	slices.Sort(current)
+
+	return &Watcher{
+		provider: provider,
+		opts:     opts,
+		current:  slices.Compact(current),
+		next:     opts.Interval,
+	}
+}
+
+// Refresh discovers backends once and calls update, if they have changed.
+// Errors and empty results are logged and the previous backends are kept.
+// Without backends, e.g. after a failed first discovery, the next refresh happens sooner.
+func (w *Watcher) Refresh(ctx context.Context) {
+	w.next = w.opts.Interval
+
+	res, err := w.provider.Discover(ctx)
+	if err != nil {
+		logger.Error("failed to discover backends", slog.String("name", w.opts.Name), slog.Any("error", err))
+
+		if len(w.current) == 0 {
+			w.next = min(w.next, minRefreshInterval)
+		}
+
+		return
+	}
+
+	if res.TTL > 0 && res.TTL < w.next {
+		w.next = max(res.TTL, minRefreshInterval)
+	}
+
+	// an empty result is more likely a failure of the source, than a pool without backends
+	if len(res.URLs) == 0 {
+		logger.Warn("no backends discovered, previous backends are kept", slog.String("name", w.opts.Name))
+		return
+	}
+
+	urls := slices.Clone(res.URLs)
+	slices.Sort(urls)
+	urls = slices.Compact(urls)
+
+	if slices.Equal(urls, w.current) {
+		return
+	}
+
+	logger.Info("discovered backends changed",
+		slog.String("name", w.opts.Name),
+		slog.Any("backends", urls),
+	)
+
+	w.current = urls
+	w.opts.Update(urls)
+}
+
+// Run refreshes backends until ctx is done, the first refresh happens after the interval
+// or TTL of the previous one.
+func (w *Watcher) Run(ctx context.Context) {
+	timer := time.NewTimer(w.next)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			w.Refresh(ctx)
+			timer.Reset(w.next)
+		}
+	}
+}
+
+// backendURL joins the scheme, host and port into a backend URL.
+func backendURL(scheme, host string, port int) string {
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// getJSON sends the request of an HTTP API provider and decodes the JSON response into v.
+func getJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/discovery"
+)
+
+var errSource = errors.New("source is unavailable")
+
+// stubProvider returns results from the list, then repeats the last one.
+type stubProvider struct {
+	results []discovery.Result
+	errs    []error
+	calls   int
+}
+
+func (s *stubProvider) Discover(_ context.Context) (discovery.Result, error) {
+	i := min(s.calls, len(s.results)-1)
+	s.calls++
+
+	return s.results[i], s.errs[i]
+}
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	provider := &stubProvider{
+		results: []discovery.Result{
+			{URLs: []string{"http://b:80", "http://a:80", "http://a:80"}},
+			{URLs: []string{"http://a:80", "http://b:80"}},
+			{},
+			{},
+			{URLs: []string{"http://c:80"}, TTL: time.Millisecond},
+		},
+		errs: []error{nil, nil, nil, errSource, nil},
+	}
+
+	var updates [][]string
+
+	w := discovery.NewWatcher(provider, []string{"http://a:80"}, discovery.WatcherOptions{
+		Name:     "test",
+		Interval: time.Minute,
+		Update: func(urls []string) {
+			updates = append(updates, urls)
+		},
+	})
+
+	for range len(provider.results) {
+		w.Refresh(t.Context())
+	}
+
+	// unchanged, empty and failed results don't update backends
+	assert.Equal(t, [][]string{
+		{"http://a:80", "http://b:80"},
+		{"http://c:80"},
+	}, updates)
+}
+
+func TestWatcherRunUsesTTL(t *testing.T) {
+	t.Parallel()
+
+	updated := make(chan []string, 1)
+
+	provider := &stubProvider{
+		results: []discovery.Result{
+			{URLs: []string{"http://a:80"}, TTL: time.Millisecond},
+			{URLs: []string{"http://b:80"}},
+		},
+		errs: []error{nil, nil},
+	}
+
+	w := discovery.NewWatcher(provider, nil, discovery.WatcherOptions{
+		Interval: time.Hour,
+		Update: func(urls []string) {
+			updated <- urls
+		},
+	})
+
+	w.Refresh(t.Context())
+	assert.Equal(t, []string{"http://a:80"}, <-updated)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	// the refresh happens after the minimal interval instead of an hour
+	select {
+	case urls := <-updated:
+		assert.Equal(t, []string{"http://b:80"}, urls)
+	case <-time.After(time.Second * 3):
+		t.Fatal("backends weren't refreshed after TTL")
+	}
+}
+
+func TestWatcherRetriesWithoutBackends(t *testing.T) {
+	t.Parallel()
+
+	updated := make(chan []string, 1)
+
+	provider := &stubProvider{
+		results: []discovery.Result{{}, {URLs: []string{"http://a:80"}}},
+		errs:    []error{errSource, nil},
+	}
+
+	w := discovery.NewWatcher(provider, nil, discovery.WatcherOptions{
+		Interval: time.Hour,
+		Update: func(urls []string) {
+			updated <- urls
+		},
+	})
+
+	w.Refresh(t.Context())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	// the failed first discovery is retried after the minimal interval instead of an hour
+	select {
+	case urls := <-updated:
+		assert.Equal(t, []string{"http://a:80"}, urls)
+	case <-time.After(time.Second * 3):
+		t.Fatal("failed discovery wasn't retried")
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "json list",
+			content: `["http://10.0.0.1:8080", "http://10.0.0.2:8080"]`,
+			want:    []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+		},
+		{
+			name:    "yaml list",
+			content: "- http://10.0.0.1:8080\n- http://10.0.0.2:8080\n",
+			want:    []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+		},
+		{
+			name:    "not a list",
+			content: `{"backends": []}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "backends")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			res, err := discovery.NewFile(path).Discover(t.Context())
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res.URLs)
+		})
+	}
+
+	_, err := discovery.NewFile(filepath.Join(t.TempDir(), "missing")).Discover(t.Context())
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
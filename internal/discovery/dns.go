@@ -0,0 +1,146 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrDNSResponse is returned when a DNS server responds with an error code.
+var ErrDNSResponse = errors.New("dns server returned an error")
+
+const resolvConf = "/etc/resolv.conf"
+
+// RecordType is a type of DNS records, that contain backend addresses.
+type RecordType int
+
+// A list of supported record types.
+const (
+	ARecord RecordType = iota
+	AAAARecord
+	SRVRecord
+)
+
+func (t RecordType) qtype() uint16 {
+	switch t {
+	case AAAARecord:
+		return dns.TypeAAAA
+	case SRVRecord:
+		return dns.TypeSRV
+	case ARecord:
+	}
+
+	return dns.TypeA
+}
+
+// DNSOptions contains settings of the DNS provider.
+type DNSOptions struct {
+	// Name is a domain name, it's made fully qualified, search domains aren't applied.
+	Name       string
+	RecordType RecordType
+	// Port of backends found by A and AAAA records, SRV records contain ports.
+	Port   int
+	Scheme string
+	// Server is "host:port" of a DNS server, the first nameserver of /etc/resolv.conf is used if it's empty.
+	Server  string
+	Timeout time.Duration
+}
+
+// DNS finds backends in A, AAAA or SRV records. Results are valid for the shortest TTL of the records.
+type DNS struct {
+	opts   DNSOptions
+	client *dns.Client
+}
+
+// NewDNS creates a DNS provider.
+func NewDNS(opts DNSOptions) (*DNS, error) {
+	if opts.Server == "" {
+		conf, err := dns.ClientConfigFromFile(resolvConf)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", resolvConf, err)
+		}
+
+		if len(conf.Servers) == 0 {
+			return nil, fmt.Errorf("%w: no nameservers in %s", ErrDNSResponse, resolvConf)
+		}
+
+		opts.Server = net.JoinHostPort(conf.Servers[0], conf.Port)
+	}
+
+	opts.Name = dns.Fqdn(opts.Name)
+
+	return &DNS{
+		opts:   opts,
+		client: &dns.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+// Discover implements Provider.
+func (d *DNS) Discover(ctx context.Context) (Result, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(d.opts.Name, d.opts.RecordType.qtype())
+
+	resp, err := d.exchange(ctx, msg)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		res    Result
+		minTTL uint32
+	)
+
+	for _, rr := range resp.Answer {
+		var url string
+
+		switch record := rr.(type) {
+		case *dns.A:
+			url = backendURL(d.opts.Scheme, record.A.String(), d.opts.Port)
+		case *dns.AAAA:
+			url = backendURL(d.opts.Scheme, record.AAAA.String(), d.opts.Port)
+		case *dns.SRV:
+			url = backendURL(d.opts.Scheme, strings.TrimSuffix(record.Target, "."), int(record.Port))
+		default:
+			// e.g. CNAME records, that lead to the addresses
+			continue
+		}
+
+		if ttl := rr.Header().Ttl; minTTL == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+
+		res.URLs = append(res.URLs, url)
+	}
+
+	res.TTL = time.Duration(minTTL) * time.Second
+
+	return res, nil
+}
+
+// exchange sends the query over UDP and repeats it over TCP, if the response is truncated.
+func (d *DNS) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := d.client.ExchangeContext(ctx, msg, d.opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %w", d.opts.Name, err)
+	}
+
+	if resp.Truncated {
+		tcp := &dns.Client{Net: "tcp", Timeout: d.opts.Timeout}
+
+		resp, _, err = tcp.ExchangeContext(ctx, msg, d.opts.Server)
+		if err != nil {
+			return nil, fmt.Errorf("error querying %s over tcp: %w", d.opts.Name, err)
+		}
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%w: %s for %s", ErrDNSResponse, dns.RcodeToString[resp.Rcode], d.opts.Name)
+	}
+
+	return resp, nil
+}
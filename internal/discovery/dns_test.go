@@ -0,0 +1,131 @@
+package discovery_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/discovery"
+)
+
+// startDNSServer starts a UDP DNS server with the records, it returns its address.
+func startDNSServer(t *testing.T, records ...string) string {
+	t.Helper()
+
+	zone := make(map[uint16][]dns.RR)
+
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		zone[rr.Header().Rrtype] = append(zone[rr.Header().Rrtype], rr)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+
+			q := req.Question[0]
+			if q.Name != "svc.example.com." {
+				resp.SetRcode(req, dns.RcodeNameError)
+			}
+
+			resp.Answer = zone[q.Qtype]
+
+			//nolint:errcheck
+			w.WriteMsg(resp)
+		}),
+	}
+
+	go srv.ActivateAndServe() //nolint:errcheck
+
+	t.Cleanup(func() {
+		//nolint:errcheck
+		srv.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNS(t *testing.T) {
+	t.Parallel()
+
+	server := startDNSServer(t,
+		"svc.example.com. 30 IN A 10.0.0.1",
+		"svc.example.com. 10 IN A 10.0.0.2",
+		"svc.example.com. 60 IN AAAA 2001:db8::1",
+		"svc.example.com. 20 IN SRV 10 50 8443 node1.example.com.",
+	)
+
+	tests := []struct {
+		name       string
+		host       string
+		recordType discovery.RecordType
+		want       []string
+		wantTTL    time.Duration
+		wantErr    error
+	}{
+		{
+			name:       "A records",
+			host:       "svc.example.com",
+			recordType: discovery.ARecord,
+			want:       []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+			wantTTL:    time.Second * 10,
+		},
+		{
+			name:       "AAAA records",
+			host:       "svc.example.com",
+			recordType: discovery.AAAARecord,
+			want:       []string{"http://[2001:db8::1]:8080"},
+			wantTTL:    time.Minute,
+		},
+		{
+			name:       "SRV records",
+			host:       "svc.example.com.",
+			recordType: discovery.SRVRecord,
+			want:       []string{"http://node1.example.com:8443"},
+			wantTTL:    time.Second * 20,
+		},
+		{
+			name:       "unknown name",
+			host:       "missing.example.com",
+			recordType: discovery.ARecord,
+			wantErr:    discovery.ErrDNSResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			provider, err := discovery.NewDNS(discovery.DNSOptions{
+				Name:       tt.host,
+				RecordType: tt.recordType,
+				Port:       8080,
+				Scheme:     "http",
+				Server:     server,
+				Timeout:    time.Second,
+			})
+			require.NoError(t, err)
+
+			res, err := provider.Discover(t.Context())
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res.URLs)
+			assert.Equal(t, tt.wantTTL, res.TTL)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File reads backend URLs from a JSON or YAML list, so they can be changed by editing the file.
+type File struct {
+	path string
+}
+
+// NewFile creates a file provider.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Discover implements Provider.
+func (f *File) Discover(_ context.Context) (Result, error) {
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading backends file: %w", err)
+	}
+
+	// JSON is valid YAML, so both formats are parsed the same way
+	var urls []string
+	if err := yaml.Unmarshal(raw, &urls); err != nil {
+		return Result{}, fmt.Errorf("error parsing backends file: %w", err)
+	}
+
+	return Result{URLs: urls}, nil
+}
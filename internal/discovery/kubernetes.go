@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNoPort is returned when endpoints have no port with the configured name.
+var ErrNoPort = errors.New("endpoints have no such port")
+
+// KubernetesOptions contains settings of the Kubernetes provider.
+type KubernetesOptions struct {
+	// Address of the API server, e.g. "https://kubernetes.default.svc".
+	Address   string
+	Namespace string
+	Service   string
+	// PortName selects a port of the endpoints, the first port is used if it's empty.
+	PortName string
+	// TokenFile contains a bearer token, it's read before every request, as tokens are rotated.
+	// Requests are sent without a token, if the file doesn't exist, e.g. to kubectl proxy.
+	TokenFile string
+	Scheme    string
+	// Client is used for requests to the API, http.DefaultClient if it's nil.
+	Client *http.Client
+}
+
+// Kubernetes finds ready addresses of a service in the Endpoints API.
+type Kubernetes struct {
+	opts KubernetesOptions
+}
+
+type endpointPort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// endpoints is a part of the core/v1 Endpoints object.
+type endpoints struct {
+	Subsets []struct {
+		// Addresses are ready to serve, not ready ones are listed in notReadyAddresses.
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []endpointPort `json:"ports"`
+	} `json:"subsets"`
+}
+
+// NewKubernetes creates a Kubernetes provider.
+func NewKubernetes(opts KubernetesOptions) *Kubernetes {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	return &Kubernetes{opts: opts}
+}
+
+// Discover implements Provider.
+func (k *Kubernetes) Discover(ctx context.Context) (Result, error) {
+	endpoint := k.opts.Address + "/api/v1/namespaces/" + url.PathEscape(k.opts.Namespace) +
+		"/endpoints/" + url.PathEscape(k.opts.Service)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("error creating kubernetes request: %w", err)
+	}
+
+	token, err := os.ReadFile(k.opts.TokenFile)
+
+	switch {
+	case err == nil:
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case !errors.Is(err, fs.ErrNotExist):
+		return Result{}, fmt.Errorf("error reading kubernetes token: %w", err)
+	}
+
+	var eps endpoints
+	if err := getJSON(k.opts.Client, req, &eps); err != nil {
+		return Result{}, fmt.Errorf("error getting endpoints %s/%s: %w", k.opts.Namespace, k.opts.Service, err)
+	}
+
+	var res Result
+
+	for _, subset := range eps.Subsets {
+		if len(subset.Addresses) == 0 {
+			continue
+		}
+
+		port, err := k.port(subset.Ports)
+		if err != nil {
+			return Result{}, err
+		}
+
+		for _, addr := range subset.Addresses {
+			res.URLs = append(res.URLs, backendURL(k.opts.Scheme, addr.IP, port))
+		}
+	}
+
+	return res, nil
+}
+
+func (k *Kubernetes) port(ports []endpointPort) (int, error) {
+	for _, p := range ports {
+		if k.opts.PortName == "" || p.Name == k.opts.PortName {
+			return p.Port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrNoPort, k.opts.PortName)
+}
@@ -0,0 +1,69 @@
+package discovery_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/discovery"
+)
+
+func TestKubernetes(t *testing.T) {
+	t.Parallel()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/prod/endpoints/api" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck
+		w.Write([]byte(`{
+			"kind": "Endpoints",
+			"subsets": [
+				{
+					"addresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}],
+					"notReadyAddresses": [{"ip": "10.0.0.3"}],
+					"ports": [{"name": "metrics", "port": 9090}, {"name": "http", "port": 8080}]
+				},
+				{
+					"notReadyAddresses": [{"ip": "10.0.0.4"}],
+					"ports": [{"name": "http", "port": 8080}]
+				}
+			]
+		}`))
+	}))
+	t.Cleanup(api.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token\n"), 0o600))
+
+	opts := discovery.KubernetesOptions{
+		Address:   api.URL,
+		Namespace: "prod",
+		Service:   "api",
+		PortName:  "http",
+		TokenFile: tokenFile,
+		Scheme:    "http",
+	}
+
+	res, err := discovery.NewKubernetes(opts).Discover(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}, res.URLs)
+
+	opts.PortName = "grpc"
+
+	_, err = discovery.NewKubernetes(opts).Discover(t.Context())
+	require.ErrorIs(t, err, discovery.ErrNoPort)
+
+	opts.TokenFile = filepath.Join(t.TempDir(), "missing")
+
+	_, err = discovery.NewKubernetes(opts).Discover(t.Context())
+	require.ErrorIs(t, err, discovery.ErrUnexpectedStatus)
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+)
+
+// RouteAccess contains access rules of a route and counters of denied requests.
+type RouteAccess struct {
+	Route int          `json:"route"` // number of the route in the config, starting from 1
+	Rules access.Rules `json:"rules"`
+	Stats access.Stats `json:"stats"`
+}
+
+func routeAccess(route int, l *access.List) RouteAccess {
+	return RouteAccess{
+		Route: route,
+		Rules: l.Rules(),
+		Stats: l.Stats(),
+	}
+}
+
+func (s *Server) getAccess(w http.ResponseWriter, _ *http.Request) {
+	res := make([]RouteAccess, 0, len(s.state.Access))
+	for i, l := range s.state.Access {
+		res = append(res, routeAccess(i+1, l))
+	}
+
+	writeJSON(w, res, http.StatusOK)
+}
+
+// findAccess returns the access list of the route from the "route" URL parameter.
+func (s *Server) findAccess(w http.ResponseWriter, r *http.Request) (int, *access.List, bool) {
+	route, err := strconv.Atoi(chi.URLParam(r, "route"))
+	if err != nil || route < 1 || route > len(s.state.Access) {
+		writeError(w,
+			"Not found",
+			"Route with this number doesn't exist",
+			http.StatusNotFound,
+		)
+
+		return 0, nil, false
+	}
+
+	return route, s.state.Access[route-1], true
+}
+
+func (s *Server) getRouteAccess(w http.ResponseWriter, r *http.Request) {
+	route, l, ok := s.findAccess(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, routeAccess(route, l), http.StatusOK)
+}
+
+// setRouteAccess replaces access rules of the route,
+// e.g. {"allow": ["10.0.0.0/8"], "deny": ["10.0.0.1"], "allowCountries": [], "denyCountries": ["XX"]}.
+func (s *Server) setRouteAccess(w http.ResponseWriter, r *http.Request) {
+	route, l, ok := s.findAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req access.Rules
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w,
+			"Invalid request",
+			"Body must be a JSON object with allow, deny, allowCountries and denyCountries fields",
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	if err := l.Set(req); err != nil {
+		writeError(w,
+			"Invalid request",
+			err.Error(),
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	writeJSON(w, routeAccess(route, l), http.StatusOK)
+}
@@ -0,0 +1,124 @@
+// Package admin contains the administrative API of the load balancer.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// ResponseError struct implements RFC 7807/RFC 9457 for http error responses.
+type ResponseError struct {
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func (e ResponseError) Error() string {
+	return e.Title + ": " + e.Detail
+}
+
+func writeError(w http.ResponseWriter, title, detail string, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	err := ResponseError{
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+
+	//nolint:errchkjson
+	_ = json.NewEncoder(w).Encode(err)
+}
+
+func writeJSON(w http.ResponseWriter, v any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	//nolint:errchkjson
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Server implements ServeHTTP interface and represents the admin API server.
+type Server struct {
+	mux   *chi.Mux
+	state State
+}
+
+// New creates a new admin API server, requests must have the bearer token, if it's not empty.
+func New(state State, token string) *Server {
+	mux := chi.NewMux()
+	s := &Server{
+		mux:   mux,
+		state: state,
+	}
+
+	mux.Use(
+		chiMiddleware.RequestID,
+		chiMiddleware.Recoverer,
+		chiMiddleware.StripSlashes,
+		requireToken(token),
+	)
+
+	mux.Get("/", s.getDashboard)
+
+	mux.Route("/status", func(r chi.Router) {
+		r.Get("/", s.getStatus)
+		r.Get("/pools/{pool}", s.getPoolStatus)
+		r.Get("/clients", s.getTopClients)
+	})
+
+	mux.Route("/log/level", func(r chi.Router) {
+		r.Get("/", getLogLevels)
+		r.Put("/", setLogLevel)
+		r.Put("/{component}", setLogLevel)
+		r.Delete("/{component}", resetLogLevel)
+	})
+
+	mux.Get("/maintenance", s.getMaintenance)
+	mux.Put("/maintenance", s.setMaintenance)
+
+	mux.Get("/cluster", s.getCluster)
+
+	mux.Get("/cache", s.getCacheStats)
+	mux.Delete("/cache", s.purgeCache)
+
+	mux.Route("/access", func(r chi.Router) {
+		r.Get("/", s.getAccess)
+		r.Get("/routes/{route}", s.getRouteAccess)
+		r.Put("/routes/{route}", s.setRouteAccess)
+	})
+
+	return s
+}
+
+// requireToken responds with 401 to requests without the bearer token, empty token allows all requests.
+func requireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if token != "" && (!ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeError(w,
+					"Unauthorized",
+					"Authorization header must contain the admin bearer token",
+					http.StatusUnauthorized,
+				)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,126 @@
+package admin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/admin"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+)
+
+const testToken = "secret"
+
+func newServer(t *testing.T) *admin.Server {
+	t.Helper()
+
+	maintenance, err := middleware.NewMaintenance(middleware.MaintenanceState{}, nil)
+	require.NoError(t, err)
+
+	return admin.New(admin.State{Maintenance: maintenance}, testToken)
+}
+
+// do sends an authorized request to the admin server.
+func do(s *admin.Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	s := newServer(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"not bearer", "Basic " + testToken, http.StatusUnauthorized},
+		{"valid token", "Bearer " + testToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/status", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	t.Run("empty token disables authentication", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		admin.New(admin.State{}, "").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestLogLevel(t *testing.T) {
+	t.Parallel()
+
+	s := newServer(t)
+
+	w := do(s, http.MethodPut, "/log/level/unknown", `{"level": "debug"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(s, http.MethodDelete, "/log/level/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(s, http.MethodPut, "/log/level/cache", `{"level": "loud"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(s, http.MethodPut, "/log/level/cache", `{"level": "debug"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cache":"DEBUG"`)
+
+	w = do(s, http.MethodDelete, "/log/level/cache", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"cache"`)
+}
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	s := newServer(t)
+
+	w := do(s, http.MethodGet, "/maintenance", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": false, "retryAfter": 0, "allowedIPs": null}`, w.Body.String())
+
+	w = do(s, http.MethodPut, "/maintenance", `{"enabled": true, "retryAfter": 300, "allowedIPs": ["10.0.0.0/8"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": true, "retryAfter": 300, "allowedIPs": ["10.0.0.0/8"]}`, w.Body.String())
+
+	w = do(s, http.MethodGet, "/maintenance", "")
+	assert.Contains(t, w.Body.String(), `"enabled":true`)
+
+	w = do(s, http.MethodPut, "/maintenance", `{"enabled": true, "allowedIPs": ["not an ip"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(s, http.MethodPut, "/maintenance", `enabled`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// invalid requests don't change the state
+	w = do(s, http.MethodGet, "/maintenance", "")
+	assert.JSONEq(t, `{"enabled": true, "retryAfter": 300, "allowedIPs": ["10.0.0.0/8"]}`, w.Body.String())
+}
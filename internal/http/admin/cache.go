@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+)
+
+// PurgeResponse is a response with the amount of purged cache entries.
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (s *Server) cacheEnabled(w http.ResponseWriter) bool {
+	if s.state.Cache != nil {
+		return true
+	}
+
+	writeError(w,
+		"Not found",
+		"Response cache is not enabled on any route",
+		http.StatusNotFound,
+	)
+
+	return false
+}
+
+func (s *Server) getCacheStats(w http.ResponseWriter, _ *http.Request) {
+	if !s.cacheEnabled(w) {
+		return
+	}
+
+	writeJSON(w, s.state.Cache.Stats(), http.StatusOK)
+}
+
+// purgeCache removes stored responses, optionally limited by "host" and "prefix" (path prefix) query parameters.
+func (s *Server) purgeCache(w http.ResponseWriter, r *http.Request) {
+	if !s.cacheEnabled(w) {
+		return
+	}
+
+	query := r.URL.Query()
+	purged := s.state.Cache.Purge(query.Get("host"), query.Get("prefix"))
+
+	writeJSON(w, PurgeResponse{Purged: purged}, http.StatusOK)
+}
@@ -0,0 +1,20 @@
+package admin
+
+import (
+	"net/http"
+)
+
+// getCluster returns members of the cluster with their backend observations and rate limit usage.
+func (s *Server) getCluster(w http.ResponseWriter, _ *http.Request) {
+	if s.state.Cluster == nil {
+		writeError(w,
+			"Not found",
+			"Cluster mode is not enabled",
+			http.StatusNotFound,
+		)
+
+		return
+	}
+
+	writeJSON(w, s.state.Cluster.Status(), http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+// LogLevels is a response with current log levels.
+type LogLevels struct {
+	Default    slog.Level            `json:"default"`
+	Components map[string]slog.Level `json:"components"`
+}
+
+// LogLevelRequest is a request for changing the log level.
+type LogLevelRequest struct {
+	Level slog.Level `json:"level"`
+}
+
+func getLogLevels(w http.ResponseWriter, _ *http.Request) {
+	defaultLevel, components := logging.Levels()
+
+	writeJSON(w, LogLevels{
+		Default:    defaultLevel,
+		Components: components,
+	}, http.StatusOK)
+}
+
+// setLogLevel changes the level of a component from the path or the default level if it's empty.
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w,
+			"Invalid request",
+			"Body must be a JSON object with a valid level, e.g. {\"level\": \"debug\"}",
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	component := chi.URLParam(r, "component")
+	if err := logging.SetLevel(component, req.Level); err != nil {
+		writeError(w,
+			"Not found",
+			err.Error(),
+			http.StatusNotFound,
+		)
+
+		return
+	}
+
+	slog.Info("log level changed",
+		slog.String("component", component),
+		slog.String("level", req.Level.String()),
+	)
+
+	getLogLevels(w, r)
+}
+
+func resetLogLevel(w http.ResponseWriter, r *http.Request) {
+	component := chi.URLParam(r, "component")
+	if err := logging.ResetLevel(component); err != nil {
+		writeError(w,
+			"Not found",
+			err.Error(),
+			http.StatusNotFound,
+		)
+
+		return
+	}
+
+	slog.Info("log level reset to default", slog.String("component", component))
+
+	getLogLevels(w, r)
+}
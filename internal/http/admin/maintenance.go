@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+)
+
+func (s *Server) getMaintenance(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.state.Maintenance.State(), http.StatusOK)
+}
+
+// setMaintenance replaces the maintenance state,
+// e.g. {"enabled": true, "retryAfter": 300, "allowedIPs": ["10.0.0.0/8"]}.
+func (s *Server) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req middleware.MaintenanceState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w,
+			"Invalid request",
+			"Body must be a JSON object with enabled, retryAfter and allowedIPs fields",
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	if err := s.state.Maintenance.Set(req); err != nil {
+		writeError(w,
+			"Invalid request",
+			err.Error(),
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	s.getMaintenance(w, r)
+}
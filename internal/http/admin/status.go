@@ -0,0 +1,216 @@
+package admin
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/cluster"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+const defaultTopClients = 10
+
+//go:embed templates/dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// State contains the parts of the load balancer exposed by the admin API.
+type State struct {
+	Pools       []*pool.Pool
+	Maintenance *middleware.Maintenance
+	// Cache is nil, when no route caches responses.
+	Cache *cache.Cache
+	// Access contains access lists of routes in their configured order.
+	Access []*access.List
+	// Concurrency is the global concurrency limiter, it's nil when it's disabled.
+	Concurrency *concurrency.Limiter
+	// Cluster is nil, when cluster mode is disabled.
+	Cluster *cluster.Cluster
+}
+
+// RateLimitStatus contains the rate limit settings.
+type RateLimitStatus struct {
+	Type          string `json:"type"`
+	Capacity      int    `json:"capacity"`
+	TokenRate     int    `json:"tokenRate"`
+	TokenInterval string `json:"tokenInterval"`
+}
+
+// PoolStatus contains the current state of a backend pool.
+type PoolStatus struct {
+	Name        string                       `json:"name"`
+	Balancer    string                       `json:"balancer"`
+	RateLimit   RateLimitStatus              `json:"rateLimit"`
+	Backends    []backend.Status             `json:"backends"`
+	TopRejected []ratelimit.ClientRejections `json:"topRejected"`
+	Concurrency *concurrency.Stats           `json:"concurrency,omitempty"`
+	Queue       *queue.Stats                 `json:"queue,omitempty"`
+}
+
+// StatusResponse is a response with the current state of the load balancer.
+type StatusResponse struct {
+	Pools       []PoolStatus       `json:"pools"`
+	Concurrency *concurrency.Stats `json:"concurrency,omitempty"`
+}
+
+func poolStatus(p *pool.Pool, topClients int) PoolStatus {
+	poolBackends := p.GetBackends()
+
+	backends := make([]backend.Status, 0, len(poolBackends))
+	for _, b := range poolBackends {
+		backends = append(backends, b.Status())
+	}
+
+	var concurrencyStats *concurrency.Stats
+	if p.Concurrency != nil {
+		stats := p.Concurrency.Stats()
+		concurrencyStats = &stats
+	}
+
+	var queueStats *queue.Stats
+	if p.Queue != nil {
+		stats := p.Queue.Stats()
+		queueStats = &stats
+	}
+
+	return PoolStatus{
+		Name:     p.Name,
+		Balancer: string(p.BalancerType),
+		RateLimit: RateLimitStatus{
+			Type:          string(p.RateLimit.Type),
+			Capacity:      p.RateLimit.Capacity,
+			TokenRate:     p.RateLimit.TokenRate,
+			TokenInterval: p.RateLimit.TokenInterval.String(),
+		},
+		Backends:    backends,
+		TopRejected: p.Limiter.TopRejected(topClients),
+		Concurrency: concurrencyStats,
+		Queue:       queueStats,
+	}
+}
+
+func (s *Server) status(topClients int) StatusResponse {
+	res := StatusResponse{
+		Pools: make([]PoolStatus, 0, len(s.state.Pools)),
+	}
+
+	for _, p := range s.state.Pools {
+		res.Pools = append(res.Pools, poolStatus(p, topClients))
+	}
+
+	if s.state.Concurrency != nil {
+		stats := s.state.Concurrency.Stats()
+		res.Concurrency = &stats
+	}
+
+	return res
+}
+
+func (s *Server) findPool(name string) *pool.Pool {
+	for _, p := range s.state.Pools {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, s.status(limit), http.StatusOK)
+}
+
+func (s *Server) getPoolStatus(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	p := s.findPool(chi.URLParam(r, "pool"))
+	if p == nil {
+		writeError(w,
+			"Not found",
+			"Pool with this name doesn't exist",
+			http.StatusNotFound,
+		)
+
+		return
+	}
+
+	writeJSON(w, poolStatus(p, limit), http.StatusOK)
+}
+
+// getTopClients returns clients with most rejections across all rate limiters.
+func (s *Server) getTopClients(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	// pools without own rate limit policy share a limiter, so count it once
+	seen := make(map[*ratelimit.RejectionTracker]struct{}, len(s.state.Pools))
+	trackers := make([]*ratelimit.RejectionTracker, 0, len(s.state.Pools))
+
+	for _, p := range s.state.Pools {
+		if _, ok := seen[p.Limiter]; ok {
+			continue
+		}
+
+		seen[p.Limiter] = struct{}{}
+		trackers = append(trackers, p.Limiter)
+	}
+
+	writeJSON(w, ratelimit.MergeTopRejected(limit, trackers...), http.StatusOK)
+}
+
+func (s *Server) getDashboard(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := dashboardTemplate.Execute(w, s.status(limit)); err != nil {
+		slog.Error("failed to render admin dashboard", slog.Any("error", err))
+	}
+}
+
+// parseLimit reads the "limit" query parameter for the amount of top clients.
+func parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultTopClients, true
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		writeError(w,
+			"Invalid request",
+			"Query parameter limit must be a non-negative integer",
+			http.StatusBadRequest,
+		)
+
+		return 0, false
+	}
+
+	return limit, true
+}
@@ -0,0 +1,52 @@
+package problem
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes of errors, generated by the proxy.
+const (
+	grpcCanceled          = 1
+	grpcDeadlineExceeded  = 4
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcCode maps HTTP status of a proxy error to the gRPC status code.
+func grpcCode(status int) int {
+	switch status {
+	case StatusClientClosedRequest:
+		return grpcCanceled
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case http.StatusNotFound:
+		return grpcUnimplemented
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return grpcUnavailable
+	}
+
+	return grpcInternal
+}
+
+// writeGRPCError responds with a trailers-only gRPC response, where status is sent in headers.
+func writeGRPCError(w http.ResponseWriter, message string, status int) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(grpcCode(status)))
+	h.Set("Grpc-Message", message)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,249 @@
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// MaintenancePage is the name of the page, rendered in maintenance mode.
+const MaintenancePage = "maintenance"
+
+// pageStatuses are statuses, that can have HTML error pages.
+var pageStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// PageData contains values available in error page templates.
+type PageData struct {
+	Status     int
+	Title      string
+	Detail     string
+	RequestID  string
+	RetryAfter string // seconds, if the response has Retry-After header
+}
+
+// Pages are HTML error pages, that replace problem details for clients preferring HTML.
+type Pages struct {
+	pages map[string]*template.Template
+}
+
+// LoadPages parses "<status>.html" pages for 429, 502, 503, 504 statuses and "maintenance.html" from the directory.
+// Missing pages are skipped, such responses stay problem details.
+func LoadPages(dir string) (*Pages, error) {
+	names := make([]string, 0, len(pageStatuses)+1)
+	for _, status := range pageStatuses {
+		names = append(names, strconv.Itoa(status))
+	}
+
+	names = append(names, MaintenancePage)
+
+	p := &Pages{pages: make(map[string]*template.Template, len(names))}
+
+	for _, name := range names {
+		path := filepath.Join(dir, name+".html")
+
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading error page: %w", err)
+		}
+
+		tmpl, err := template.New(name).Parse(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing error page %q: %w", path, err)
+		}
+
+		p.pages[name] = tmpl
+	}
+
+	return p, nil
+}
+
+// Render writes the page, if it exists and the client prefers HTML. It returns false if nothing was written.
+func (p *Pages) Render(w http.ResponseWriter, r *http.Request, name string, data PageData) bool {
+	if p == nil || !prefersHTML(r.Header.Get("Accept")) {
+		return false
+	}
+
+	tmpl, ok := p.pages[name]
+	if !ok {
+		return false
+	}
+
+	if data.RequestID == "" {
+		data.RequestID = middleware.GetReqID(r.Context())
+	}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Error("failed to render error page", slog.String("page", name), slog.Any("error", err))
+		return false
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(data.Status)
+	_, _ = w.Write(buf.Bytes())
+
+	return true
+}
+
+// Middleware replaces problem details with error pages for clients, that prefer HTML.
+func (p *Pages) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !prefersHTML(r.Header.Get("Accept")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pw := &pageWriter{ResponseWriter: w, pages: p}
+		next.ServeHTTP(pw, r)
+
+		if !pw.replaced {
+			return
+		}
+
+		var resp ResponseError
+		_ = json.Unmarshal(pw.body.Bytes(), &resp)
+
+		data := PageData{
+			Status:     pw.status,
+			Title:      resp.Title,
+			Detail:     resp.Detail,
+			RetryAfter: w.Header().Get("Retry-After"),
+		}
+
+		if !p.Render(w, r, strconv.Itoa(pw.status), data) {
+			w.WriteHeader(pw.status)
+			_, _ = w.Write(pw.body.Bytes())
+		}
+	})
+}
+
+// pageWriter holds back problem details responses with an error page, so they can be replaced.
+// Only responses of the proxy are replaced, problem details from backends are passed through.
+type pageWriter struct {
+	http.ResponseWriter
+
+	pages *Pages
+	// own is set by MarkOwn, so problem details from backends aren't replaced
+	own         bool
+	wroteHeader bool
+	replaced    bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (pw *pageWriter) WriteHeader(status int) {
+	if pw.wroteHeader || status < http.StatusOK {
+		pw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	pw.wroteHeader = true
+
+	mediaType, _, _ := mime.ParseMediaType(pw.Header().Get("Content-Type"))
+	if _, ok := pw.pages.pages[strconv.Itoa(status)]; ok && pw.own && mediaType == "application/problem+json" {
+		pw.replaced = true
+		pw.status = status
+
+		return
+	}
+
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *pageWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+
+	if pw.replaced {
+		//nolint:wrapcheck
+		return pw.body.Write(b)
+	}
+
+	//nolint:wrapcheck
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *pageWriter) MarkOwn() {
+	pw.own = true
+}
+
+// Unwrap allows http.ResponseController to reach the flusher and hijacker of the wrapped writer.
+func (pw *pageWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// OwnMarker is implemented by response writers, that need to know if problem details are written by the proxy,
+// e.g. writers buffering responses to replay them.
+type OwnMarker interface {
+	MarkOwn()
+}
+
+// MarkOwn marks the response as written by the proxy. Error pages replace only such problem details,
+// so problem details from backends are passed through.
+func MarkOwn(w http.ResponseWriter) {
+	for {
+		switch rw := w.(type) {
+		case OwnMarker:
+			rw.MarkOwn()
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// prefersHTML checks if the client explicitly accepts HTML at least as much as JSON.
+// Wildcards are not enough, so API clients with "*/*" still get problem details.
+func prefersHTML(accept string) bool {
+	var htmlQ, jsonQ float64
+
+	for mediaRange := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case "application/json", "application/problem+json", "application/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return htmlQ > 0 && htmlQ >= jsonQ
+}
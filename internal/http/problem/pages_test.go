@@ -0,0 +1,105 @@
+package problem_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+func TestPagesMiddleware(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "429.html"),
+		[]byte("<p>{{.Status}} {{.Title}} retry in {{.RetryAfter}}</p>"),
+		0o600,
+	))
+
+	pages, err := problem.LoadPages(dir)
+	require.NoError(t, err)
+
+	h := pages.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		problem.WriteRequest(w, r, "Too many requests", "Rate limit exceeded", http.StatusTooManyRequests)
+	}))
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "browser",
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>429 Too many requests retry in 10</p>",
+		},
+		{
+			name:            "wildcard",
+			accept:          "*/*",
+			wantContentType: "application/problem+json",
+		},
+		{
+			name:            "json preferred",
+			accept:          "application/json, text/html;q=0.5",
+			wantContentType: "application/problem+json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPagesMiddlewareBackendProblem(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "502.html"), []byte("<p>{{.Title}}</p>"), 0o600))
+
+	pages, err := problem.LoadPages(dir)
+	require.NoError(t, err)
+
+	const body = `{"title":"Payment service failed","status":502}`
+
+	// problem details of the backend are passed through as is
+	h := pages.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(body))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, body, w.Body.String())
+}
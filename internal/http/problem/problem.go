@@ -0,0 +1,48 @@
+// Package problem writes error responses of the proxy: RFC 9457 problem details,
+// or gRPC statuses for gRPC requests.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// StatusClientClosedRequest is a non-standard status of requests, canceled by the client before the response.
+const StatusClientClosedRequest = 499
+
+// ResponseError struct implements RFC 7807/RFC 9457 for http error responses.
+type ResponseError struct {
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func (e ResponseError) Error() string {
+	return e.Title + ": " + e.Detail
+}
+
+// Write responds with problem details.
+func Write(w http.ResponseWriter, title, detail string, status int) {
+	MarkOwn(w)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	err := ResponseError{
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+
+	//nolint:errchkjson
+	_ = json.NewEncoder(w).Encode(err)
+}
+
+// WriteRequest responds with gRPC status to gRPC requests and with problem details to others.
+func WriteRequest(w http.ResponseWriter, r *http.Request, title, detail string, status int) {
+	if isGRPC(r) {
+		writeGRPCError(w, detail, status)
+		return
+	}
+
+	Write(w, title, detail, status)
+}
@@ -0,0 +1,259 @@
+// Package access contains IP and country based access control of routes.
+package access
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.ProxyComponent)
+
+var (
+	// ErrInvalidCIDR is returned when an address in the rules is neither an IP nor a CIDR.
+	ErrInvalidCIDR = errors.New("invalid IP or CIDR")
+	// ErrInvalidCountry is returned when a country isn't an ISO 3166-1 alpha-2 code.
+	ErrInvalidCountry = errors.New("invalid country code")
+	// ErrNoGeoDatabase is returned when country rules are set without a geo database.
+	ErrNoGeoDatabase = errors.New("country rules require a geo database")
+)
+
+// Locator returns the ISO 3166-1 alpha-2 country code of the address, empty if it's unknown.
+type Locator interface {
+	Country(addr netip.Addr) string
+}
+
+// Rules contains allowed and denied clients of a route.
+type Rules struct {
+	// Allow and Deny contain IPs and CIDRs.
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// AllowCountries and DenyCountries contain ISO 3166-1 alpha-2 codes, e.g. "US".
+	AllowCountries []string `json:"allowCountries"`
+	DenyCountries  []string `json:"denyCountries"`
+}
+
+// Stats contains counters of denied requests.
+type Stats struct {
+	DeniedByIP      int64 `json:"deniedByIP"`
+	DeniedByCountry int64 `json:"deniedByCountry"`
+	// DeniedByDefault is the amount of requests, that matched no allow rule.
+	DeniedByDefault int64 `json:"deniedByDefault"`
+}
+
+// compiled contains parsed rules.
+type compiled struct {
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+	allowCountries []string
+	denyCountries  []string
+}
+
+// List checks clients of a route. Rules are applied in order: denied IPs, allowed IPs, denied countries,
+// allowed countries. When allow rules are set, clients matching none of them are denied.
+type List struct {
+	geo Locator
+
+	mu    sync.RWMutex
+	rules Rules
+	rs    compiled
+
+	deniedByIP      atomic.Int64
+	deniedByCountry atomic.Int64
+	deniedByDefault atomic.Int64
+}
+
+// New creates an access list with the rules, geo is required by country rules and can be nil otherwise.
+func New(rules Rules, geo Locator) (*List, error) {
+	l := &List{geo: geo}
+
+	if err := l.Set(rules); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Rules returns the current rules.
+func (l *List) Rules() Rules {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.rules
+}
+
+// Set replaces the rules.
+func (l *List) Set(rules Rules) error {
+	rs, err := compile(rules)
+	if err != nil {
+		return err
+	}
+
+	if (len(rs.allowCountries) > 0 || len(rs.denyCountries) > 0) && l.geo == nil {
+		return ErrNoGeoDatabase
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rules = rules
+	l.rs = rs
+
+	logger.Debug("access rules changed",
+		slog.Int("allow", len(rs.allow)+len(rs.allowCountries)),
+		slog.Int("deny", len(rs.deny)+len(rs.denyCountries)),
+	)
+
+	return nil
+}
+
+// Stats returns counters of denied requests.
+func (l *List) Stats() Stats {
+	return Stats{
+		DeniedByIP:      l.deniedByIP.Load(),
+		DeniedByCountry: l.deniedByCountry.Load(),
+		DeniedByDefault: l.deniedByDefault.Load(),
+	}
+}
+
+// Allows checks the address of the client, that sent the request, and counts denied requests.
+func (l *List) Allows(r *http.Request) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	rs := &l.rs
+	if len(rs.allow) == 0 && len(rs.deny) == 0 && len(rs.allowCountries) == 0 && len(rs.denyCountries) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		l.deniedByDefault.Add(1)
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	if containsAddr(rs.deny, addr) {
+		l.deniedByIP.Add(1)
+		return false
+	}
+
+	if containsAddr(rs.allow, addr) {
+		return true
+	}
+
+	if len(rs.allowCountries) > 0 || len(rs.denyCountries) > 0 {
+		country := l.geo.Country(addr)
+
+		if slices.Contains(rs.denyCountries, country) {
+			l.deniedByCountry.Add(1)
+			return false
+		}
+
+		if slices.Contains(rs.allowCountries, country) {
+			return true
+		}
+	}
+
+	if len(rs.allow) > 0 || len(rs.allowCountries) > 0 {
+		l.deniedByDefault.Add(1)
+		return false
+	}
+
+	return true
+}
+
+func compile(rules Rules) (compiled, error) {
+	var (
+		rs  compiled
+		err error
+	)
+
+	if rs.allow, err = parsePrefixes(rules.Allow); err != nil {
+		return compiled{}, err
+	}
+
+	if rs.deny, err = parsePrefixes(rules.Deny); err != nil {
+		return compiled{}, err
+	}
+
+	if rs.allowCountries, err = parseCountries(rules.AllowCountries); err != nil {
+		return compiled{}, err
+	}
+
+	if rs.denyCountries, err = parseCountries(rules.DenyCountries); err != nil {
+		return compiled{}, err
+	}
+
+	return rs, nil
+}
+
+// parsePrefixes parses CIDRs and single IPs.
+func parsePrefixes(raw []string) ([]netip.Prefix, error) {
+	res := make([]netip.Prefix, 0, len(raw))
+
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+
+		if strings.Contains(s, "/") {
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, s)
+			}
+
+			res = append(res, prefix.Masked())
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, s)
+		}
+
+		addr = addr.Unmap()
+		res = append(res, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return res, nil
+}
+
+func parseCountries(raw []string) ([]string, error) {
+	res := make([]string, 0, len(raw))
+
+	for _, s := range raw {
+		code := strings.ToUpper(strings.TrimSpace(s))
+		if len(code) != 2 || strings.IndexFunc(code, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCountry, s)
+		}
+
+		res = append(res, code)
+	}
+
+	return res, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package access_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+)
+
+// countries is a geo database stub, that maps addresses to countries.
+type countries map[string]string
+
+func (c countries) Country(addr netip.Addr) string {
+	return c[addr.String()]
+}
+
+func request(remoteAddr string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+
+	return r
+}
+
+func TestListAllows(t *testing.T) {
+	t.Parallel()
+
+	geo := countries{"203.0.113.1": "US", "203.0.113.2": "RU", "203.0.113.3": "DE"}
+
+	tests := []struct {
+		name       string
+		rules      access.Rules
+		remoteAddr string
+		want       bool
+	}{
+		{name: "no rules", remoteAddr: "192.0.2.1:1234", want: true},
+		{
+			name:       "allowed CIDR",
+			rules:      access.Rules{Allow: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.1.2.3:1234",
+			want:       true,
+		},
+		{
+			name:       "not allowed",
+			rules:      access.Rules{Allow: []string{"10.0.0.0/8"}},
+			remoteAddr: "192.0.2.1:1234",
+			want:       false,
+		},
+		{
+			name:       "deny before allow",
+			rules:      access.Rules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.13"}},
+			remoteAddr: "10.0.0.13:1234",
+			want:       false,
+		},
+		{
+			name:       "IPv6",
+			rules:      access.Rules{Deny: []string{"2001:db8::/32"}},
+			remoteAddr: "[2001:db8::1]:1234",
+			want:       false,
+		},
+		{
+			name:       "IPv4-mapped IPv6",
+			rules:      access.Rules{Deny: []string{"192.0.2.0/24"}},
+			remoteAddr: "[::ffff:192.0.2.1]:1234",
+			want:       false,
+		},
+		{
+			name:       "denied country",
+			rules:      access.Rules{DenyCountries: []string{"ru"}},
+			remoteAddr: "203.0.113.2:1234",
+			want:       false,
+		},
+		{
+			name:       "allowed country",
+			rules:      access.Rules{AllowCountries: []string{"US"}},
+			remoteAddr: "203.0.113.1:1234",
+			want:       true,
+		},
+		{
+			name:       "other country",
+			rules:      access.Rules{AllowCountries: []string{"US"}},
+			remoteAddr: "203.0.113.3:1234",
+			want:       false,
+		},
+		{
+			name:       "allowed IP in denied country",
+			rules:      access.Rules{Allow: []string{"203.0.113.2"}, DenyCountries: []string{"RU"}},
+			remoteAddr: "203.0.113.2:1234",
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			l, err := access.New(tt.rules, geo)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, l.Allows(request(tt.remoteAddr)))
+		})
+	}
+}
+
+func TestListSet(t *testing.T) {
+	t.Parallel()
+
+	l, err := access.New(access.Rules{}, nil)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, l.Set(access.Rules{Allow: []string{"10.0.0.0/33"}}), access.ErrInvalidCIDR)
+	require.ErrorIs(t, l.Set(access.Rules{DenyCountries: []string{"USA"}}), access.ErrInvalidCountry)
+	require.ErrorIs(t, l.Set(access.Rules{DenyCountries: []string{"US"}}), access.ErrNoGeoDatabase)
+	assert.Equal(t, access.Rules{}, l.Rules())
+
+	require.NoError(t, l.Set(access.Rules{Deny: []string{"192.0.2.1"}}))
+	assert.False(t, l.Allows(request("192.0.2.1:1234")))
+	assert.True(t, l.Allows(request("192.0.2.2:1234")))
+	assert.Equal(t, access.Stats{DeniedByIP: 1}, l.Stats())
+}
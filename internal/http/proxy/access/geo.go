@@ -0,0 +1,124 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// countryRecord is a part of GeoIP2/GeoLite2 Country and City records.
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	// RegisteredCountry is used for addresses without a country, e.g. anycast networks.
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type geoReader struct {
+	db      *maxminddb.Reader
+	modTime time.Time
+}
+
+// GeoDB finds countries of addresses in a MaxMind format (.mmdb) database file.
+// The file is read into memory, so it can be replaced while the load balancer is running.
+type GeoDB struct {
+	path   string
+	reader atomic.Pointer[geoReader]
+}
+
+// OpenGeoDB loads the database file.
+func OpenGeoDB(path string) (*GeoDB, error) {
+	g := &GeoDB{path: path}
+
+	reader, err := g.load()
+	if err != nil {
+		return nil, err
+	}
+
+	g.reader.Store(reader)
+
+	return g, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code of the address, empty if it's not found.
+func (g *GeoDB) Country(addr netip.Addr) string {
+	var record countryRecord
+
+	if err := g.reader.Load().db.Lookup(addr.AsSlice(), &record); err != nil {
+		logger.Debug("failed to look up country", slog.String("addr", addr.String()), slog.Any("error", err))
+		return ""
+	}
+
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+
+	return record.RegisteredCountry.ISOCode
+}
+
+// WatchReload checks the file for changes every interval and reloads it until ctx is done.
+// If reload fails, the previous database is kept.
+func (g *GeoDB) WatchReload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.reloadIfChanged(); err != nil {
+				logger.Error("failed to reload geo database", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func (g *GeoDB) reloadIfChanged() error {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return fmt.Errorf("error reading file info: %w", err)
+	}
+
+	if !info.ModTime().After(g.reader.Load().modTime) {
+		return nil
+	}
+
+	reader, err := g.load()
+	if err != nil {
+		return err
+	}
+
+	g.reader.Store(reader)
+	logger.Info("geo database reloaded", slog.String("type", reader.db.Metadata.DatabaseType))
+
+	return nil
+}
+
+func (g *GeoDB) load() (*geoReader, error) {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file info: %w", err)
+	}
+
+	raw, err := os.ReadFile(g.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading geo database: %w", err)
+	}
+
+	db, err := maxminddb.FromBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing geo database: %w", err)
+	}
+
+	return &geoReader{db: db, modTime: info.ModTime()}, nil
+}
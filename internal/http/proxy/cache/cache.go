@@ -0,0 +1,388 @@
+// Package cache contains a shared HTTP response cache (RFC 9111) for proxied requests.
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.CacheComponent)
+
+const (
+	// statusName identifies the load balancer in Cache-Status header (RFC 9211).
+	statusName = "balancer"
+	// revalidateTimeout limits background revalidations, that are not bound to a client request.
+	revalidateTimeout = 30 * time.Second
+)
+
+// Options contains settings of the cache.
+type Options struct {
+	// MaxBytes limits the total size of responses kept in memory.
+	MaxBytes int64
+	// MaxEntryBytes limits the size of a single response body, larger responses are not stored.
+	MaxEntryBytes int64
+	// DiskDir keeps responses evicted from memory, empty disables the disk tier.
+	DiskDir      string
+	DiskMaxBytes int64
+}
+
+// Stats contains the current state of the cache.
+type Stats struct {
+	Entries     int   `json:"entries"`
+	Bytes       int64 `json:"bytes"`
+	DiskEntries int   `json:"diskEntries"`
+	DiskBytes   int64 `json:"diskBytes"`
+	Hits        int64 `json:"hits"`
+	StaleHits   int64 `json:"staleHits"`
+	Misses      int64 `json:"misses"`
+	Revalidated int64 `json:"revalidated"`
+}
+
+// Cache stores responses of GET requests in memory with an optional disk tier.
+// Stored responses are shared between clients, so responses marked private are never stored.
+type Cache struct {
+	opts   Options
+	memory *memoryStore
+	disk   *diskStore
+
+	mu           sync.Mutex
+	revalidating map[string]struct{}
+
+	hits        atomic.Int64
+	staleHits   atomic.Int64
+	misses      atomic.Int64
+	revalidated atomic.Int64
+}
+
+// New creates a new cache, files of the previous run are removed from the disk directory.
+func New(opts Options) (*Cache, error) {
+	c := &Cache{
+		opts:         opts,
+		memory:       newMemoryStore(opts.MaxBytes),
+		revalidating: make(map[string]struct{}),
+	}
+
+	if opts.DiskDir != "" {
+		disk, err := newDiskStore(opts.DiskDir, opts.DiskMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		c.disk = disk
+	}
+
+	return c, nil
+}
+
+// Stats returns the current state of the cache.
+func (c *Cache) Stats() Stats {
+	res := Stats{
+		Hits:        c.hits.Load(),
+		StaleHits:   c.staleHits.Load(),
+		Misses:      c.misses.Load(),
+		Revalidated: c.revalidated.Load(),
+	}
+
+	res.Entries, res.Bytes = c.memory.stats()
+
+	if c.disk != nil {
+		res.DiskEntries, res.DiskBytes = c.disk.stats()
+	}
+
+	return res
+}
+
+// Purge removes stored responses of the host with paths under the prefix, empty values match everything.
+// It returns the amount of removed entries.
+func (c *Cache) Purge(host, pathPrefix string) int {
+	match := func(m meta) bool {
+		if host != "" && !strings.EqualFold(host, m.Host) {
+			return false
+		}
+
+		return strings.HasPrefix(m.URI, pathPrefix)
+	}
+
+	removed := c.memory.removeFunc(match)
+	if c.disk != nil {
+		removed += c.disk.removeFunc(match)
+	}
+
+	logger.Info("cache purged",
+		slog.String("host", host),
+		slog.String("prefix", pathPrefix),
+		slog.Int("entries", removed),
+	)
+
+	return removed
+}
+
+// request is a request to a resource, that can be cached.
+type request struct {
+	r        *http.Request
+	m        meta
+	key      string
+	upstream http.Handler
+}
+
+// Serve responds to the request from the cache or passes it to upstream, storing the response.
+// Responses are stored per pool, so routes with different pools don't share them.
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request, pool string, upstream http.Handler) {
+	m := meta{Pool: pool, Host: strings.ToLower(r.Host), URI: r.URL.RequestURI()}
+
+	if unsafeMethod(r.Method) {
+		c.invalidate(w, r, m, upstream)
+		return
+	}
+
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Range") != "" {
+		upstream.ServeHTTP(w, r)
+		return
+	}
+
+	reqDirectives := parseDirectives(r.Header)
+	req := request{r: r, m: m, key: m.Pool + " " + m.Host + " " + m.URI, upstream: upstream}
+
+	stored := c.lookup(req.key, r.Header)
+	if stored == nil {
+		if reqDirectives.has("only-if-cached") {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+
+		c.misses.Add(1)
+		c.fetch(w, req, nil, "fwd=miss")
+
+		return
+	}
+
+	now := time.Now()
+	age := stored.age(now)
+	ttl := stored.Lifetime - age
+
+	noCache := stored.NoCache || requestNoCache(r.Header, reqDirectives)
+	if maxAge, ok := reqDirectives.seconds("max-age"); ok && age > maxAge {
+		noCache = true
+	}
+
+	switch {
+	case !noCache && ttl > 0:
+		c.hits.Add(1)
+		writeEntry(w, r, stored, now, hitStatus(ttl))
+	case !noCache && !stored.MustRevalidate && -ttl <= stored.StaleWhileRevalidate:
+		c.staleHits.Add(1)
+		c.revalidateInBackground(req, stored)
+		writeEntry(w, r, stored, now, hitStatus(ttl))
+	case reqDirectives.has("only-if-cached"):
+		w.WriteHeader(http.StatusGatewayTimeout)
+	case stored.hasValidators():
+		fwd := "fwd=stale"
+		if requestNoCache(r.Header, reqDirectives) {
+			fwd = "fwd=request"
+		}
+
+		c.fetch(w, req, stored, fwd)
+	default:
+		c.misses.Add(1)
+		c.fetch(w, req, nil, "fwd=miss")
+	}
+}
+
+func hitStatus(ttl time.Duration) string {
+	return statusName + "; hit; ttl=" + strconv.FormatInt(int64(ttl/time.Second), 10)
+}
+
+// lookup returns the stored response, that matches request headers listed in Vary.
+func (c *Cache) lookup(key string, h http.Header) *entry {
+	e := c.get(key)
+	if e == nil || e.Vary == nil {
+		return e
+	}
+
+	return c.get(variantKey(key, e.Vary, h))
+}
+
+func (c *Cache) get(key string) *entry {
+	if e, ok := c.memory.get(key); ok {
+		return e
+	}
+
+	if c.disk == nil {
+		return nil
+	}
+
+	e, err := c.disk.get(key)
+	if err != nil {
+		logger.Warn("failed to read cached response", slog.Any("error", err))
+		return nil
+	}
+
+	if e != nil {
+		c.setMemory(e)
+	}
+
+	return e
+}
+
+func (c *Cache) setMemory(e *entry) {
+	for _, evicted := range c.memory.set(e) {
+		if c.disk == nil {
+			continue
+		}
+
+		if err := c.disk.set(evicted); err != nil {
+			logger.Warn("failed to move cached response to disk", slog.Any("error", err))
+		}
+	}
+}
+
+// store saves the response under the key of the resource, responses with Vary are saved as variants.
+func (c *Cache) store(e *entry, primary string, reqHeader http.Header) {
+	vary := varyHeaders(e.Header)
+	if len(vary) == 0 {
+		e.Key = primary
+		c.setMemory(e)
+
+		return
+	}
+
+	e.Key = variantKey(primary, vary, reqHeader)
+
+	c.setMemory(&entry{Resource: e.Resource, Key: primary, Vary: vary})
+	c.setMemory(e)
+}
+
+// invalidate passes the unsafe request to upstream and removes stored responses of the resource,
+// if the request succeeded (RFC 9111, section 4.4).
+func (c *Cache) invalidate(w http.ResponseWriter, r *http.Request, m meta, upstream http.Handler) {
+	cw := newCaptureWriter(w, 0, false)
+	upstream.ServeHTTP(cw, r)
+
+	if cw.status >= http.StatusBadRequest {
+		return
+	}
+
+	c.memory.removeFunc(func(stored meta) bool { return stored == m })
+
+	if c.disk != nil {
+		c.disk.removeFunc(func(stored meta) bool { return stored == m })
+	}
+}
+
+// fetch passes the request to upstream, revalidating the stored response if it's set, and stores the response.
+func (c *Cache) fetch(w http.ResponseWriter, req request, stored *entry, fwd string) {
+	out := req.r
+	if stored != nil {
+		out = conditionalRequest(req.r.Context(), req.r, stored)
+	}
+
+	var store bool
+
+	cw := newCaptureWriter(w, c.opts.MaxEntryBytes, stored != nil)
+	cw.onHeader = func(status int, h http.Header) string {
+		store = req.r.Method == http.MethodGet && storable(req.r, status, h, parseDirectives(h))
+
+		res := statusName + "; " + fwd + "; fwd-status=" + strconv.Itoa(status)
+		if store {
+			res += "; stored"
+		}
+
+		return res
+	}
+
+	requestTime := time.Now()
+	req.upstream.ServeHTTP(cw, out)
+
+	if cw.notModified {
+		c.revalidated.Add(1)
+
+		updated := stored.update(cw.header, requestTime, time.Now())
+		c.store(updated, req.key, req.r.Header)
+		writeEntry(w, req.r, updated, time.Now(), statusName+"; "+fwd+"; fwd-status=304")
+
+		return
+	}
+
+	if store && !cw.tooLarge {
+		c.storeResponse(req, cw, requestTime)
+	}
+}
+
+// revalidateInBackground refreshes the stale response, while it's served to clients.
+// Only one revalidation of a response runs at a time.
+func (c *Cache) revalidateInBackground(req request, stored *entry) {
+	c.mu.Lock()
+
+	if _, ok := c.revalidating[stored.Key]; ok {
+		c.mu.Unlock()
+		return
+	}
+
+	c.revalidating[stored.Key] = struct{}{}
+	c.mu.Unlock()
+
+	// the request is detached from the client, which doesn't wait for it, and from its access log entry
+	ctx := context.WithValue(context.Background(), chiMiddleware.RequestIDKey, chiMiddleware.GetReqID(req.r.Context()))
+	out := conditionalRequest(ctx, req.r, stored)
+	out.Method = http.MethodGet
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, stored.Key)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+		defer cancel()
+
+		out = out.WithContext(ctx)
+
+		var store bool
+
+		cw := newCaptureWriter(&discardWriter{header: make(http.Header)}, c.opts.MaxEntryBytes, true)
+		cw.onHeader = func(status int, h http.Header) string {
+			store = storable(out, status, h, parseDirectives(h))
+			return ""
+		}
+
+		requestTime := time.Now()
+		req.upstream.ServeHTTP(cw, out)
+
+		switch {
+		case cw.notModified:
+			c.revalidated.Add(1)
+			c.store(stored.update(cw.header, requestTime, time.Now()), req.key, out.Header)
+		case store && !cw.tooLarge:
+			c.storeResponse(request{r: out, m: req.m, key: req.key}, cw, requestTime)
+		default:
+			logger.Debug("background revalidation didn't update the response",
+				slog.String("uri", req.m.URI),
+				slog.Int("status", cw.status),
+			)
+		}
+	}()
+}
+
+func (c *Cache) storeResponse(req request, cw *captureWriter, requestTime time.Time) {
+	// responses, that were cut short, are not stored
+	if length := cw.header.Get("Content-Length"); length != "" && length != strconv.Itoa(cw.body.Len()) {
+		return
+	}
+
+	e := newEntry(req.m, cw.status, cw.header, cw.body.Bytes(), requestTime, time.Now())
+	// responses, that are neither fresh nor can be revalidated or served stale, are useless
+	if e.Lifetime > 0 || e.hasValidators() || e.StaleWhileRevalidate > 0 {
+		c.store(e, req.key, req.r.Header)
+	}
+}
@@ -0,0 +1,214 @@
+package cache_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+)
+
+const etag = `"v1"`
+
+// upstream counts requests and responds with the body and headers, 304 to matching If-None-Match.
+type upstream struct {
+	requests atomic.Int64
+	header   http.Header
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := u.requests.Add(1)
+
+	for name, values := range u.header {
+		w.Header()[name] = values
+	}
+
+	if r.Header.Get("If-None-Match") == w.Header().Get("ETag") && r.Header.Get("If-None-Match") != "" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("Accept-Language")+" #"+strconv.FormatInt(n, 10))
+}
+
+func newCache(t *testing.T, opts cache.Options) *cache.Cache {
+	t.Helper()
+
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = 1 << 20
+	}
+
+	opts.MaxEntryBytes = 1 << 10
+
+	c, err := cache.New(opts)
+	require.NoError(t, err)
+
+	return c
+}
+
+func get(c *cache.Cache, u http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	c.Serve(w, r, "pool", u)
+
+	return w
+}
+
+func TestCacheFreshness(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		wantRequests int64
+	}{
+		{name: "max-age", cacheControl: "max-age=60", wantRequests: 1},
+		{name: "s-maxage", cacheControl: "public, s-maxage=60", wantRequests: 1},
+		{name: "no-store", cacheControl: "max-age=60, no-store", wantRequests: 3},
+		{name: "private", cacheControl: "private, max-age=60", wantRequests: 3},
+		{name: "expired", cacheControl: "max-age=0", wantRequests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCache(t, cache.Options{})
+			u := &upstream{header: http.Header{"Cache-Control": {tt.cacheControl}}}
+
+			var last *httptest.ResponseRecorder
+			for range 3 {
+				last = get(c, u, "/data", nil)
+			}
+
+			assert.Equal(t, tt.wantRequests, u.requests.Load())
+			assert.Equal(t, http.StatusOK, last.Code)
+			assert.Equal(t, "/data  #"+strconv.FormatInt(tt.wantRequests, 10), last.Body.String())
+		})
+	}
+}
+
+func TestCacheHitHeaders(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{})
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=60"}, "Etag": {etag}}}
+
+	miss := get(c, u, "/data", nil)
+	assert.Equal(t, "balancer; fwd=miss; fwd-status=200; stored", miss.Header().Get("Cache-Status"))
+
+	hit := get(c, u, "/data", nil)
+	assert.Equal(t, "0", hit.Header().Get("Age"))
+	assert.Contains(t, hit.Header().Get("Cache-Status"), "balancer; hit; ttl=")
+
+	notModified := get(c, u, "/data", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+
+	bypass := get(c, u, "/data", http.Header{"Cache-Control": {"no-cache"}})
+	assert.Equal(t, "balancer; fwd=request; fwd-status=304", bypass.Header().Get("Cache-Status"))
+	assert.Equal(t, "/data  #1", bypass.Body.String())
+
+	assert.Equal(t, int64(2), u.requests.Load())
+}
+
+func TestCacheVary(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{})
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}}
+
+	en := http.Header{"Accept-Language": {"en"}}
+	ru := http.Header{"Accept-Language": {"ru"}}
+
+	assert.Equal(t, "/data en #1", get(c, u, "/data", en).Body.String())
+	assert.Equal(t, "/data ru #2", get(c, u, "/data", ru).Body.String())
+	assert.Equal(t, "/data en #1", get(c, u, "/data", en).Body.String())
+	assert.Equal(t, "/data ru #2", get(c, u, "/data", ru).Body.String())
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{})
+	u := &upstream{header: http.Header{"Cache-Control": {"no-cache"}, "Etag": {etag}}}
+
+	get(c, u, "/data", nil)
+
+	w := get(c, u, "/data", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/data  #1", w.Body.String())
+	assert.Equal(t, "balancer; fwd=stale; fwd-status=304", w.Header().Get("Cache-Status"))
+
+	assert.Equal(t, int64(2), u.requests.Load())
+	assert.Equal(t, int64(1), c.Stats().Revalidated)
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{})
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=0, stale-while-revalidate=60"}}}
+
+	get(c, u, "/data", nil)
+
+	// served stale, while the response is refreshed in background
+	assert.Equal(t, "/data  #1", get(c, u, "/data", nil).Body.String())
+
+	assert.Eventually(t, func() bool {
+		return get(c, u, "/data", nil).Body.String() == "/data  #2"
+	}, time.Second, time.Millisecond*10)
+
+	assert.Positive(t, c.Stats().StaleHits)
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{})
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=60"}}}
+
+	get(c, u, "/data", nil)
+	get(c, u, "/other", nil)
+
+	c.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/data", nil), "pool", u)
+	assert.Equal(t, "/data  #4", get(c, u, "/data", nil).Body.String())
+	assert.Equal(t, "/other  #2", get(c, u, "/other", nil).Body.String())
+
+	assert.Equal(t, 2, c.Purge("", "/"))
+	assert.Equal(t, "/other  #5", get(c, u, "/other", nil).Body.String())
+}
+
+func TestCacheDiskTier(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(t, cache.Options{
+		MaxBytes:     128,
+		DiskDir:      t.TempDir(),
+		DiskMaxBytes: 1 << 20,
+	})
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=60"}}}
+
+	get(c, u, "/first", nil)
+	get(c, u, "/second", nil)
+
+	stats := c.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, 1, stats.DiskEntries)
+
+	assert.Equal(t, "/first  #1", get(c, u, "/first", nil).Body.String())
+	assert.Equal(t, "/second  #2", get(c, u, "/second", nil).Body.String())
+	assert.Equal(t, int64(2), u.requests.Load())
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// heuristicFraction is a share of the time since Last-Modified, used as a heuristic freshness lifetime.
+	heuristicFraction = 10
+	maxHeuristicAge   = 24 * time.Hour
+)
+
+// cacheableByDefault are statuses, that can be stored with heuristic freshness (RFC 9110, section 15.1).
+var cacheableByDefault = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// directives are parsed Cache-Control directives, names are lowercase, values are unquoted.
+type directives map[string]string
+
+func parseDirectives(h http.Header) directives {
+	res := make(directives)
+
+	for _, line := range h.Values("Cache-Control") {
+		for part := range strings.SplitSeq(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+
+			res[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+
+	return res
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	raw, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// requestNoCache checks if the client requires revalidation with the backend.
+func requestNoCache(h http.Header, d directives) bool {
+	if d.has("no-cache") {
+		return true
+	}
+
+	if maxAge, ok := d.seconds("max-age"); ok && maxAge == 0 {
+		return true
+	}
+
+	// Pragma is only considered when Cache-Control is absent (RFC 9111, section 5.4)
+	return len(h.Values("Cache-Control")) == 0 && strings.EqualFold(h.Get("Pragma"), "no-cache")
+}
+
+// storable checks if a shared cache may store the response to the request (RFC 9111, section 3).
+func storable(r *http.Request, status int, h http.Header, d directives) bool {
+	if status < http.StatusOK || status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+
+	if d.has("no-store") || d.has("private") || h.Get("Vary") == "*" || h.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	if parseDirectives(r.Header).has("no-store") {
+		return false
+	}
+
+	if r.Header.Get("Authorization") != "" &&
+		!d.has("public") && !d.has("s-maxage") && !d.has("must-revalidate") {
+		return false
+	}
+
+	if d.has("public") || d.has("s-maxage") || d.has("max-age") || h.Get("Expires") != "" {
+		return true
+	}
+
+	return cacheableByDefault[status]
+}
+
+// freshnessLifetime returns how long the response is fresh after it was generated (RFC 9111, section 4.2.1).
+func freshnessLifetime(status int, h http.Header, d directives) time.Duration {
+	if sMaxAge, ok := d.seconds("s-maxage"); ok {
+		return sMaxAge
+	}
+
+	if maxAge, ok := d.seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date := parseHTTPDate(h.Get("Date"))
+
+	if raw := h.Get("Expires"); raw != "" {
+		// invalid dates, e.g. "0", mean already expired
+		expires := parseHTTPDate(raw)
+		if expires.IsZero() || date.IsZero() {
+			return 0
+		}
+
+		return max(expires.Sub(date), 0)
+	}
+
+	lastModified := parseHTTPDate(h.Get("Last-Modified"))
+	if !cacheableByDefault[status] || lastModified.IsZero() || date.IsZero() {
+		return 0
+	}
+
+	return min(max(date.Sub(lastModified), 0)/heuristicFraction, maxHeuristicAge)
+}
+
+func parseHTTPDate(raw string) time.Time {
+	if raw == "" {
+		return time.Time{}
+	}
+
+	t, err := http.ParseTime(raw)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// unsafeMethod checks if the request can change the resource, so stored responses are invalidated.
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+
+	return true
+}
+
+// etagMatches checks If-None-Match header against the entity tag with weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
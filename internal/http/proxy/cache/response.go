@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// newEntry creates an entry from the response, received at responseTime for the request sent at requestTime.
+func newEntry(m meta, status int, h http.Header, body []byte, requestTime, responseTime time.Time) *entry {
+	e := &entry{
+		Resource:     m,
+		Status:       status,
+		Header:       h,
+		Body:         body,
+		ResponseTime: responseTime,
+	}
+
+	e.Header.Del("Cache-Status")
+	e.setFreshness(requestTime)
+
+	return e
+}
+
+// setFreshness calculates the age and freshness of the stored response (RFC 9111, sections 4.2.1 and 4.2.3).
+func (e *entry) setFreshness(requestTime time.Time) {
+	d := parseDirectives(e.Header)
+
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	var apparentAge time.Duration
+	if date := parseHTTPDate(e.Header.Get("Date")); !date.IsZero() {
+		apparentAge = max(e.ResponseTime.Sub(date), 0)
+	}
+
+	responseDelay := e.ResponseTime.Sub(requestTime)
+
+	e.InitialAge = max(apparentAge, ageValue+responseDelay)
+	e.Lifetime = freshnessLifetime(e.Status, e.Header, d)
+	e.NoCache = d.has("no-cache")
+	e.MustRevalidate = d.has("must-revalidate") || d.has("proxy-revalidate") || d.has("s-maxage")
+	e.StaleWhileRevalidate, _ = d.seconds("stale-while-revalidate")
+
+	e.Header.Del("Age")
+}
+
+// update returns a copy of the entry with headers of the not modified response (RFC 9111, section 4.3.4).
+func (e *entry) update(h http.Header, requestTime, responseTime time.Time) *entry {
+	updated := &entry{
+		Resource:     e.Resource,
+		Status:       e.Status,
+		Header:       e.Header.Clone(),
+		Body:         e.Body,
+		ResponseTime: responseTime,
+	}
+
+	for name, values := range h {
+		if name == "Content-Length" {
+			continue
+		}
+
+		updated.Header[name] = values
+	}
+
+	updated.setFreshness(requestTime)
+
+	return updated
+}
+
+// conditionalRequest returns a request, that validates the stored response with its ETag or Last-Modified.
+// Conditions of the client are replaced, as the stored response is served to it.
+func conditionalRequest(ctx context.Context, r *http.Request, e *entry) *http.Request {
+	out := r.Clone(ctx)
+	out.Body = http.NoBody
+
+	out.Header.Del("If-None-Match")
+	out.Header.Del("If-Modified-Since")
+
+	if etag := e.Header.Get("ETag"); etag != "" {
+		out.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		out.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return out
+}
+
+// writeEntry sends the stored response, or 304 if it satisfies conditions of the request.
+func writeEntry(w http.ResponseWriter, r *http.Request, e *entry, now time.Time, cacheStatus string) {
+	h := w.Header()
+	for name, values := range e.Header {
+		h[name] = append([]string(nil), values...)
+	}
+
+	h.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	h.Set("Cache-Status", cacheStatus)
+
+	if notModified(r, e) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.WriteHeader(e.Status)
+
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.Body)
+	}
+}
+
+// notModified evaluates If-None-Match or If-Modified-Since of the request (RFC 9110, section 13.2.2).
+func notModified(r *http.Request, e *entry) bool {
+	if e.Status != http.StatusOK {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, e.Header.Get("ETag"))
+	}
+
+	since := parseHTTPDate(r.Header.Get("If-Modified-Since"))
+	lastModified := parseHTTPDate(e.Header.Get("Last-Modified"))
+
+	return !since.IsZero() && !lastModified.IsZero() && !lastModified.After(since)
+}
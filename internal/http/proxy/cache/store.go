@@ -0,0 +1,366 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const entryFileExt = ".entry"
+
+// meta identifies the resource, that a stored response belongs to.
+type meta struct {
+	Pool string
+	Host string
+	URI  string // path with query
+}
+
+// entry is a stored response. Fields are exported for gob encoding of the disk tier.
+type entry struct {
+	Resource meta
+	Key      string
+	// Vary marks entries, that only point to variants, stored under keys with the values of these request headers.
+	Vary         []string
+	Status       int
+	Header       http.Header
+	Body         []byte
+	ResponseTime time.Time
+	// InitialAge is the age of the response, when it was received (RFC 9111, section 4.2.3).
+	InitialAge time.Duration
+	Lifetime   time.Duration
+	// NoCache requires revalidation on every request, MustRevalidate forbids serving it stale.
+	NoCache              bool
+	MustRevalidate       bool
+	StaleWhileRevalidate time.Duration
+}
+
+func (e *entry) size() int64 {
+	size := len(e.Key) + len(e.Body)
+
+	for name, values := range e.Header {
+		for _, v := range values {
+			size += len(name) + len(v)
+		}
+	}
+
+	return int64(size)
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return e.InitialAge + max(now.Sub(e.ResponseTime), 0)
+}
+
+func (e *entry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// memoryStore is an LRU of entries, limited by their total size.
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	lru      *list.List
+}
+
+func newMemoryStore(maxBytes int64) *memoryStore {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (s *memoryStore) get(key string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	s.lru.MoveToFront(el)
+
+	//nolint:forcetypeassert
+	return el.Value.(*entry), true
+}
+
+// set stores the entry and returns the entries evicted to fit it.
+func (s *memoryStore) set(e *entry) []*entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(e.Key)
+
+	s.items[e.Key] = s.lru.PushFront(e)
+	s.size += e.size()
+
+	var evicted []*entry
+
+	for s.size > s.maxBytes && s.lru.Len() > 1 {
+		//nolint:forcetypeassert
+		oldest := s.lru.Back().Value.(*entry)
+		s.removeLocked(oldest.Key)
+
+		evicted = append(evicted, oldest)
+	}
+
+	return evicted
+}
+
+func (s *memoryStore) removeLocked(key string) {
+	el, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	//nolint:forcetypeassert
+	s.size -= el.Value.(*entry).size()
+	s.lru.Remove(el)
+	delete(s.items, key)
+}
+
+// removeFunc removes entries, that match the function, and returns their amount.
+func (s *memoryStore) removeFunc(match func(meta) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+
+	for key, el := range s.items {
+		//nolint:forcetypeassert
+		if match(el.Value.(*entry).Resource) {
+			s.removeLocked(key)
+
+			removed++
+		}
+	}
+
+	return removed
+}
+
+func (s *memoryStore) stats() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len(), s.size
+}
+
+// diskItem is an index record of an entry file.
+type diskItem struct {
+	meta
+
+	key  string
+	size int64
+}
+
+// diskStore keeps entries evicted from memory in files, limited by their total size.
+// The index is kept in memory, so files from previous runs are removed on start.
+type diskStore struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+func newDiskStore(dir string, maxBytes int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+entryFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache directory: %w", err)
+	}
+
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale cache entry: %w", err)
+		}
+	}
+
+	return &diskStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}, nil
+}
+
+func (s *diskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+entryFileExt)
+}
+
+// get reads the entry, it's removed from the disk, as it's moved back to memory.
+func (s *diskStore) get(key string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok {
+		return nil, nil //nolint:nilnil
+	}
+
+	raw, err := os.ReadFile(s.path(key))
+
+	s.removeLocked(key)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache entry: %w", err)
+	}
+
+	var e entry
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&e); err != nil {
+		return nil, fmt.Errorf("error decoding cache entry: %w", err)
+	}
+
+	return &e, nil
+}
+
+func (s *diskStore) set(e *entry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+
+	if int64(buf.Len()) > s.maxBytes {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(e.Key)
+
+	// written to a temporary file first, so readers never see partial entries
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating cache entry: %w", err)
+	}
+
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(e.Key))
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	s.items[e.Key] = s.lru.PushFront(&diskItem{meta: e.Resource, key: e.Key, size: int64(buf.Len())})
+	s.size += int64(buf.Len())
+
+	for s.size > s.maxBytes {
+		//nolint:forcetypeassert
+		s.removeLocked(s.lru.Back().Value.(*diskItem).key)
+	}
+
+	return nil
+}
+
+func (s *diskStore) removeLocked(key string) {
+	el, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	//nolint:forcetypeassert
+	s.size -= el.Value.(*diskItem).size
+	s.lru.Remove(el)
+	delete(s.items, key)
+
+	_ = os.Remove(s.path(key))
+}
+
+func (s *diskStore) removeFunc(match func(meta) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+
+	for key, el := range s.items {
+		//nolint:forcetypeassert
+		if match(el.Value.(*diskItem).meta) {
+			s.removeLocked(key)
+
+			removed++
+		}
+	}
+
+	return removed
+}
+
+func (s *diskStore) stats() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len(), s.size
+}
+
+// variantKey returns a key of the variant, selected by the request headers listed in Vary.
+func variantKey(key string, vary []string, h http.Header) string {
+	var b strings.Builder
+
+	b.WriteString(key)
+
+	for _, name := range vary {
+		b.WriteString("\x00")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString("=")
+		b.WriteString(normalizeHeader(h.Values(name)))
+	}
+
+	return b.String()
+}
+
+// normalizeHeader joins header values, removing whitespace around list items.
+func normalizeHeader(values []string) string {
+	items := make([]string, 0, len(values))
+
+	for _, v := range values {
+		for item := range strings.SplitSeq(v, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+
+	return strings.Join(items, ",")
+}
+
+// varyHeaders returns header names listed in Vary of the response.
+func varyHeaders(h http.Header) []string {
+	var res []string
+
+	for _, v := range h.Values("Vary") {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				res = append(res, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return res
+}
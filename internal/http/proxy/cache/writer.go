@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+)
+
+// captureWriter passes the backend response to the client and keeps a copy for storing it.
+// Not modified responses to revalidation requests are held back, so the stored response is sent instead.
+type captureWriter struct {
+	http.ResponseWriter
+
+	header     http.Header
+	maxBytes   int64
+	revalidate bool
+	// onHeader decides whether the response is stored and returns a value of Cache-Status header.
+	onHeader    func(status int, h http.Header) string
+	wroteHeader bool
+
+	status      int
+	notModified bool
+	body        bytes.Buffer
+	tooLarge    bool
+}
+
+func newCaptureWriter(w http.ResponseWriter, maxBytes int64, revalidate bool) *captureWriter {
+	return &captureWriter{
+		ResponseWriter: w,
+		header:         make(http.Header),
+		maxBytes:       maxBytes,
+		revalidate:     revalidate,
+	}
+}
+
+// Header returns own headers until the response is passed, then headers of the wrapped writer,
+// so trailers set after the body still reach the client.
+func (cw *captureWriter) Header() http.Header {
+	if cw.wroteHeader && !cw.notModified {
+		return cw.ResponseWriter.Header()
+	}
+
+	return cw.header
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	// informational responses are followed by the final one
+	if status < http.StatusOK {
+		maps.Copy(cw.ResponseWriter.Header(), cw.header)
+		cw.ResponseWriter.WriteHeader(status)
+
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = status
+
+	if cw.revalidate && status == http.StatusNotModified {
+		cw.notModified = true
+		return
+	}
+
+	var cacheStatus string
+	if cw.onHeader != nil {
+		cacheStatus = cw.onHeader(status, cw.header)
+	}
+
+	// the stored copy is kept separately from headers, that are changed later by wrapping writers
+	dst := cw.ResponseWriter.Header()
+	maps.Copy(dst, cw.header.Clone())
+
+	if cacheStatus != "" {
+		dst.Set("Cache-Status", cacheStatus)
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.notModified {
+		return len(b), nil
+	}
+
+	if !cw.tooLarge {
+		if int64(cw.body.Len()+len(b)) > cw.maxBytes {
+			cw.tooLarge = true
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(b)
+		}
+	}
+
+	//nolint:wrapcheck
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the flusher of the wrapped writer.
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// discardWriter is a client of background revalidations.
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header {
+	return dw.header
+}
+
+func (dw *discardWriter) WriteHeader(int) {}
+
+func (dw *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,351 @@
+// Package coalesce contains collapsing of identical concurrent requests into one upstream request.
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/accesslog"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+var logger = logging.Component(logging.ProxyComponent)
+
+var (
+	// errTooLarge is returned by the shared request, when the response can't be buffered for all waiters.
+	errTooLarge = errors.New("response is too large to share")
+	// errAborted is returned by the shared request, when the handler was aborted,
+	// e.g. the backend failed in the middle of the body.
+	errAborted = errors.New("shared request was aborted")
+)
+
+// DefaultMaxBytes limits shared responses, when no limit is configured.
+const DefaultMaxBytes = 1 << 20
+
+// DefaultVaryHeaders are request headers, that are part of the key when no headers are configured.
+var DefaultVaryHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// conditionalHeaders change the response to 304, so they are always part of the key.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+// clientHeaders identify the client, so they are always part of the key.
+var clientHeaders = []string{"Rate-Limit-Key"}
+
+// Options contains settings of request coalescing.
+type Options struct {
+	// VaryHeaders are request headers, that must be equal in requests sharing a response.
+	VaryHeaders []string
+	// MaxBytes limits a shared response body, requests with larger responses are sent separately.
+	// DefaultMaxBytes is used if it's 0.
+	MaxBytes int64
+	// IdentityHeaders identify clients to backends, e.g. the header with the client certificate identity.
+	// They are part of the key, like the Rate-Limit-Key header.
+	IdentityHeaders []string
+	// PerClient shares responses only between requests of the same client, it's needed
+	// when requests to the backend depend on the client, e.g. rewritten headers contain the client IP.
+	PerClient bool
+	// Timeout limits the shared request like the route timeout limits separate ones, 0 means no limit.
+	Timeout time.Duration
+}
+
+// flight is a shared upstream request, it's canceled when all waiting requests are gone.
+type flight struct {
+	ctx     context.Context //nolint:containedctx
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// response is a buffered upstream response, that is sent to every waiting request.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+	// own is set for problem details of the proxy, so they are replayed as such
+	own bool
+}
+
+// Group collapses concurrent identical GET requests, so only one of them reaches the backend.
+// Requests with credentials, cookies, ranges, upgrades or expecting event streams are always sent separately.
+type Group struct {
+	opts  Options
+	group singleflight.Group
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// New creates a new request coalescing group.
+func New(opts Options) *Group {
+	if len(opts.VaryHeaders) == 0 {
+		opts.VaryHeaders = DefaultVaryHeaders
+	}
+
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+
+	return &Group{
+		opts:    opts,
+		flights: make(map[string]*flight),
+	}
+}
+
+// Middleware shares responses of the next handler between identical concurrent requests.
+// Every request waits for the shared response until its own context is done.
+func (g *Group) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !eligible(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := g.key(r)
+
+		f, ch := g.join(key, r, next)
+		defer g.leave(key, f)
+
+		select {
+		case <-r.Context().Done():
+			status := http.StatusGatewayTimeout
+			if errors.Is(r.Context().Err(), context.Canceled) {
+				status = problem.StatusClientClosedRequest
+			}
+
+			problem.WriteRequest(w, r,
+				"Upstream request failed",
+				"Request was not completed before its deadline or cancellation",
+				status,
+			)
+		case res := <-ch:
+			accesslog.CopyUpstream(r.Context(), f.ctx)
+
+			if errors.Is(res.Err, errTooLarge) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if res.Err != nil {
+				problem.WriteRequest(w, r,
+					"Bad gateway",
+					"Backend response was interrupted",
+					http.StatusBadGateway,
+				)
+
+				return
+			}
+
+			//nolint:forcetypeassert
+			writeResponse(w, res.Val.(*response))
+		}
+	})
+}
+
+// join registers the request as a waiter of the shared request. If it doesn't exist, the request becomes a leader,
+// that starts it.
+func (g *Group) join(key string, r *http.Request, next http.Handler) (*flight, <-chan singleflight.Result) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, ok := g.flights[key]
+	if !ok {
+		// the shared request keeps values of the first client, but it's detached from its cancellation,
+		// as the client may leave before others, and from its access log entry
+		ctx := accesslog.Detach(context.WithoutCancel(r.Context()))
+
+		var cancel context.CancelFunc
+		if g.opts.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, g.opts.Timeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+
+		f = &flight{ctx: ctx, cancel: cancel}
+		g.flights[key] = f
+	}
+
+	f.waiters++
+
+	// singleflight is called under the lock, so flights always match its calls
+	ch := g.group.DoChan(key, func() (any, error) {
+		defer g.finish(key, f)
+
+		return g.do(r.Clone(f.ctx), next)
+	})
+
+	return f, ch
+}
+
+// do sends the shared request, panics of the handler are returned as errors,
+// as singleflight repanics them in a goroutine.
+func (g *Group) do(r *http.Request, next http.Handler) (res *response, err error) {
+	rec := &recorder{header: make(http.Header), maxBytes: g.opts.MaxBytes}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if p != http.ErrAbortHandler { //nolint:errorlint,err113
+				logger.Error("shared request panicked", slog.Any("panic", p))
+			}
+
+			res, err = nil, errAborted
+		}
+
+		if rec.tooLarge {
+			res, err = nil, errTooLarge
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+
+	if !rec.wroteHeader {
+		rec.status = http.StatusOK
+	}
+
+	return &response{status: rec.status, header: rec.header, body: rec.body.Bytes(), own: rec.own}, nil
+}
+
+// leave removes the waiter, the shared request is canceled when nobody waits for it.
+func (g *Group) leave(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+
+	f.cancel()
+
+	// new requests must not join the canceled one
+	if g.flights[key] == f {
+		delete(g.flights, key)
+		g.group.Forget(key)
+	}
+}
+
+func (g *Group) finish(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.flights[key] == f {
+		delete(g.flights, key)
+		g.group.Forget(key)
+	}
+}
+
+func (g *Group) key(r *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(r.Method)
+	b.WriteString(" ")
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.RequestURI())
+
+	for _, headers := range [][]string{g.opts.VaryHeaders, conditionalHeaders, clientHeaders, g.opts.IdentityHeaders} {
+		for _, name := range headers {
+			b.WriteString("\x00")
+			b.WriteString(strings.Join(r.Header.Values(name), ","))
+		}
+	}
+
+	// clients with certificates are identified by them, even if the identity isn't forwarded in a header
+	if g.opts.PerClient || (r.TLS != nil && len(r.TLS.PeerCertificates) > 0) {
+		client, _ := r.Context().Value(middleware.ClientCtxKey{}).(string)
+
+		clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientIP = r.RemoteAddr
+		}
+
+		b.WriteString("\x00")
+		b.WriteString(clientIP)
+		b.WriteString("\x00")
+		b.WriteString(client)
+	}
+
+	return b.String()
+}
+
+// eligible checks if the request can share a response with other clients.
+func eligible(r *http.Request) bool {
+	if r.Method != http.MethodGet || (r.ContentLength != 0 && r.Body != http.NoBody && r.Body != nil) {
+		return false
+	}
+
+	for _, name := range []string{"Authorization", "Cookie", "Range", "Upgrade"} {
+		if r.Header.Get(name) != "" {
+			return false
+		}
+	}
+
+	return !strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func writeResponse(w http.ResponseWriter, res *response) {
+	if res.own {
+		problem.MarkOwn(w)
+	}
+
+	h := w.Header()
+	for name, values := range res.header {
+		h[name] = append([]string(nil), values...)
+	}
+
+	w.WriteHeader(res.status)
+	_, _ = w.Write(res.body)
+}
+
+// recorder buffers the upstream response.
+type recorder struct {
+	header      http.Header
+	maxBytes    int64
+	wroteHeader bool
+	status      int
+	body        bytes.Buffer
+	tooLarge    bool
+	own         bool
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader || status < http.StatusOK {
+		return
+	}
+
+	rec.wroteHeader = true
+	rec.status = status
+}
+
+func (rec *recorder) MarkOwn() {
+	rec.own = true
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	// the error stops copying of the body, so requests are sent separately sooner
+	if rec.tooLarge || int64(rec.body.Len()+len(b)) > rec.maxBytes {
+		rec.tooLarge = true
+		rec.body = bytes.Buffer{}
+
+		return 0, errTooLarge
+	}
+
+	//nolint:wrapcheck
+	return rec.body.Write(b)
+}
@@ -0,0 +1,329 @@
+package coalesce_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/accesslog"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/coalesce"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+)
+
+// slowUpstream responds with the body after release is closed and counts requests.
+type slowUpstream struct {
+	requests atomic.Int64
+	release  chan struct{}
+	body     string
+}
+
+func (u *slowUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.requests.Add(1)
+
+	select {
+	case <-u.release:
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("X-Upstream", "1")
+	_, _ = io.WriteString(w, u.body)
+}
+
+// serveConcurrently sends the requests at the same time and releases upstream after they are waiting.
+func serveConcurrently(h http.Handler, u *slowUpstream, reqs []*http.Request) []*httptest.ResponseRecorder {
+	res := make([]*httptest.ResponseRecorder, len(reqs))
+
+	var wg sync.WaitGroup
+
+	for i, r := range reqs {
+		res[i] = httptest.NewRecorder()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(res[i], r)
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	close(u.release)
+	wg.Wait()
+
+	return res
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		header       [3]http.Header
+		wantRequests int64
+	}{
+		{
+			name:         "identical",
+			wantRequests: 1,
+		},
+		{
+			name: "different vary headers",
+			header: [3]http.Header{
+				{"Accept-Language": {"en"}},
+				{"Accept-Language": {"ru"}},
+				{"Accept-Language": {"en"}},
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "credentials",
+			header: [3]http.Header{
+				{"Authorization": {"Bearer a"}},
+				{"Authorization": {"Bearer a"}},
+				{"Cookie": {"session=a"}},
+			},
+			wantRequests: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			u := &slowUpstream{release: make(chan struct{}), body: "shared"}
+			g := coalesce.New(coalesce.Options{})
+
+			reqs := make([]*http.Request, 0, len(tt.header))
+			for _, h := range tt.header {
+				r := httptest.NewRequest(http.MethodGet, "/data", nil)
+				for name, values := range h {
+					r.Header[name] = values
+				}
+
+				reqs = append(reqs, r)
+			}
+
+			for _, w := range serveConcurrently(g.Middleware(u), u, reqs) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "shared", w.Body.String())
+				assert.Equal(t, "1", w.Header().Get("X-Upstream"))
+			}
+
+			assert.Equal(t, tt.wantRequests, u.requests.Load())
+		})
+	}
+}
+
+// clientRequest returns a request of the client, identified like by the client extractor of the proxy.
+func clientRequest(remoteAddr, client string, cert *x509.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/data", nil)
+	r.RemoteAddr = remoteAddr
+
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClientCtxKey{}, client))
+}
+
+func TestGroupClients(t *testing.T) {
+	t.Parallel()
+
+	partnerA := &x509.Certificate{Subject: pkix.Name{CommonName: "partner-a"}}
+	partnerB := &x509.Certificate{Subject: pkix.Name{CommonName: "partner-b"}}
+
+	withHeader := func(r *http.Request, name, value string) *http.Request {
+		r.Header.Set(name, value)
+		return r
+	}
+
+	tests := []struct {
+		name         string
+		opts         coalesce.Options
+		reqs         []*http.Request
+		wantRequests int64
+	}{
+		{
+			name: "client certificates",
+			reqs: []*http.Request{
+				clientRequest("10.0.0.1:1000", "partner-a", partnerA),
+				clientRequest("10.0.0.1:1001", "partner-b", partnerB),
+				clientRequest("10.0.0.1:1002", "partner-a", partnerA),
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "rate limit keys",
+			reqs: []*http.Request{
+				withHeader(clientRequest("10.0.0.1:1000", "a", nil), "Rate-Limit-Key", "a"),
+				withHeader(clientRequest("10.0.0.2:1000", "b", nil), "Rate-Limit-Key", "b"),
+				withHeader(clientRequest("10.0.0.3:1000", "a", nil), "Rate-Limit-Key", "a"),
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "identity headers",
+			opts: coalesce.Options{IdentityHeaders: []string{"X-Client-Identity"}},
+			reqs: []*http.Request{
+				withHeader(clientRequest("10.0.0.1:1000", "10.0.0.1:1000", nil), "X-Client-Identity", "a"),
+				withHeader(clientRequest("10.0.0.1:1001", "10.0.0.1:1001", nil), "X-Client-Identity", "b"),
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "per client",
+			opts: coalesce.Options{PerClient: true},
+			reqs: []*http.Request{
+				clientRequest("10.0.0.1:1000", "a", nil),
+				clientRequest("10.0.0.2:1000", "a", nil),
+				clientRequest("10.0.0.1:1001", "a", nil),
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "anonymous clients",
+			reqs: []*http.Request{
+				clientRequest("10.0.0.1:1000", "10.0.0.1:1000", nil),
+				clientRequest("10.0.0.2:1000", "10.0.0.2:1000", nil),
+			},
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			u := &slowUpstream{release: make(chan struct{}), body: "shared"}
+			g := coalesce.New(tt.opts)
+
+			for _, w := range serveConcurrently(g.Middleware(u), u, tt.reqs) {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+
+			assert.Equal(t, tt.wantRequests, u.requests.Load())
+		})
+	}
+}
+
+func TestGroupCancellation(t *testing.T) {
+	t.Parallel()
+
+	u := &slowUpstream{release: make(chan struct{}), body: "shared"}
+	g := coalesce.New(coalesce.Options{})
+
+	// the first request starts the shared one and leaves before the response
+	ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond*10)
+	defer cancel()
+
+	reqs := []*http.Request{
+		httptest.NewRequestWithContext(ctx, http.MethodGet, "/data", nil),
+		httptest.NewRequest(http.MethodGet, "/data", nil),
+	}
+
+	res := serveConcurrently(g.Middleware(u), u, reqs)
+
+	assert.Equal(t, http.StatusGatewayTimeout, res[0].Code)
+	assert.Equal(t, http.StatusOK, res[1].Code)
+	assert.Equal(t, "shared", res[1].Body.String())
+	assert.Equal(t, int64(1), u.requests.Load())
+}
+
+func TestGroupTooLarge(t *testing.T) {
+	t.Parallel()
+
+	u := &slowUpstream{release: make(chan struct{}), body: strings.Repeat("a", 2048)}
+	g := coalesce.New(coalesce.Options{MaxBytes: 1024})
+
+	reqs := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/data", nil),
+		httptest.NewRequest(http.MethodGet, "/data", nil),
+	}
+
+	for _, w := range serveConcurrently(g.Middleware(u), u, reqs) {
+		assert.Equal(t, u.body, w.Body.String())
+	}
+
+	assert.Equal(t, int64(3), u.requests.Load())
+}
+
+type bufferSink struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *bufferSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.Write(p)
+}
+
+func (s *bufferSink) Close() error { return nil }
+
+func TestGroupAccessLog(t *testing.T) {
+	t.Parallel()
+
+	u := &slowUpstream{release: make(chan struct{}), body: "shared"}
+	g := coalesce.New(coalesce.Options{})
+
+	f, err := accesslog.NewTemplateFormatter("{{.Backend}} {{.UpstreamLatency}}")
+	require.NoError(t, err)
+
+	sink := &bufferSink{}
+	l, err := accesslog.New(f, sink, accesslog.Options{})
+	require.NoError(t, err)
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accesslog.SetBackend(r.Context(), "localhost:8081")
+		accesslog.SetUpstreamLatency(r.Context(), time.Millisecond*15)
+		u.ServeHTTP(w, r)
+	})
+
+	reqs := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/data", nil),
+		httptest.NewRequest(http.MethodGet, "/data", nil),
+	}
+
+	serveConcurrently(l.Middleware(g.Middleware(upstream)), u, reqs)
+	require.NoError(t, l.Close())
+
+	// every request sharing the response is logged with its backend
+	assert.Equal(t, "localhost:8081 15ms\nlocalhost:8081 15ms\n", sink.buf.String())
+	assert.Equal(t, int64(1), u.requests.Load())
+}
+
+func TestGroupTimeout(t *testing.T) {
+	t.Parallel()
+
+	g := coalesce.New(coalesce.Options{Timeout: time.Millisecond * 20})
+
+	var upstreamErr error
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		upstreamErr = r.Context().Err()
+
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+
+	w := httptest.NewRecorder()
+	g.Middleware(upstream).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data", nil))
+
+	// the shared request is bounded by the route timeout, though it's detached from the client
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.ErrorIs(t, upstreamErr, context.DeadlineExceeded)
+}
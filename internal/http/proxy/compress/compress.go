@@ -0,0 +1,350 @@
+// Package compress contains negotiated compression of responses and decompression of request bodies.
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+// A list of supported content encodings.
+const (
+	Brotli  = "br"
+	Zstd    = "zstd"
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// preferred are supported encodings in the order they are chosen, when the client accepts them equally.
+var preferred = []string{Brotli, Zstd, Gzip, Deflate}
+
+// A list of compression level limits.
+const (
+	MinLevel     = 1
+	MaxLevel     = 9
+	DefaultLevel = 5
+)
+
+// DefaultContentTypes are compressed, when no content types are configured.
+var DefaultContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"text/xml",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+var (
+	// ErrInvalidLevel is returned when the compression level is out of range.
+	ErrInvalidLevel = errors.New("invalid compression level")
+
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// Options contains settings of compression.
+type Options struct {
+	// Level from 1 (fastest) to 9 (best) is used as gzip and deflate (zlib) level, brotli quality and zstd level.
+	Level int
+	// MinSize is the smallest response body, that is compressed.
+	MinSize int
+	// ContentTypes are compressed media types, "text/*" matches all subtypes. DefaultContentTypes are used if empty.
+	ContentTypes []string
+	// DecompressRequests decodes request bodies with Content-Encoding, before they are sent to backends.
+	DecompressRequests bool
+	// MaxDecompressedBytes limits decoded request bodies, 0 means no limit.
+	MaxDecompressedBytes int64
+}
+
+// encoder is a compressing writer, that can be reused for other responses.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compressor compresses responses with the encoding, negotiated by Accept-Encoding.
+// Responses already encoded by backends are passed as is.
+type Compressor struct {
+	opts     Options
+	types    map[string]struct{}
+	wildcard []string // type prefixes of "type/*" entries, e.g. "text/"
+	encoders map[string]*sync.Pool
+}
+
+// New creates a new compressor.
+func New(opts Options) (*Compressor, error) {
+	if opts.Level < MinLevel || opts.Level > MaxLevel {
+		return nil, fmt.Errorf("%w: %d, must be from %d to %d", ErrInvalidLevel, opts.Level, MinLevel, MaxLevel)
+	}
+
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultContentTypes
+	}
+
+	c := &Compressor{
+		opts:  opts,
+		types: make(map[string]struct{}, len(opts.ContentTypes)),
+	}
+
+	for _, t := range opts.ContentTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			c.wildcard = append(c.wildcard, prefix)
+			continue
+		}
+
+		c.types[t] = struct{}{}
+	}
+
+	level := opts.Level
+	c.encoders = map[string]*sync.Pool{
+		Brotli: {New: func() any { return brotli.NewWriterLevel(nil, level) }},
+		Zstd: {New: func() any {
+			//nolint:errcheck // options are valid
+			enc, _ := zstd.NewWriter(nil,
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+				zstd.WithEncoderConcurrency(1),
+			)
+
+			return enc
+		}},
+		Gzip: {New: func() any {
+			//nolint:errcheck // level is validated
+			enc, _ := gzip.NewWriterLevel(nil, level)
+			return enc
+		}},
+		Deflate: {New: func() any {
+			//nolint:errcheck // level is validated
+			enc, _ := zlib.NewWriterLevel(nil, level)
+			return enc
+		}},
+	}
+
+	return c, nil
+}
+
+// Middleware decompresses request bodies if it's enabled and compresses responses.
+// Upgraded connections are passed as is.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.opts.DecompressRequests {
+			if ok := c.decompressRequest(w, r); !ok {
+				return
+			}
+		}
+
+		cw := &responseWriter{
+			ResponseWriter: w,
+			c:              c,
+			encoding:       negotiate(r.Header.Get("Accept-Encoding")),
+			head:           r.Method == http.MethodHead,
+		}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressible checks if the response can be compressed, such responses vary by Accept-Encoding.
+func (c *Compressor) compressible(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+
+	if encoding := h.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(strings.Join(h.Values("Cache-Control"), ",")), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	if _, ok := c.types[mediaType]; ok {
+		return true
+	}
+
+	for _, prefix := range c.wildcard {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Compressor) getEncoder(encoding string, w io.Writer) encoder {
+	//nolint:forcetypeassert
+	enc := c.encoders[encoding].Get().(encoder)
+	enc.Reset(w)
+
+	return enc
+}
+
+func (c *Compressor) putEncoder(encoding string, enc encoder) {
+	c.encoders[encoding].Put(enc)
+}
+
+// decompressRequest replaces the request body with the decoded one.
+// It responds with 415 to unknown encodings and returns false.
+func (c *Compressor) decompressRequest(w http.ResponseWriter, r *http.Request) bool {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+
+	decoded, err := newDecoder(encoding, r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUnsupportedEncoding) {
+			status = http.StatusUnsupportedMediaType
+		}
+
+		problem.WriteRequest(w, r,
+			"Invalid request body",
+			err.Error(),
+			status,
+		)
+
+		return false
+	}
+
+	if c.opts.MaxDecompressedBytes > 0 {
+		decoded = http.MaxBytesReader(w, decoded, c.opts.MaxDecompressedBytes)
+	}
+
+	r.Body = decoded
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+
+	return true
+}
+
+// readCloser closes both the decoder and the original body.
+type readCloser struct {
+	io.Reader
+
+	closers []io.Closer
+}
+
+func (rc *readCloser) Close() error {
+	var errs []error
+
+	for _, c := range rc.closers {
+		errs = append(errs, c.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func newDecoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case Gzip, "x-gzip":
+		dec, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gzip body: %w", err)
+		}
+
+		return &readCloser{Reader: dec, closers: []io.Closer{dec, body}}, nil
+	case Deflate:
+		dec, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading deflate body: %w", err)
+		}
+
+		return &readCloser{Reader: dec, closers: []io.Closer{dec, body}}, nil
+	case Brotli:
+		return &readCloser{Reader: brotli.NewReader(body), closers: []io.Closer{body}}, nil
+	case Zstd:
+		dec, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("error reading zstd body: %w", err)
+		}
+
+		return &readCloser{Reader: dec, closers: []io.Closer{dec.IOReadCloser(), body}}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", errUnsupportedEncoding, encoding)
+}
+
+// negotiate returns the supported encoding with the highest quality in Accept-Encoding, empty if there is none.
+func negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+
+	for item := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+
+		if raw, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+
+		qualities[name] = q
+	}
+
+	var (
+		best    string
+		bestQ   float64
+		hasBest bool
+	)
+
+	for _, encoding := range preferred {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > 0 && (!hasBest || q > bestQ) {
+			best, bestQ, hasBest = encoding, q, true
+		}
+	}
+
+	return best
+}
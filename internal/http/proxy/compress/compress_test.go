@@ -0,0 +1,269 @@
+package compress_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/compress"
+)
+
+var body = strings.Repeat("compressible text ", 128)
+
+func newCompressor(t *testing.T, opts compress.Options) *compress.Compressor {
+	t.Helper()
+
+	if opts.Level == 0 {
+		opts.Level = compress.DefaultLevel
+	}
+
+	if opts.MinSize == 0 {
+		opts.MinSize = 256
+	}
+
+	c, err := compress.New(opts)
+	require.NoError(t, err)
+
+	return c
+}
+
+// respond returns a handler, that writes the body with the headers.
+func respond(header http.Header, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+func decode(t *testing.T, encoding string, raw []byte) string {
+	t.Helper()
+
+	var r io.Reader
+
+	switch encoding {
+	case compress.Brotli:
+		r = brotli.NewReader(bytes.NewReader(raw))
+	case compress.Zstd:
+		dec, err := zstd.NewReader(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		defer dec.Close()
+
+		r = dec
+	case compress.Gzip:
+		dec, err := gzip.NewReader(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		r = dec
+	default:
+		r = bytes.NewReader(raw)
+	}
+
+	decoded, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(decoded)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := compress.New(compress.Options{Level: 10})
+	require.ErrorIs(t, err, compress.ErrInvalidLevel)
+}
+
+func TestCompressorNegotiation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{name: "none", acceptEncoding: "", wantEncoding: ""},
+		{name: "brotli preferred", acceptEncoding: "gzip, deflate, br, zstd", wantEncoding: compress.Brotli},
+		{name: "zstd", acceptEncoding: "gzip, zstd", wantEncoding: compress.Zstd},
+		{name: "gzip", acceptEncoding: "gzip", wantEncoding: compress.Gzip},
+		{name: "quality", acceptEncoding: "br;q=0.5, gzip;q=0.8", wantEncoding: compress.Gzip},
+		{name: "rejected", acceptEncoding: "br;q=0, gzip", wantEncoding: compress.Gzip},
+		{name: "wildcard", acceptEncoding: "*", wantEncoding: compress.Brotli},
+		{name: "unsupported", acceptEncoding: "compress", wantEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCompressor(t, compress.Options{})
+			h := c.Middleware(respond(http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, body))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, body, decode(t, tt.wantEncoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompressorSkip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+	}{
+		{
+			name:   "already encoded",
+			header: http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"gzip"}},
+			body:   body,
+		},
+		{
+			name:   "not allowed type",
+			header: http.Header{"Content-Type": {"image/png"}},
+			body:   body,
+		},
+		{
+			name:   "small",
+			header: http.Header{"Content-Type": {"text/plain"}},
+			body:   "small",
+		},
+		{
+			name:   "no-transform",
+			header: http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"no-transform"}},
+			body:   body,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCompressor(t, compress.Options{})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "br, gzip")
+
+			w := httptest.NewRecorder()
+			c.Middleware(respond(tt.header, tt.body)).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.header.Get("Content-Encoding"), w.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.body, w.Body.String())
+		})
+	}
+}
+
+func TestCompressorContentTypes(t *testing.T) {
+	t.Parallel()
+
+	c := newCompressor(t, compress.Options{ContentTypes: []string{"text/*"}})
+
+	for contentType, want := range map[string]string{"text/csv": compress.Gzip, "application/json": ""} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		w := httptest.NewRecorder()
+		c.Middleware(respond(http.Header{"Content-Type": {contentType}}, body)).ServeHTTP(w, r)
+
+		assert.Equal(t, want, w.Header().Get("Content-Encoding"), contentType)
+	}
+}
+
+func TestCompressorWeakETag(t *testing.T) {
+	t.Parallel()
+
+	c := newCompressor(t, compress.Options{})
+	h := c.Middleware(respond(http.Header{
+		"Content-Type":   {"application/json"},
+		"Content-Length": {"2304"},
+		"Etag":           {`"v1"`},
+	}, body))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "zstd")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, compress.Zstd, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, body, decode(t, compress.Zstd, w.Body.Bytes()))
+}
+
+func TestCompressorDecompressRequests(t *testing.T) {
+	t.Parallel()
+
+	var gzipped bytes.Buffer
+
+	enc := gzip.NewWriter(&gzipped)
+	_, _ = io.WriteString(enc, body)
+	require.NoError(t, enc.Close())
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		_, _ = io.WriteString(w, r.Header.Get("Content-Encoding")+":"+string(received))
+	})
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		maxBytes   int64
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipped.Bytes(), wantStatus: http.StatusOK, wantBody: ":" + body},
+		{name: "unsupported", encoding: "compress", body: []byte("x"), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "invalid", encoding: "gzip", body: []byte("not gzip"), wantStatus: http.StatusBadRequest},
+		{
+			name:       "too large",
+			encoding:   "gzip",
+			body:       gzipped.Bytes(),
+			maxBytes:   100,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCompressor(t, compress.Options{DecompressRequests: true, MaxDecompressedBytes: tt.maxBytes})
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Encoding", tt.encoding)
+
+			w := httptest.NewRecorder()
+			c.Middleware(echo).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package compress
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// responseWriter compresses the response, if it's compressible and not smaller than the minimum size.
+// Bodies without Content-Length are buffered until the minimum size is reached to decide.
+type responseWriter struct {
+	http.ResponseWriter
+
+	c        *Compressor
+	encoding string // negotiated encoding, empty if the client doesn't accept any
+	head     bool
+
+	wroteHeader bool
+	decided     bool
+	status      int
+	pending     []byte
+	enc         encoder
+}
+
+func (cw *responseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	// informational responses are followed by the final one
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = status
+
+	h := cw.Header()
+	if !cw.c.compressible(status, h) {
+		cw.passThrough()
+		return
+	}
+
+	addVary(h, "Accept-Encoding")
+
+	if cw.encoding == "" || cw.head {
+		cw.passThrough()
+		return
+	}
+
+	if raw := h.Get("Content-Length"); raw != "" {
+		length, err := strconv.ParseInt(raw, 10, 64)
+		if err == nil && length < int64(cw.c.opts.MinSize) {
+			cw.passThrough()
+			return
+		}
+
+		cw.startCompression()
+	}
+}
+
+func (cw *responseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.enc != nil {
+			//nolint:wrapcheck
+			return cw.enc.Write(b)
+		}
+
+		//nolint:wrapcheck
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.pending = append(cw.pending, b...)
+	if len(cw.pending) >= cw.c.opts.MinSize {
+		cw.startCompression()
+	}
+
+	return len(b), nil
+}
+
+// Flush starts compression of a pending body, as streamed responses can't wait for the minimum size.
+func (cw *responseWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.startCompression()
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the hijacker and deadlines of the wrapped writer.
+func (cw *responseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// passThrough sends the response without compression.
+func (cw *responseWriter) passThrough() {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.pending) > 0 {
+		_, _ = cw.ResponseWriter.Write(cw.pending)
+		cw.pending = nil
+	}
+}
+
+func (cw *responseWriter) startCompression() {
+	cw.decided = true
+
+	h := cw.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", cw.encoding)
+
+	// the compressed representation isn't byte-identical to the backend one
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.enc = cw.c.getEncoder(cw.encoding, cw.ResponseWriter)
+
+	if len(cw.pending) > 0 {
+		_, _ = cw.enc.Write(cw.pending)
+		cw.pending = nil
+	}
+}
+
+// close sends a pending body, which is smaller than the minimum size, and finishes compression.
+func (cw *responseWriter) close() {
+	if !cw.wroteHeader {
+		return
+	}
+
+	if !cw.decided {
+		cw.passThrough()
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.c.putEncoder(cw.encoding, cw.enc)
+		cw.enc = nil
+	}
+}
+
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for item := range strings.SplitSeq(v, ",") {
+			if item = strings.TrimSpace(item); item == "*" || strings.EqualFold(item, name) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", name)
+}
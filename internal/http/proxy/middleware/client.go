@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
 )
 
@@ -10,18 +11,72 @@ const rateLimitKeyHeader = "Rate-Limit-Key"
 // ClientCtxKey is a context key, used for retrieving client from context.
 type ClientCtxKey struct{}
 
+// CertIdentity extracts the client identity from a verified client certificate.
+type CertIdentity func(cert *x509.Certificate) string
+
+// SubjectIdentity identifies the client by the common name of the certificate subject,
+// the whole subject is used when common name is empty.
+func SubjectIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+
+	return cert.Subject.String()
+}
+
+// SANIdentity identifies the client by the first URI, DNS or email SAN of the certificate,
+// the subject is used when the certificate has no SANs.
+func SANIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+
+	return SubjectIdentity(cert)
+}
+
 // ClientExtractor is middleware for extracting client from the request.
 func ClientExtractor(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-
-		headerKey := r.Header.Get(rateLimitKeyHeader)
-		if headerKey != "" {
-			ctx = context.WithValue(ctx, ClientCtxKey{}, headerKey)
-		} else {
-			ctx = context.WithValue(ctx, ClientCtxKey{}, r.RemoteAddr)
-		}
-
+		ctx := context.WithValue(r.Context(), ClientCtxKey{}, clientFromRequest(r))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// ClientCertExtractor is ClientExtractor mode for mTLS listeners. Clients with a verified certificate
+// are identified by it and the identity is forwarded to backends in the header, other requests are
+// handled like in ClientExtractor. Client supplied values of the header are always removed.
+func ClientCertExtractor(identity CertIdentity, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if header != "" {
+				r.Header.Del(header)
+			}
+
+			client := clientFromRequest(r)
+
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				client = identity(r.TLS.VerifiedChains[0][0])
+
+				if header != "" {
+					r.Header.Set(header, client)
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), ClientCtxKey{}, client)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func clientFromRequest(r *http.Request) string {
+	if headerKey := r.Header.Get(rateLimitKeyHeader); headerKey != "" {
+		return headerKey
+	}
+
+	return r.RemoteAddr
+}
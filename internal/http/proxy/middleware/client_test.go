@@ -0,0 +1,105 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+)
+
+const identityHeader = "X-Client-Identity"
+
+// serve runs the request through the middleware and returns client and forwarded identity seen by the handler.
+func serve(mw func(http.Handler) http.Handler, r *http.Request) (string, string) {
+	var client, forwarded string
+
+	h := mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		client, _ = r.Context().Value(middleware.ClientCtxKey{}).(string)
+		forwarded = r.Header.Get(identityHeader)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	return client, forwarded
+}
+
+func TestClientCertExtractor(t *testing.T) {
+	t.Parallel()
+
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "partner-a"},
+		DNSNames: []string{"a.partners.example.com"},
+	}
+
+	tests := []struct {
+		name          string
+		identity      middleware.CertIdentity
+		verified      bool
+		wantClient    string
+		wantForwarded string
+	}{
+		{
+			name:          "subject",
+			identity:      middleware.SubjectIdentity,
+			verified:      true,
+			wantClient:    "partner-a",
+			wantForwarded: "partner-a",
+		},
+		{
+			name:          "san",
+			identity:      middleware.SANIdentity,
+			verified:      true,
+			wantClient:    "a.partners.example.com",
+			wantForwarded: "a.partners.example.com",
+		},
+		{
+			name:          "no certificate",
+			identity:      middleware.SubjectIdentity,
+			verified:      false,
+			wantClient:    "spoofed-key",
+			wantForwarded: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Rate-Limit-Key", "spoofed-key")
+			r.Header.Set(identityHeader, "spoofed-identity")
+
+			if tt.verified {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+
+			client, forwarded := serve(middleware.ClientCertExtractor(tt.identity, identityHeader), r)
+			assert.Equal(t, tt.wantClient, client)
+			assert.Equal(t, tt.wantForwarded, forwarded)
+		})
+	}
+}
+
+func TestSANIdentity(t *testing.T) {
+	t.Parallel()
+
+	uri, _ := url.Parse("spiffe://example.com/partner-b")
+
+	assert.Equal(t, "spiffe://example.com/partner-b", middleware.SANIdentity(&x509.Certificate{
+		URIs:     []*url.URL{uri},
+		DNSNames: []string{"b.example.com"},
+	}))
+	assert.Equal(t, "c@example.com", middleware.SANIdentity(&x509.Certificate{
+		EmailAddresses: []string{"c@example.com"},
+	}))
+	assert.Equal(t, "partner-d", middleware.SANIdentity(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "partner-d"},
+	}))
+}
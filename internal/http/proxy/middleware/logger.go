@@ -17,7 +17,7 @@ func Logger(next http.Handler) http.Handler {
 			remoteAddr = r.RemoteAddr
 		}
 
-		entry := slog.With(
+		entry := logger.With(
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
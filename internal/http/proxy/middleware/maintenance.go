@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+// ErrInvalidAllowedIP is returned when an allowed address is neither an IP nor a CIDR.
+var ErrInvalidAllowedIP = errors.New("invalid allowed IP")
+
+// MaintenanceState contains settings of the maintenance mode.
+type MaintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// RetryAfter is sent in Retry-After header in seconds, 0 omits the header.
+	RetryAfter int `json:"retryAfter"`
+	// AllowedIPs are IPs and CIDRs, that still reach the backends.
+	AllowedIPs []string `json:"allowedIPs"`
+}
+
+// Maintenance responds with 503 to requests while it's enabled, except requests from allowed IPs.
+type Maintenance struct {
+	pages *problem.Pages
+
+	mu      sync.RWMutex
+	state   MaintenanceState
+	allowed []netip.Prefix
+}
+
+// NewMaintenance creates maintenance mode with the initial state, pages are used for clients preferring HTML.
+func NewMaintenance(state MaintenanceState, pages *problem.Pages) (*Maintenance, error) {
+	m := &Maintenance{pages: pages}
+
+	if err := m.Set(state); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// State returns the current state.
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.state
+}
+
+// Set replaces the state.
+func (m *Maintenance) Set(state MaintenanceState) error {
+	allowed := make([]netip.Prefix, 0, len(state.AllowedIPs))
+
+	for _, raw := range state.AllowedIPs {
+		prefix, err := parsePrefix(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidAllowedIP, raw)
+		}
+
+		allowed = append(allowed, prefix)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state.Enabled != state.Enabled {
+		logger.Info("maintenance mode changed", slog.Bool("enabled", state.Enabled))
+	}
+
+	m.state = state
+	m.allowed = allowed
+
+	return nil
+}
+
+// parsePrefix parses CIDR or a single IP.
+func parsePrefix(raw string) (netip.Prefix, error) {
+	if strings.Contains(raw, "/") {
+		return netip.ParsePrefix(raw) //nolint:wrapcheck
+	}
+
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Prefix{}, err //nolint:wrapcheck
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// passes returns true if maintenance is disabled or the client is allowed, otherwise it returns Retry-After.
+func (m *Maintenance) passes(r *http.Request) (bool, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.state.Enabled {
+		return true, 0
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap()
+
+		for _, prefix := range m.allowed {
+			if prefix.Contains(addr) {
+				return true, 0
+			}
+		}
+	}
+
+	return false, m.state.RetryAfter
+}
+
+// Middleware responds with 503 and the maintenance page or problem details, while maintenance is enabled.
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := m.passes(r)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		data := problem.PageData{
+			Status: http.StatusServiceUnavailable,
+			Title:  "Service unavailable",
+			Detail: "Service is under maintenance, try again later",
+		}
+
+		if retryAfter > 0 {
+			data.RetryAfter = strconv.Itoa(retryAfter)
+			w.Header().Set("Retry-After", data.RetryAfter)
+		}
+
+		if m.pages.Render(w, r, problem.MaintenancePage, data) {
+			return
+		}
+
+		problem.WriteRequest(w, r, data.Title, data.Detail, data.Status)
+	})
+}
@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	m, err := middleware.NewMaintenance(middleware.MaintenanceState{
+		Enabled:    true,
+		RetryAfter: 300,
+		AllowedIPs: []string{"10.0.0.0/8", "192.0.2.1"},
+	}, nil)
+	require.NoError(t, err)
+
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "allowed cidr", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "allowed ip", remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK},
+		{
+			name:           "other client",
+			remoteAddr:     "192.0.2.2:1234",
+			wantStatus:     http.StatusServiceUnavailable,
+			wantRetryAfter: "300",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+
+	require.ErrorIs(t, m.Set(middleware.MaintenanceState{AllowedIPs: []string{"not-an-ip"}}),
+		middleware.ErrInvalidAllowedIP)
+	assert.True(t, m.State().Enabled)
+}
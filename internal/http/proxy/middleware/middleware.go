@@ -1,2 +1,6 @@
 // Package middleware provides middlewares for http requests.
 package middleware
+
+import "github.com/VasySS/cloudru-load-balancer/internal/logging"
+
+var logger = logging.Component(logging.ProxyComponent)
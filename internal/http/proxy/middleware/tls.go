@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HSTS is middleware, that sets Strict-Transport-Security header on responses to TLS requests.
+func HSTS(maxAge time.Duration, includeSubdomains, preload bool) func(http.Handler) http.Handler {
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+
+	if preload {
+		value += "; preload"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RedirectHTTPS returns a handler, that redirects all requests to the same URL on the HTTPS port.
+func RedirectHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
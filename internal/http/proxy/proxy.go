@@ -2,110 +2,474 @@
 package proxy
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/VasySS/cloudru-load-balancer/internal/accesslog"
 	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
 	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/middleware"
-	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/rewrite"
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
 )
 
-// ResponseError struct implements RFC 7807/RFC 9457 for http error responses.
-type ResponseError struct {
-	Title  string `json:"title"`
-	Status int    `json:"status"`
-	Detail string `json:"detail"`
+var logger = logging.Component(logging.ProxyComponent)
+
+// Server implements ServeHTTP interface and represents a reverse proxy server.
+type Server struct {
+	mux         *chi.Mux
+	upgrades    *upgrades
+	concurrency *concurrency.Limiter
 }
 
-func (e ResponseError) Error() string {
-	return e.Title + ": " + e.Detail
+type options struct {
+	accessLog       *accesslog.Logger
+	hsts            func(http.Handler) http.Handler
+	clientExtractor func(http.Handler) http.Handler
+	maxUpgrades     int
+	upgradeDrain    time.Duration
+	pages           *problem.Pages
+	maintenance     *middleware.Maintenance
+	concurrency     *concurrency.Limiter
 }
 
-func writeError(w http.ResponseWriter, title, detail string, status int) {
-	w.Header().Set("Content-Type", "application/problem+json")
-	w.WriteHeader(status)
+// Option configures optional features of the reverse proxy.
+type Option func(*options)
 
-	err := ResponseError{
-		Title:  title,
-		Status: status,
-		Detail: detail,
+// WithAccessLog replaces the default request logger with a structured access log.
+func WithAccessLog(l *accesslog.Logger) Option {
+	return func(o *options) {
+		o.accessLog = l
 	}
+}
 
-	//nolint:errchkjson
-	_ = json.NewEncoder(w).Encode(err)
+// WithHSTS sets Strict-Transport-Security header on responses to HTTPS requests.
+func WithHSTS(maxAge time.Duration, includeSubdomains, preload bool) Option {
+	return func(o *options) {
+		o.hsts = middleware.HSTS(maxAge, includeSubdomains, preload)
+	}
 }
 
-// Server implements ServeHTTP interface and represents a reverse proxy server.
-type Server struct {
-	mux      *chi.Mux
-	limiter  ratelimit.Limiter
-	balancer balancer.Balancer
+// WithClientCert identifies clients with verified certificates by the identity function
+// and forwards the identity to backends in the header, empty header disables forwarding.
+func WithClientCert(identity middleware.CertIdentity, header string) Option {
+	return func(o *options) {
+		o.clientExtractor = middleware.ClientCertExtractor(identity, header)
+	}
+}
+
+// WithUpgradeLimit limits concurrent upgraded connections (e.g. WebSocket) of a client, 0 means no limit.
+func WithUpgradeLimit(maxPerClient int) Option {
+	return func(o *options) {
+		o.maxUpgrades = maxPerClient
+	}
+}
+
+// WithUpgradeDrain sets how long shutdown waits for upgraded connections to be closed by clients or backends,
+// before closing them, 0 closes them right away.
+func WithUpgradeDrain(timeout time.Duration) Option {
+	return func(o *options) {
+		o.upgradeDrain = timeout
+	}
 }
 
-// New creates a new reverse proxy with rate limiter and balancer.
-func New(limiter ratelimit.Limiter, balancer balancer.Balancer) *Server {
+// WithErrorPages replaces problem details of the proxy with HTML pages for clients preferring HTML.
+func WithErrorPages(pages *problem.Pages) Option {
+	return func(o *options) {
+		o.pages = pages
+	}
+}
+
+// WithMaintenance responds with 503 to requests, while maintenance mode is enabled.
+func WithMaintenance(m *middleware.Maintenance) Option {
+	return func(o *options) {
+		o.maintenance = m
+	}
+}
+
+// WithConcurrencyLimit limits concurrent requests to backends of all pools, pools can have their own limits.
+func WithConcurrencyLimit(l *concurrency.Limiter) Option {
+	return func(o *options) {
+		o.concurrency = l
+	}
+}
+
+// New creates a new reverse proxy, that dispatches requests to pools by the routes.
+// Routes are tried from the longest path prefix, routes with equal prefixes - in the given order.
+func New(routes []Route, opts ...Option) *Server {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	clientExtractor := middleware.ClientExtractor
+	if o.clientExtractor != nil {
+		clientExtractor = o.clientExtractor
+	}
+
+	requestLogger := middleware.Logger
+	if o.accessLog != nil {
+		requestLogger = o.accessLog.Middleware
+	}
+
 	mux := chi.NewMux()
+	s := &Server{
+		mux:         mux,
+		upgrades:    newUpgrades(o.maxUpgrades, o.upgradeDrain),
+		concurrency: o.concurrency,
+	}
 
 	mux.Use(
 		chiMiddleware.Heartbeat("/health"),
 		chiMiddleware.RequestID,
-		middleware.Logger,
+		requestLogger,
 		chiMiddleware.Recoverer,
-		middleware.ClientExtractor,
+		clientExtractor,
 		chiMiddleware.CleanPath,
 		chiMiddleware.StripSlashes,
-		chiMiddleware.Compress(5),
 	)
 
-	mux.Handle("/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientInfo, ok := r.Context().Value(middleware.ClientCtxKey{}).(string)
-		if !ok {
-			writeError(w,
-				"Server error",
-				"Unable to identify client",
-				http.StatusInternalServerError,
-			)
+	if o.hsts != nil {
+		mux.Use(o.hsts)
+	}
+
+	if o.pages != nil {
+		mux.Use(o.pages.Middleware)
+	}
+
+	if o.maintenance != nil {
+		mux.Use(o.maintenance.Middleware)
+	}
+
+	for prefix, candidates := range routeTable(routes) {
+		h := s.dispatch(candidates)
+
+		if prefix == "/" {
+			mux.Handle("/*", h)
+			continue
+		}
+
+		mux.Handle(prefix, h)
+		mux.Handle(prefix+"/*", h)
+	}
+
+	mux.NotFound(notFound)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ShutdownUpgraded waits for upgraded connections to be closed during the drain timeout, then closes
+// the remaining ones and waits for their handlers to return. It must be called after http.Server.Shutdown,
+// which doesn't wait for hijacked connections.
+func (s *Server) ShutdownUpgraded(ctx context.Context) error {
+	return s.upgrades.shutdown(ctx)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	problem.WriteRequest(w, r,
+		"Not found",
+		"No route matches the request",
+		http.StatusNotFound,
+	)
+}
+
+// dispatch passes the request to the pool of the first matching route.
+func (s *Server) dispatch(candidates []Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rt := range candidates {
+			if !rt.matches(r) {
+				continue
+			}
+
+			if rt.Redirect != nil {
+				rt.Redirect.ServeHTTP(w, r)
+				return
+			}
+
+			if rt.Compress != nil {
+				rt.Compress.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					s.serve(w, r, rt)
+				})).ServeHTTP(w, r)
+
+				return
+			}
+
+			s.serve(w, r, rt)
 
 			return
 		}
 
-		if !limiter.ClientAllowed(clientInfo) {
-			writeError(w,
-				"Rate limit exceeded",
-				"Rate limit exceeded for this client, try again later",
+		notFound(w, r)
+	})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, rt Route) {
+	clientInfo, ok := r.Context().Value(middleware.ClientCtxKey{}).(string)
+	if !ok {
+		problem.WriteRequest(w, r,
+			"Server error",
+			"Unable to identify client",
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	accesslog.SetClient(r.Context(), clientInfo)
+
+	if rt.Access != nil && !rt.Access.Allows(r) {
+		problem.WriteRequest(w, r,
+			"Forbidden",
+			"Access from this address is denied",
+			http.StatusForbidden,
+		)
+
+		return
+	}
+
+	if !rt.Pool.Limiter.ClientAllowed(clientInfo) {
+		accesslog.SetRateLimit(r.Context(), accesslog.RateLimitRejected)
+		problem.WriteRequest(w, r,
+			"Rate limit exceeded",
+			"Rate limit exceeded for this client, try again later",
+			http.StatusTooManyRequests,
+		)
+
+		return
+	}
+
+	accesslog.SetRateLimit(r.Context(), accesslog.RateLimitAllowed)
+
+	if isUpgrade(r) {
+		upgradedReq, release, ok := s.upgrades.acquire(r, upgradeClient(r))
+		if !ok {
+			problem.WriteRequest(w, r,
+				"Too many connections",
+				"Too many upgraded connections for this client, close some and try again",
 				http.StatusTooManyRequests,
 			)
 
 			return
 		}
 
-		targetBackend, err := balancer.Next()
-		if err != nil {
-			// http.Error(w, "no available backends", http.StatusServiceUnavailable)
-			writeError(w,
-				"Server error",
-				"Unable to find available backend",
+		defer release()
+
+		r = upgradedReq
+		clearDeadlines(w)
+	} else if rt.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), rt.Timeout)
+		defer cancel()
+
+		r = r.WithContext(ctx)
+	}
+
+	var vars rewrite.Vars
+
+	// responses are rewritten after the cache, so stored responses don't contain per-request values
+	if rt.Rewrite != nil {
+		vars = rewrite.NewVars(r, clientInfo)
+		w = rt.Rewrite.ResponseWriter(w, vars)
+	}
+
+	var upstream http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.proxyToBackend(w, r, rt, vars)
+	})
+
+	if rt.Coalesce != nil {
+		upstream = rt.Coalesce.Middleware(upstream)
+	}
+
+	if rt.Cache != nil && !isUpgrade(r) {
+		rt.Cache.Serve(w, r, rt.Pool.Name, upstream)
+		return
+	}
+
+	upstream.ServeHTTP(w, r)
+}
+
+// proxyToBackend rewrites the request and passes it to a backend of the route pool.
+// The request is admitted by concurrency limits before the backend is selected, so rejected requests
+// don't take queue slots and backends.
+func (s *Server) proxyToBackend(w http.ResponseWriter, r *http.Request, rt Route, vars rewrite.Vars) {
+	release, ok := s.acquireConcurrency(w, r, rt)
+	if !ok {
+		return
+	}
+
+	targetBackend, releaseBackend, err := nextBackend(r, rt.Pool)
+	if err != nil {
+		release(0, concurrency.Ignored)
+		writeNoBackend(w, r, err)
+
+		return
+	}
+
+	if rt.Rewrite != nil {
+		rt.Rewrite.RewriteRequest(r, vars)
+	}
+
+	if rt.Rewrite == nil || !rt.Rewrite.PreserveHost() {
+		r.Host = targetBackend.Address().Host
+	}
+
+	accesslog.SetBackend(r.Context(), targetBackend.Address().Host)
+
+	upstreamStart := time.Now()
+	completed := false
+
+	// reverse proxy panics with http.ErrAbortHandler, when the response body can't be copied,
+	// so the slot is released and waiting requests are notified in any case
+	defer func() {
+		latency := time.Since(upstreamStart)
+		accesslog.SetUpstreamLatency(r.Context(), latency)
+
+		outcome := concurrency.Ignored
+		if completed {
+			outcome = requestOutcome(r)
+		}
+
+		releaseBackend()
+		release(latency, outcome)
+
+		if rt.Pool.Queue != nil {
+			rt.Pool.Queue.Notify()
+		}
+	}()
+
+	targetBackend.ServeHTTP(w, r)
+
+	completed = true
+}
+
+// nextBackend selects a backend and reserves its connection slot, release must be called after the request.
+// When no backend has free connections, the request waits in the pool queue, if it's enabled, and tries again.
+//
+//nolint:ireturn
+func nextBackend(r *http.Request, p *pool.Pool) (balancer.BackendServer, func(), error) {
+	var ticket *queue.Ticket
+
+	for {
+		b, release, err := balancer.Acquire(p.Balancer)
+		if err == nil || p.Queue == nil {
+			return b, release, err //nolint:wrapcheck
+		}
+
+		if ticket == nil {
+			client, _ := r.Context().Value(middleware.ClientCtxKey{}).(string)
+			ticket = p.Queue.NewTicket(r, client)
+		}
+
+		if err := p.Queue.Wait(r.Context(), ticket); err != nil {
+			return nil, nil, err //nolint:wrapcheck
+		}
+	}
+}
+
+func writeNoBackend(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, queue.ErrFull):
+		problem.WriteRequest(w, r,
+			"Service unavailable",
+			"No backend is available and the request queue is full",
+			http.StatusServiceUnavailable,
+		)
+	case errors.Is(err, queue.ErrTimeout):
+		problem.WriteRequest(w, r,
+			"Service unavailable",
+			"No backend became available while the request was waiting",
+			http.StatusServiceUnavailable,
+		)
+	case errors.Is(err, context.DeadlineExceeded):
+		problem.WriteRequest(w, r,
+			"Upstream request failed",
+			"Request was not completed before its deadline",
+			http.StatusGatewayTimeout,
+		)
+	case errors.Is(err, context.Canceled):
+		problem.WriteRequest(w, r,
+			"Upstream request failed",
+			"Request was canceled by the client",
+			problem.StatusClientClosedRequest,
+		)
+	default:
+		problem.WriteRequest(w, r,
+			"Server error",
+			"Unable to find available backend",
+			http.StatusServiceUnavailable,
+		)
+	}
+}
+
+// acquireConcurrency admits the request by the global and pool concurrency limits, upgraded connections
+// are not limited. Rejected requests get 503 with Retry-After, release must be called for admitted ones.
+func (s *Server) acquireConcurrency(
+	w http.ResponseWriter,
+	r *http.Request,
+	rt Route,
+) (func(time.Duration, concurrency.Outcome), bool) {
+	var releases []func(time.Duration, concurrency.Outcome)
+
+	release := func(rtt time.Duration, outcome concurrency.Outcome) {
+		for _, release := range releases {
+			release(rtt, outcome)
+		}
+	}
+
+	if isUpgrade(r) {
+		return release, true
+	}
+
+	for _, l := range []*concurrency.Limiter{s.concurrency, rt.Pool.Concurrency} {
+		if l == nil {
+			continue
+		}
+
+		limiterRelease, ok := l.Acquire(rt.Priority)
+		if !ok {
+			release(0, concurrency.Ignored)
+
+			if retryAfter := l.RetryAfter(); retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+
+			problem.WriteRequest(w, r,
+				"Service overloaded",
+				"Too many concurrent requests to backends, try again later",
 				http.StatusServiceUnavailable,
 			)
 
-			return
+			return nil, false
 		}
 
-		r.Host = targetBackend.Address().Host
+		releases = append(releases, limiterRelease)
+	}
 
-		targetBackend.ServeHTTP(w, r)
-	}))
+	return release, true
+}
 
-	return &Server{
-		mux:      mux,
-		limiter:  limiter,
-		balancer: balancer,
+// requestOutcome classifies the finished request for concurrency limits: expired deadlines mean overload,
+// canceled requests say nothing about backends.
+func requestOutcome(r *http.Request) concurrency.Outcome {
+	switch {
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		return concurrency.Dropped
+	case r.Context().Err() != nil:
+		return concurrency.Ignored
 	}
-}
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	return concurrency.Success
 }
@@ -0,0 +1,534 @@
+package proxy_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+func h2cProtocols() *http.Protocols {
+	var protocols http.Protocols
+
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &protocols
+}
+
+func newH2CServer(t *testing.T, h http.Handler) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.Protocols = h2cProtocols()
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestH2C(t *testing.T) {
+	t.Parallel()
+
+	upstream := newH2CServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = io.WriteString(w, r.Proto)
+		w.Header().Set("Grpc-Status", "0")
+	}))
+
+	transport := &http.Transport{Protocols: h2cProtocols()}
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		Transport:           transport,
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "grpc",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	srv := newH2CServer(t, proxy.New([]proxy.Route{{Pool: p}}))
+
+	client := &http.Client{Transport: &http.Transport{Protocols: h2cProtocols()}}
+
+	resp, err := client.Get(srv.URL + "/service/Method")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "HTTP/2.0", string(body))
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+}
+
+type denyAll struct{}
+
+func (denyAll) ClientAllowed(string) bool { return false }
+
+func TestGRPCErrors(t *testing.T) {
+	t.Parallel()
+
+	limited := newTestPool(t, "limited")
+	limited.Limiter = ratelimit.NewRejectionTracker(denyAll{}, 0)
+
+	srv := proxy.New([]proxy.Route{{PathPrefix: "/limited", Pool: limited}})
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		wantStatus  int
+		wantGRPC    string
+	}{
+		{
+			name:        "rate limited",
+			path:        "/limited/Method",
+			contentType: "application/grpc",
+			wantStatus:  http.StatusOK,
+			wantGRPC:    "8",
+		},
+		{
+			name:        "no route",
+			path:        "/other/Method",
+			contentType: "application/grpc+proto",
+			wantStatus:  http.StatusOK,
+			wantGRPC:    "12",
+		},
+		{
+			name:        "not grpc",
+			path:        "/limited/Method",
+			contentType: "application/json",
+			wantStatus:  http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			r.Header.Set("Content-Type", tt.contentType)
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantGRPC, w.Header().Get("Grpc-Status"))
+		})
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "slow",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	srv := proxy.New([]proxy.Route{{Pool: p, Timeout: time.Millisecond * 50}})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestRouteCache(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, strconv.FormatInt(requests.Add(1), 10))
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "cached",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	responseCache, err := cache.New(cache.Options{MaxBytes: 1 << 20, MaxEntryBytes: 1 << 10})
+	require.NoError(t, err)
+
+	srv := proxy.New([]proxy.Route{
+		{PathPrefix: "/cached", Pool: p, Cache: responseCache},
+		{Pool: p},
+	})
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cached", nil))
+
+		assert.Equal(t, "1", w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	assert.Equal(t, "2", w.Body.String())
+	assert.Empty(t, w.Header().Get("Cache-Status"))
+}
+
+func TestRouteAccess(t *testing.T) {
+	t.Parallel()
+
+	rules, err := access.New(access.Rules{Allow: []string{"10.0.0.0/8"}}, nil)
+	require.NoError(t, err)
+
+	srv := proxy.New([]proxy.Route{{Pool: newTestPool(t, "internal"), Access: rules}})
+
+	for remoteAddr, want := range map[string]int{"10.0.0.1:1234": http.StatusOK, "192.0.2.1:1234": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+
+		assert.Equal(t, want, w.Code, remoteAddr)
+	}
+
+	assert.Equal(t, int64(1), rules.Stats().DeniedByDefault)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "limited",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	limiter := concurrency.New(&concurrency.AIMD{}, concurrency.Options{
+		InitialLimit: 1,
+		MaxLimit:     1,
+		RetryAfter:   time.Second,
+	})
+	srv := proxy.New([]proxy.Route{{Pool: p, Priority: concurrency.HighPriority}}, proxy.WithConcurrencyLimit(limiter))
+
+	done := make(chan int)
+
+	go func() {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- w.Code
+	}()
+
+	require.Eventually(t, func() bool { return limiter.Stats().Inflight == 1 }, time.Second, time.Millisecond*10)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, 0, limiter.Stats().Inflight)
+}
+
+func TestConcurrencyLimitAborted(t *testing.T) {
+	t.Parallel()
+
+	// the backend promises a longer body and closes the connection in the middle of it
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "partial")
+		http.NewResponseController(w).Flush() //nolint:errcheck
+
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "aborted",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	limiter := concurrency.New(&concurrency.AIMD{}, concurrency.Options{InitialLimit: 1, MaxLimit: 1})
+	front := httptest.NewServer(proxy.New([]proxy.Route{{Pool: p}}, proxy.WithConcurrencyLimit(limiter)))
+	t.Cleanup(front.Close)
+
+	// the connection is aborted before the body ends, the slot is released before it's closed
+	for range 3 {
+		resp, err := front.Client().Get(front.URL)
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			assert.NotEqual(t, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+
+		require.Error(t, err)
+		assert.Equal(t, 0, limiter.Stats().Inflight)
+	}
+}
+
+func TestQueueSaturatedBackend(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		MaxConnections:      1,
+	})
+	require.NoError(t, err)
+
+	requestQueue := queue.New(queue.Options{MaxSize: 1, MaxWait: time.Second * 5})
+	p := &pool.Pool{
+		Name:     "queued",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+		Queue:    requestQueue,
+	}
+	srv := proxy.New([]proxy.Route{{Pool: p}})
+
+	done := make(chan int, 2)
+	serve := func() {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- w.Code
+	}
+
+	go serve()
+
+	require.Eventually(t, backends[0].Saturated, time.Second, time.Millisecond*10)
+
+	// the second request waits for the backend, the third one doesn't fit into the queue
+	go serve()
+
+	require.Eventually(t, func() bool { return requestQueue.Stats().Waiting == 1 }, time.Second, time.Millisecond*10)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, int64(1), requestQueue.Stats().Rejected)
+}
+
+func TestConcurrencyLimitBeforeQueue(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		MaxConnections:      1,
+	})
+	require.NoError(t, err)
+
+	requestQueue := queue.New(queue.Options{MaxSize: 1, MaxWait: time.Millisecond * 100})
+	p := &pool.Pool{
+		Name:     "queued",
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+		Queue:    requestQueue,
+	}
+
+	limiter := concurrency.New(&concurrency.AIMD{}, concurrency.Options{
+		InitialLimit: 1,
+		MaxLimit:     1,
+		RetryAfter:   time.Second,
+	})
+	srv := proxy.New([]proxy.Route{{Pool: p}}, proxy.WithConcurrencyLimit(limiter))
+
+	done := make(chan int)
+
+	go func() {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- w.Code
+	}()
+
+	require.Eventually(t, backends[0].Saturated, time.Second, time.Millisecond*10)
+
+	// the request is rejected by the concurrency limit without waiting in the queue for the backend
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Zero(t, requestQueue.Stats().Rejected)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, 0, limiter.Stats().Inflight)
+}
+
+func TestMaxConnectionsConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const maxConnections = 2
+
+	var inflight, maxInflight atomic.Int64
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := inflight.Add(1)
+		defer inflight.Add(-1)
+
+		for {
+			prev := maxInflight.Load()
+			if current <= prev || maxInflight.CompareAndSwap(prev, current) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		MaxConnections:      maxConnections,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "limited",
+		Balancer: balancer.NewLeastConnections([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+	srv := proxy.New([]proxy.Route{{Pool: p}})
+
+	var (
+		wg       sync.WaitGroup
+		accepted atomic.Int64
+	)
+
+	start := make(chan struct{})
+
+	for range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code == http.StatusOK {
+				accepted.Add(1)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	// concurrent requests don't pass the saturation check together
+	assert.LessOrEqual(t, maxInflight.Load(), int64(maxConnections))
+	assert.Positive(t, accepted.Load())
+	assert.Zero(t, backends[0].GetConnections())
+}
@@ -0,0 +1,324 @@
+// Package rewrite implements per-route request and response rewriting rules.
+package rewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/problem"
+)
+
+// ErrInvalidRedirectStatus is returned when redirect status is not a redirection code.
+var ErrInvalidRedirectStatus = errors.New("invalid redirect status")
+
+// Vars contains values, that can be used in header and redirect templates.
+type Vars struct {
+	ClientIP  string
+	Client    string // rate limit identifier
+	RequestID string
+	Scheme    string
+	Host      string
+	Method    string
+	Path      string
+	Query     string
+}
+
+// NewVars collects template values from the request.
+func NewVars(r *http.Request, client string) Vars {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return Vars{
+		ClientIP:  clientIP,
+		Client:    client,
+		RequestID: middleware.GetReqID(r.Context()),
+		Scheme:    scheme,
+		Host:      r.Host,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+	}
+}
+
+type headerValue struct {
+	name  string
+	value *template.Template
+}
+
+// headerRules modify headers in order: remove, set, add.
+type headerRules struct {
+	remove []string
+	set    []headerValue
+	add    []headerValue
+	// perClient is set when templates can use .ClientIP or .Client
+	perClient bool
+}
+
+func newHeaderRules(cfg config.HeaderRewrite) (headerRules, error) {
+	set, err := parseHeaderValues(cfg.Set)
+	if err != nil {
+		return headerRules{}, err
+	}
+
+	add, err := parseHeaderValues(cfg.Add)
+	if err != nil {
+		return headerRules{}, err
+	}
+
+	return headerRules{
+		remove:    cfg.Remove,
+		set:       set,
+		add:       add,
+		perClient: usesClient(cfg.Set) || usesClient(cfg.Add),
+	}, nil
+}
+
+// usesClient checks if any template refers to client fields. It's a text check, so it errs on the safe side.
+func usesClient(values map[string]string) bool {
+	for _, raw := range values {
+		if strings.Contains(raw, "Client") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseHeaderValues(values map[string]string) ([]headerValue, error) {
+	res := make([]headerValue, 0, len(values))
+
+	for name, raw := range values {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template of header %q: %w", name, err)
+		}
+
+		res = append(res, headerValue{name: name, value: tmpl})
+	}
+
+	return res, nil
+}
+
+func (hr headerRules) empty() bool {
+	return len(hr.remove) == 0 && len(hr.set) == 0 && len(hr.add) == 0
+}
+
+func (hr headerRules) apply(h http.Header, vars Vars) {
+	for _, name := range hr.remove {
+		h.Del(name)
+	}
+
+	for _, hv := range hr.set {
+		if v, ok := execute(hv.value, vars); ok {
+			h.Set(hv.name, v)
+		}
+	}
+
+	for _, hv := range hr.add {
+		if v, ok := execute(hv.value, vars); ok {
+			h.Add(hv.name, v)
+		}
+	}
+}
+
+type pathRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Rules contain rewriting rules of a route.
+type Rules struct {
+	request      headerRules
+	response     headerRules
+	stripPrefix  string
+	addPrefix    string
+	paths        []pathRewrite
+	preserveHost bool
+}
+
+// New compiles rewriting rules from the route config.
+func New(cfg config.Rewrite) (*Rules, error) {
+	request, err := newHeaderRules(cfg.RequestHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request header rules: %w", err)
+	}
+
+	response, err := newHeaderRules(cfg.ResponseHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("error creating response header rules: %w", err)
+	}
+
+	paths := make([]pathRewrite, 0, len(cfg.Paths))
+
+	for _, p := range cfg.Paths {
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling path pattern %q: %w", p.Pattern, err)
+		}
+
+		paths = append(paths, pathRewrite{pattern: pattern, replacement: p.Replacement})
+	}
+
+	return &Rules{
+		request:      request,
+		response:     response,
+		stripPrefix:  strings.TrimSuffix(cfg.StripPrefix, "/"),
+		addPrefix:    strings.TrimSuffix(cfg.AddPrefix, "/"),
+		paths:        paths,
+		preserveHost: cfg.PreserveHost,
+	}, nil
+}
+
+// PerClient returns true if requests to the backend can depend on the client, so they can't be shared.
+func (rr *Rules) PerClient() bool {
+	return rr != nil && rr.request.perClient
+}
+
+// PreserveHost returns true if the original Host header must be sent to the backend.
+func (rr *Rules) PreserveHost() bool {
+	return rr.preserveHost
+}
+
+// RewriteRequest applies path and request header rules.
+// Path is rewritten in order: strip prefix, regex rewrites, add prefix.
+func (rr *Rules) RewriteRequest(r *http.Request, vars Vars) {
+	path := r.URL.Path
+
+	if rr.stripPrefix != "" {
+		if trimmed, ok := strings.CutPrefix(path, rr.stripPrefix); ok && (trimmed == "" || trimmed[0] == '/') {
+			path = "/" + strings.TrimPrefix(trimmed, "/")
+		}
+	}
+
+	for _, p := range rr.paths {
+		path = p.pattern.ReplaceAllString(path, p.replacement)
+	}
+
+	if rr.addPrefix != "" {
+		path = rr.addPrefix + path
+	}
+
+	if path != r.URL.Path {
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+
+	rr.request.apply(r.Header, vars)
+}
+
+// ResponseWriter returns a writer, that applies response header rules before the headers are sent.
+func (rr *Rules) ResponseWriter(w http.ResponseWriter, vars Vars) http.ResponseWriter {
+	if rr.response.empty() {
+		return w
+	}
+
+	return &responseWriter{ResponseWriter: w, rules: rr.response, vars: vars}
+}
+
+// Redirect responds with a redirect to the location, built from the template.
+type Redirect struct {
+	location *template.Template
+	status   int
+}
+
+// NewRedirect creates a redirect from config, the status must be 301, 302, 303, 307 or 308.
+func NewRedirect(cfg config.Redirect) (*Redirect, error) {
+	status := cfg.Status
+	if status == 0 {
+		status = http.StatusFound
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRedirectStatus, status)
+	}
+
+	location, err := template.New("location").Option("missingkey=error").Parse(cfg.Location)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redirect location: %w", err)
+	}
+
+	return &Redirect{location: location, status: status}, nil
+}
+
+// ServeHTTP responds with the redirect.
+func (rd *Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	location, ok := execute(rd.location, NewVars(r, ""))
+	if !ok {
+		problem.WriteRequest(w, r,
+			"Internal server error",
+			"Unable to build redirect location",
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	http.Redirect(w, r, location, rd.status)
+}
+
+func execute(tmpl *template.Template, vars Vars) (string, bool) {
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		slog.Error("failed to execute rewrite template",
+			slog.String("template", tmpl.Name()),
+			slog.Any("error", err),
+		)
+
+		return "", false
+	}
+
+	return buf.String(), true
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+
+	rules       headerRules
+	vars        Vars
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	// informational responses are followed by the final one
+	if !rw.wroteHeader && status >= http.StatusOK {
+		rw.wroteHeader = true
+		rw.rules.apply(rw.Header(), rw.vars)
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	//nolint:wrapcheck
+	return rw.ResponseWriter.Write(p)
+}
+
+// Unwrap allows http.ResponseController to reach the flusher and hijacker of the wrapped writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
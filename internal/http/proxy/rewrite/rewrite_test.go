@@ -0,0 +1,138 @@
+package rewrite_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/rewrite"
+)
+
+func TestRewriteRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  config.Rewrite
+		path string
+		want string
+	}{
+		{name: "strip prefix", cfg: config.Rewrite{StripPrefix: "/api/"}, path: "/api/users", want: "/users"},
+		{name: "strip whole path", cfg: config.Rewrite{StripPrefix: "/api"}, path: "/api", want: "/"},
+		{name: "strip only segments", cfg: config.Rewrite{StripPrefix: "/api"}, path: "/apix/users", want: "/apix/users"},
+		{name: "add prefix", cfg: config.Rewrite{AddPrefix: "/v1/"}, path: "/users", want: "/v1/users"},
+		{
+			name: "regex rewrite",
+			cfg: config.Rewrite{Paths: []config.PathRewrite{
+				{Pattern: "^/old/(.*)$", Replacement: "/new/$1"},
+			}},
+			path: "/old/items/1",
+			want: "/new/items/1",
+		},
+		{
+			name: "all in order",
+			cfg: config.Rewrite{
+				StripPrefix: "/api",
+				Paths:       []config.PathRewrite{{Pattern: "^/users", Replacement: "/accounts"}},
+				AddPrefix:   "/internal",
+			},
+			path: "/api/users/1",
+			want: "/internal/accounts/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rules, err := rewrite.New(tt.cfg)
+			require.NoError(t, err)
+
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, tt.path, nil)
+			rules.RewriteRequest(req, rewrite.NewVars(req, ""))
+
+			assert.Equal(t, tt.want, req.URL.Path)
+		})
+	}
+}
+
+func TestRewriteHeaders(t *testing.T) {
+	t.Parallel()
+
+	rules, err := rewrite.New(config.Rewrite{
+		RequestHeaders: config.HeaderRewrite{
+			Set:    map[string]string{"X-Real-IP": "{{.ClientIP}}"},
+			Add:    map[string]string{"X-Client": "client-{{.Client}}"},
+			Remove: []string{"Cookie"},
+		},
+		ResponseHeaders: config.HeaderRewrite{
+			Set:    map[string]string{"X-Served-By": "balancer"},
+			Remove: []string{"Server"},
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("Cookie", "secret")
+	req.Header.Set("X-Real-IP", "spoofed")
+
+	vars := rewrite.NewVars(req, "key-1")
+	rules.RewriteRequest(req, vars)
+
+	assert.Equal(t, "10.1.2.3", req.Header.Get("X-Real-IP"))
+	assert.Equal(t, "client-key-1", req.Header.Get("X-Client"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+
+	rec := httptest.NewRecorder()
+	w := rules.ResponseWriter(rec, vars)
+	w.Header().Set("Server", "nginx")
+	_, _ = w.Write([]byte("ok"))
+
+	assert.Equal(t, "balancer", rec.Header().Get("X-Served-By"))
+	assert.Empty(t, rec.Header().Get("Server"))
+	assert.True(t, rules.PerClient())
+
+	rules, err = rewrite.New(config.Rewrite{
+		RequestHeaders: config.HeaderRewrite{Set: map[string]string{"X-Request-ID": "{{.RequestID}}"}},
+	})
+	require.NoError(t, err)
+	assert.False(t, rules.PerClient())
+}
+
+func TestRedirect(t *testing.T) {
+	t.Parallel()
+
+	_, err := rewrite.NewRedirect(config.Redirect{Location: "/", Status: http.StatusOK})
+	require.ErrorIs(t, err, rewrite.ErrInvalidRedirectStatus)
+
+	rd, err := rewrite.NewRedirect(config.Redirect{
+		Location: "https://new.example.com{{.Path}}?{{.Query}}",
+		Status:   http.StatusPermanentRedirect,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "http://old.example.com/a/b?x=1", nil)
+	rec := httptest.NewRecorder()
+	rd.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, "https://new.example.com/a/b?x=1", rec.Header().Get("Location"))
+
+	rd, err = rewrite.NewRedirect(config.Redirect{
+		Location: "https://new.example.com/{{index .Path 1000}}",
+		Status:   http.StatusFound,
+	})
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	rd.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"cmp"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/access"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/cache"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/coalesce"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/compress"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy/rewrite"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+)
+
+// Route maps matching requests to a pool of backends. Empty matchers match everything.
+type Route struct {
+	Host       string // exact host or "*.example.com"
+	PathPrefix string
+	Methods    []string
+	Headers    map[string]string
+	Pool       *pool.Pool
+	Rewrite    *rewrite.Rules
+	// Access denies requests from clients, that don't pass its rules, before rate limiting, when it's set.
+	Access *access.List
+	// Priority of requests, lower priorities are shed first by concurrency limits.
+	Priority concurrency.Priority
+	// Timeout is a deadline of the request to the backend, upgraded connections are not limited.
+	Timeout time.Duration
+	// Cache stores responses of the route, when it's set.
+	Cache *cache.Cache
+	// Coalesce shares responses between identical concurrent requests to the backends, when it's set.
+	Coalesce *coalesce.Group
+	// Compress compresses responses and decompresses request bodies of the route, when it's set.
+	Compress *compress.Compressor
+	// Redirect responds instead of the pool, when it's set.
+	Redirect *rewrite.Redirect
+}
+
+func (rt Route) matches(r *http.Request) bool {
+	if rt.Host != "" && !hostMatches(rt.Host, requestHost(r)) {
+		return false
+	}
+
+	if len(rt.Methods) > 0 && !slices.ContainsFunc(rt.Methods, func(m string) bool {
+		return strings.EqualFold(m, r.Method)
+	}) {
+		return false
+	}
+
+	for name, value := range rt.Headers {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+
+	return host
+}
+
+func hostMatches(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+
+	return strings.EqualFold(pattern, host)
+}
+
+// normalizePrefix converts path prefix to the form "/a/b" ("/" for the root).
+func normalizePrefix(prefix string) string {
+	return "/" + strings.Trim(prefix, "/")
+}
+
+// prefixCovers reports whether requests under path prefix p are also under the prefix.
+func prefixCovers(prefix, p string) bool {
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// routeTable contains routes, grouped by the path prefix they are mounted on in chi.
+// Routes for a prefix include the routes of shorter covering prefixes, so when
+// host or header matchers of a more specific route fail, less specific ones are tried.
+func routeTable(routes []Route) map[string][]Route {
+	res := make(map[string][]Route)
+
+	for _, rt := range routes {
+		res[normalizePrefix(rt.PathPrefix)] = nil
+	}
+
+	for prefix := range res {
+		var candidates []Route
+
+		for _, rt := range routes {
+			if prefixCovers(normalizePrefix(rt.PathPrefix), prefix) {
+				candidates = append(candidates, rt)
+			}
+		}
+
+		// longest prefix first, config order is kept for equal prefixes
+		slices.SortStableFunc(candidates, func(a, b Route) int {
+			return cmp.Compare(len(normalizePrefix(b.PathPrefix)), len(normalizePrefix(a.PathPrefix)))
+		})
+
+		res[prefix] = candidates
+	}
+
+	return res
+}
@@ -0,0 +1,120 @@
+package proxy_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+type allowAll struct{}
+
+func (allowAll) ClientAllowed(string) bool { return true }
+
+func newTestPool(t *testing.T, name string) *pool.Pool {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(srv.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{srv.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	return &pool.Pool{
+		Name:     name,
+		Balancer: balancer.NewRoundRobin([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+}
+
+func TestRouting(t *testing.T) {
+	t.Parallel()
+
+	def := newTestPool(t, "default")
+	api := newTestPool(t, "api")
+	apiV2 := newTestPool(t, "api-v2")
+	admin := newTestPool(t, "admin")
+	writes := newTestPool(t, "writes")
+
+	srv := proxy.New([]proxy.Route{
+		{PathPrefix: "/api", Headers: map[string]string{"X-Api-Version": "2"}, Pool: apiV2},
+		{PathPrefix: "/api", Methods: []string{"POST"}, Pool: writes},
+		{PathPrefix: "/api/", Pool: api},
+		{Host: "*.admin.example.com", Pool: admin},
+		{Pool: def},
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		host    string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "catch-all", method: http.MethodGet, host: "example.com", path: "/", want: "default"},
+		{name: "path prefix", method: http.MethodGet, host: "example.com", path: "/api/users", want: "api"},
+		{name: "exact prefix", method: http.MethodGet, host: "example.com", path: "/api", want: "api"},
+		{name: "prefix is segment-based", method: http.MethodGet, host: "example.com", path: "/apix", want: "default"},
+		{
+			name: "header match", method: http.MethodGet, host: "example.com", path: "/api/users",
+			headers: map[string]string{"X-Api-Version": "2"}, want: "api-v2",
+		},
+		{name: "method match", method: http.MethodPost, host: "example.com", path: "/api/users", want: "writes"},
+		{name: "wildcard host", method: http.MethodGet, host: "eu.admin.example.com:8080", path: "/", want: "admin"},
+		{
+			name: "longer prefix wins over host", method: http.MethodGet, host: "eu.admin.example.com",
+			path: "/api/users", want: "api",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequestWithContext(context.Background(), tt.method, "http://"+tt.host+tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestRoutingNoMatch(t *testing.T) {
+	t.Parallel()
+
+	srv := proxy.New([]proxy.Route{
+		{Host: "api.example.com", Pool: newTestPool(t, "api")},
+	})
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "http://other.example.com/", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upgrades tracks upgraded connections (WebSocket and other HTTP Upgrade protocols):
+// limits them per client and closes them on shutdown.
+type upgrades struct {
+	maxPerClient int
+	// drain is how long shutdown waits for connections to be closed by clients or backends.
+	drain time.Duration
+
+	// active counts handlers of upgraded connections, shutdown waits for them to return
+	active    sync.WaitGroup
+	mu        sync.Mutex
+	perClient map[string]int
+	cancels   map[*context.CancelFunc]struct{}
+}
+
+func newUpgrades(maxPerClient int, drain time.Duration) *upgrades {
+	return &upgrades{
+		maxPerClient: maxPerClient,
+		drain:        drain,
+		perClient:    make(map[string]int),
+		cancels:      make(map[*context.CancelFunc]struct{}),
+	}
+}
+
+// isUpgrade checks if the request asks to switch the protocol.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+
+	for _, v := range r.Header.Values("Connection") {
+		for token := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// upgradeClient returns the key for limiting upgrades of the client. It's the IP of the connection,
+// as identities from headers are controlled by clients and every upgraded connection comes from a new port.
+func upgradeClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// acquire registers an upgrade request of the client, returned request must be passed to the backend
+// and release must be called when the connection is closed. It returns false if the client has too many upgrades.
+func (u *upgrades) acquire(r *http.Request, client string) (*http.Request, func(), bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.maxPerClient > 0 && u.perClient[client] >= u.maxPerClient {
+		return nil, nil, false
+	}
+
+	u.perClient[client]++
+	u.active.Add(1)
+
+	// reverse proxy closes the upgraded connection, when the request context is canceled
+	ctx, cancel := context.WithCancel(r.Context())
+	u.cancels[&cancel] = struct{}{}
+
+	release := func() {
+		cancel()
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		delete(u.cancels, &cancel)
+
+		if u.perClient[client]--; u.perClient[client] <= 0 {
+			delete(u.perClient, client)
+		}
+
+		u.active.Done()
+	}
+
+	return r.WithContext(ctx), release, true
+}
+
+// shutdown waits for upgraded connections to be closed during drain, closes the remaining ones
+// and waits for their handlers to return.
+func (u *upgrades) shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		u.active.Wait()
+		close(done)
+	}()
+
+	drain := time.NewTimer(u.drain)
+	defer drain.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-drain.C:
+	case <-ctx.Done():
+	}
+
+	u.closeAll()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for upgraded connections: %w", ctx.Err())
+	}
+}
+
+// closeAll closes all upgraded connections.
+func (u *upgrades) closeAll() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for cancel := range u.cancels {
+		(*cancel)()
+	}
+}
+
+// clearDeadlines exempts the connection from server read and write timeouts, while the backend handles the handshake.
+// Deadlines are also cleared by hijacking, but only after the backend switches protocols.
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		logger.Debug("failed to clear read deadline of upgraded connection", slog.Any("error", err))
+	}
+
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("failed to clear write deadline of upgraded connection", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,166 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/http/proxy"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+// echoUpgrade switches to the "echo" protocol and sends back everything it reads.
+func echoUpgrade(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Upgrade", "echo")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	_ = brw.Flush()
+	_, _ = io.Copy(conn, brw)
+}
+
+func newUpgradeProxy(t *testing.T, opts ...proxy.Option) (*proxy.Server, *backend.Backend, string) {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(echoUpgrade))
+	t.Cleanup(upstream.Close)
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{upstream.URL}, backend.Options{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	p := &pool.Pool{
+		Name:     "ws",
+		Balancer: balancer.NewLeastConnections([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(allowAll{}, 0),
+		Backends: backends,
+	}
+
+	srv := proxy.New([]proxy.Route{{Pool: p}}, opts...)
+
+	front := httptest.NewUnstartedServer(srv)
+	front.Config.WriteTimeout = time.Millisecond * 100
+	front.Start()
+	t.Cleanup(front.Close)
+
+	return srv, backends[0], front.Listener.Addr().String()
+}
+
+// dialUpgrade opens an upgraded connection with the Rate-Limit-Key and returns it with the response status.
+func dialUpgrade(t *testing.T, addr, key string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_, err = io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: echo\r\n"+
+		"Rate-Limit-Key: "+key+"\r\n\r\n")
+	require.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+
+	return conn, br, resp.StatusCode
+}
+
+func echo(t *testing.T, conn net.Conn, br *bufio.Reader, msg string) (string, error) {
+	t.Helper()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := io.WriteString(conn, msg); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, len(msg))
+	_, err := io.ReadFull(br, buf)
+
+	return string(buf), err
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Parallel()
+
+	srv, b, addr := newUpgradeProxy(t, proxy.WithUpgradeLimit(1))
+
+	conn, br, status := dialUpgrade(t, addr, "first")
+	require.Equal(t, http.StatusSwitchingProtocols, status)
+
+	// outlives the write timeout of the server
+	time.Sleep(time.Millisecond * 200)
+
+	got, err := echo(t, conn, br, "ping")
+	require.NoError(t, err)
+	assert.Equal(t, "ping", got)
+	assert.Equal(t, int64(1), b.GetConnections())
+
+	// the limit is per connection IP, another key doesn't bypass it
+	_, _, status = dialUpgrade(t, addr, "second")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// handlers have returned, when shutdown returns
+	require.NoError(t, srv.ShutdownUpgraded(t.Context()))
+	assert.Equal(t, int64(0), b.GetConnections())
+
+	_, err = echo(t, conn, br, "pong")
+	require.Error(t, err)
+
+	_, _, status = dialUpgrade(t, addr, "first")
+	assert.Equal(t, http.StatusSwitchingProtocols, status)
+}
+
+func TestUpgradeDrain(t *testing.T) {
+	t.Parallel()
+
+	srv, b, addr := newUpgradeProxy(t, proxy.WithUpgradeDrain(time.Minute))
+
+	conn, _, status := dialUpgrade(t, addr, "client")
+	require.Equal(t, http.StatusSwitchingProtocols, status)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- srv.ShutdownUpgraded(t.Context())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown returned before the connection was closed: %v", err)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// connection closed by the client ends the drain
+	require.NoError(t, conn.Close())
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("shutdown didn't return after the connection was closed")
+	}
+
+	assert.Equal(t, int64(0), b.GetConnections())
+}
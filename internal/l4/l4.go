@@ -0,0 +1,104 @@
+// Package l4 implements layer-4 load balancing: proxying TCP connections and UDP datagrams to backend pools.
+package l4
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+)
+
+var logger = logging.Component(logging.L4Component)
+
+// ErrProxyClosed is returned by Serve after the proxy was shut down.
+var ErrProxyClosed = errors.New("l4 proxy closed")
+
+// Options contains settings of a layer-4 proxy.
+type Options struct {
+	// DialTimeout limits connecting to TCP backends.
+	DialTimeout time.Duration
+	// IdleTimeout closes TCP connections and UDP sessions without traffic in both directions.
+	IdleTimeout time.Duration
+}
+
+// upstream is a backend, that counts connections proxied outside of ServeHTTP.
+type upstream interface {
+	balancer.BackendServer
+	TrackConnection() (release func())
+}
+
+// pick checks the rate limit of the source IP and chooses a backend for a new connection.
+func pick(p *pool.Pool, addr net.Addr) (upstream, bool) {
+	ip := sourceIP(addr)
+
+	if !p.Limiter.ClientAllowed(ip) {
+		logger.Debug("connection rate limited",
+			slog.String("pool", p.Name),
+			slog.String("client", ip),
+		)
+
+		return nil, false
+	}
+
+	b, err := p.Balancer.Next()
+	if err != nil {
+		logger.Warn("no backend for connection",
+			slog.String("pool", p.Name),
+			slog.Any("error", err),
+		)
+
+		return nil, false
+	}
+
+	u, ok := b.(upstream)
+	if !ok {
+		logger.Error("backend doesn't support layer-4 proxying", slog.String("addr", b.Address().Host))
+		return nil, false
+	}
+
+	return u, true
+}
+
+func sourceIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+// activity tracks the last time traffic was seen in any direction of a connection.
+type activity struct {
+	idleTimeout time.Duration
+	last        atomic.Int64 // unix nano
+}
+
+func (a *activity) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+// idle checks if read error is a deadline and there was no traffic in any direction for the idle timeout.
+// Deadline errors on active connections are retried by the callers.
+func (a *activity) idle(err error) bool {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	return a.expired()
+}
+
+// expired checks if there was no traffic in any direction for the idle timeout.
+func (a *activity) expired() bool {
+	return time.Since(time.Unix(0, a.last.Load())) >= a.idleTimeout
+}
+
+func (a *activity) deadline() time.Time {
+	return time.Now().Add(a.idleTimeout)
+}
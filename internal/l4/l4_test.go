@@ -0,0 +1,260 @@
+package l4_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/l4"
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+// limitN allows only the first n connections.
+type limitN struct {
+	n chan struct{}
+}
+
+func newLimitN(n int) *limitN {
+	l := &limitN{n: make(chan struct{}, n)}
+	for range n {
+		l.n <- struct{}{}
+	}
+
+	return l
+}
+
+func (l *limitN) ClientAllowed(string) bool {
+	select {
+	case <-l.n:
+		return true
+	default:
+		return false
+	}
+}
+
+// blockingLimiter blocks until release is closed, like a limiter waiting for its storage.
+type blockingLimiter struct {
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLimiter) ClientAllowed(string) bool {
+	close(l.called)
+	<-l.release
+
+	return false
+}
+
+func newPool(t *testing.T, addr string, limiter ratelimit.Limiter) *pool.Pool {
+	t.Helper()
+
+	backends, err := backend.NewBackendServers(t.Context(), []string{"tcp://" + addr}, backend.Options{
+		HealthCheckInterval: time.Hour,
+		HealthCheckTimeout:  time.Second,
+		HealthCheckType:     backend.TCPHealthCheck,
+	})
+	require.NoError(t, err)
+
+	return &pool.Pool{
+		Name:     "l4",
+		Balancer: balancer.NewLeastConnections([]balancer.BackendServer{backends[0]}),
+		Limiter:  ratelimit.NewRejectionTracker(limiter, 0),
+		Backends: backends,
+	}
+}
+
+func startTCPEcho(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestTCPProxy(t *testing.T) {
+	t.Parallel()
+
+	p := newPool(t, startTCPEcho(t), newLimitN(1))
+	tp := l4.NewTCPProxy(p, l4.Options{DialTimeout: time.Second, IdleTimeout: time.Minute})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+
+	go func() { served <- tp.Serve(ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	_, err = io.WriteString(conn, "ping")
+	require.NoError(t, err)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+	assert.Equal(t, int64(1), p.Backends[0].GetConnections())
+
+	// second connection is rate limited and closed
+	limited, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	defer limited.Close()
+
+	_ = limited.SetDeadline(time.Now().Add(time.Second))
+
+	_, err = limited.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, int64(1), p.Limiter.TopRejected(1)[0].Rejections)
+
+	require.NoError(t, tp.Shutdown(t.Context()))
+	require.ErrorIs(t, <-served, l4.ErrProxyClosed)
+
+	_, err = conn.Read(buf)
+	require.Error(t, err)
+	assert.Equal(t, int64(0), p.Backends[0].GetConnections())
+}
+
+func TestTCPProxyIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	p := newPool(t, startTCPEcho(t), newLimitN(1))
+	tp := l4.NewTCPProxy(p, l4.Options{DialTimeout: time.Second, IdleTimeout: time.Millisecond * 100})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = tp.Serve(ln) }()
+
+	t.Cleanup(func() { _ = tp.Shutdown(t.Context()) })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "timeout")
+}
+
+func TestUDPProxy(t *testing.T) {
+	t.Parallel()
+
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = echo.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+
+		for {
+			n, addr, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			_, _ = echo.WriteToUDP([]byte(strings.ToUpper(string(buf[:n]))), addr)
+		}
+	}()
+
+	p := newPool(t, echo.LocalAddr().String(), newLimitN(1))
+	up := l4.NewUDPProxy(p, l4.Options{IdleTimeout: time.Millisecond * 200})
+
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	go func() { _ = up.Serve(front) }()
+
+	t.Cleanup(func() { _ = up.Shutdown(t.Context()) })
+
+	conn, err := net.Dial("udp", front.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 16)
+
+	// the same session is used for all datagrams of the client
+	for _, msg := range []string{"ping", "pong"} {
+		_, err = conn.Write([]byte(msg))
+		require.NoError(t, err)
+
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(msg), string(buf[:n]))
+	}
+
+	assert.Equal(t, int64(1), p.Backends[0].GetConnections())
+
+	// idle session is closed
+	assert.Eventually(t, func() bool {
+		return p.Backends[0].GetConnections() == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestUDPProxyShutdownWhilePicking(t *testing.T) {
+	t.Parallel()
+
+	limiter := &blockingLimiter{called: make(chan struct{}), release: make(chan struct{})}
+	defer close(limiter.release)
+
+	p := newPool(t, "127.0.0.1:1", limiter)
+	up := l4.NewUDPProxy(p, l4.Options{IdleTimeout: time.Second})
+
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	go func() { _ = up.Serve(front) }()
+
+	conn, err := net.Dial("udp", front.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	<-limiter.called
+
+	// the limiter is called without the lock of sessions
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	require.NoError(t, up.Shutdown(ctx))
+}
@@ -0,0 +1,217 @@
+package l4
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+)
+
+const tcpBufferSize = 32 << 10
+
+// TCPProxy accepts TCP connections and proxies them to backends of the pool.
+type TCPProxy struct {
+	pool *pool.Pool
+	opts Options
+
+	mu       sync.Mutex
+	closed   bool
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewTCPProxy creates a new TCP proxy to the pool.
+func NewTCPProxy(p *pool.Pool, opts Options) *TCPProxy {
+	return &TCPProxy{
+		pool:  p,
+		opts:  opts,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on the listener until the proxy is shut down.
+func (tp *TCPProxy) Serve(ln net.Listener) error {
+	tp.mu.Lock()
+	if tp.closed {
+		tp.mu.Unlock()
+		return ErrProxyClosed
+	}
+
+	tp.listener = ln
+	tp.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if tp.isClosed() {
+				return ErrProxyClosed
+			}
+
+			return err //nolint:wrapcheck
+		}
+
+		if !tp.track(conn) {
+			_ = conn.Close()
+			continue
+		}
+
+		go tp.handle(conn)
+	}
+}
+
+// Shutdown stops accepting connections, closes the active ones and waits for their handlers until ctx is done.
+// Proxied protocols are unknown, so connections can't be drained gracefully.
+func (tp *TCPProxy) Shutdown(ctx context.Context) error {
+	tp.mu.Lock()
+	tp.closed = true
+
+	if tp.listener != nil {
+		_ = tp.listener.Close()
+	}
+
+	for conn := range tp.conns {
+		_ = conn.Close()
+	}
+	tp.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		tp.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-done:
+		return nil
+	}
+}
+
+func (tp *TCPProxy) isClosed() bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	return tp.closed
+}
+
+func (tp *TCPProxy) track(conn net.Conn) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if tp.closed {
+		return false
+	}
+
+	tp.conns[conn] = struct{}{}
+	tp.wg.Add(1)
+
+	return true
+}
+
+func (tp *TCPProxy) untrack(conn net.Conn) {
+	tp.mu.Lock()
+	delete(tp.conns, conn)
+	tp.mu.Unlock()
+
+	_ = conn.Close()
+
+	tp.wg.Done()
+}
+
+func (tp *TCPProxy) handle(client net.Conn) {
+	defer tp.untrack(client)
+
+	target, ok := pick(tp.pool, client.RemoteAddr())
+	if !ok {
+		return
+	}
+
+	release := target.TrackConnection()
+	defer release()
+
+	dialer := net.Dialer{Timeout: tp.opts.DialTimeout}
+
+	server, err := dialer.Dial("tcp", target.Address().Host)
+	if err != nil {
+		logger.Warn("failed to connect to backend",
+			slog.String("pool", tp.pool.Name),
+			slog.String("addr", target.Address().Host),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	defer server.Close()
+
+	tunnel(client, server, tp.opts.IdleTimeout)
+}
+
+// tunnel copies data in both directions until both sides finish writing, an error happens,
+// or there is no traffic for the idle timeout.
+func tunnel(client, server net.Conn, idleTimeout time.Duration) {
+	act := &activity{idleTimeout: idleTimeout}
+	act.touch()
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	forward := func(dst, src net.Conn) {
+		defer wg.Done()
+
+		if err := act.copy(dst, src); err != nil {
+			// unblock the other direction
+			_ = client.Close()
+			_ = server.Close()
+
+			return
+		}
+
+		// pass the end of stream to the other side, it can still send the response
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}
+
+	go forward(server, client)
+	go forward(client, server)
+
+	wg.Wait()
+}
+
+// copy writes data from src to dst until EOF, returns nil on EOF.
+func (a *activity) copy(dst, src net.Conn) error {
+	buf := make([]byte, tcpBufferSize)
+
+	for {
+		_ = src.SetReadDeadline(a.deadline())
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			a.touch()
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			return nil
+		case !a.idle(err):
+			// the other direction is active
+		default:
+			return err //nolint:wrapcheck
+		}
+	}
+}
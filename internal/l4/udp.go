@@ -0,0 +1,263 @@
+package l4
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/pool"
+)
+
+const maxDatagramSize = 64 << 10
+
+// udpSession relays datagrams between a client address and a backend.
+type udpSession struct {
+	upstream *net.UDPConn
+	release  func()
+	activity *activity
+}
+
+// UDPProxy relays UDP datagrams to backends of the pool. Every client address gets a session
+// with its own backend socket, so replies are sent back to the right client.
+type UDPProxy struct {
+	pool *pool.Pool
+	opts Options
+
+	mu       sync.Mutex
+	closed   bool
+	conn     *net.UDPConn
+	sessions map[netip.AddrPort]*udpSession
+	wg       sync.WaitGroup
+}
+
+// NewUDPProxy creates a new UDP proxy to the pool.
+func NewUDPProxy(p *pool.Pool, opts Options) *UDPProxy {
+	return &UDPProxy{
+		pool:     p,
+		opts:     opts,
+		sessions: make(map[netip.AddrPort]*udpSession),
+	}
+}
+
+// Serve reads datagrams from the connection until the proxy is shut down.
+func (up *UDPProxy) Serve(conn *net.UDPConn) error {
+	up.mu.Lock()
+	if up.closed {
+		up.mu.Unlock()
+		return ErrProxyClosed
+	}
+
+	up.conn = conn
+	up.mu.Unlock()
+
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, addr, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if up.isClosed() {
+				return ErrProxyClosed
+			}
+
+			return err //nolint:wrapcheck
+		}
+
+		s := up.session(addr)
+		if s == nil {
+			continue
+		}
+
+		if _, err := s.upstream.Write(buf[:n]); err != nil {
+			logger.Debug("failed to send datagram to backend",
+				slog.String("pool", up.pool.Name),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// Shutdown stops reading datagrams, closes all sessions and waits for them until ctx is done.
+func (up *UDPProxy) Shutdown(ctx context.Context) error {
+	up.mu.Lock()
+	up.closed = true
+
+	if up.conn != nil {
+		_ = up.conn.Close()
+	}
+
+	for _, s := range up.sessions {
+		_ = s.upstream.Close()
+	}
+	up.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		up.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-done:
+		return nil
+	}
+}
+
+func (up *UDPProxy) isClosed() bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+
+	return up.closed
+}
+
+// session returns the session of the client, a new one is created for unknown clients.
+// It returns nil if the client is rate limited or there is no available backend.
+// Sessions are created only by Serve, so there are no concurrent sessions of one client.
+func (up *UDPProxy) session(addr netip.AddrPort) *udpSession {
+	up.mu.Lock()
+	s, ok := up.sessions[addr]
+
+	// touched under the lock, so relay doesn't remove the session as idle right before it's used
+	if ok {
+		s.activity.touch()
+	}
+
+	closed := up.closed
+	up.mu.Unlock()
+
+	if ok {
+		return s
+	}
+
+	if closed {
+		return nil
+	}
+
+	// the rate limiter can query its storage and the backend address can be resolved, so it's done without the lock
+	s = up.dial(addr)
+	if s == nil {
+		return nil
+	}
+
+	up.mu.Lock()
+	defer up.mu.Unlock()
+
+	if up.closed {
+		_ = s.upstream.Close()
+		s.release()
+
+		return nil
+	}
+
+	up.sessions[addr] = s
+	up.wg.Add(1)
+
+	go up.relay(addr, s)
+
+	return s
+}
+
+// dial chooses a backend for the client and connects to it.
+func (up *UDPProxy) dial(addr netip.AddrPort) *udpSession {
+	target, ok := pick(up.pool, net.UDPAddrFromAddrPort(addr))
+	if !ok {
+		return nil
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", target.Address().Host)
+	if err != nil {
+		logger.Warn("failed to resolve backend address",
+			slog.String("pool", up.pool.Name),
+			slog.String("addr", target.Address().Host),
+			slog.Any("error", err),
+		)
+
+		return nil
+	}
+
+	upstreamConn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		logger.Warn("failed to connect to backend",
+			slog.String("pool", up.pool.Name),
+			slog.String("addr", target.Address().Host),
+			slog.Any("error", err),
+		)
+
+		return nil
+	}
+
+	s := &udpSession{
+		upstream: upstreamConn,
+		release:  target.TrackConnection(),
+		activity: &activity{idleTimeout: up.opts.IdleTimeout},
+	}
+	s.activity.touch()
+
+	return s
+}
+
+// removeIdle removes the session, if there was still no traffic, after the idle deadline of relay.
+func (up *UDPProxy) removeIdle(addr netip.AddrPort, s *udpSession) bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+
+	if !s.activity.expired() {
+		return false
+	}
+
+	if up.sessions[addr] == s {
+		delete(up.sessions, addr)
+	}
+
+	return true
+}
+
+// relay sends replies of the backend to the client until the session is idle or closed.
+func (up *UDPProxy) relay(addr netip.AddrPort, s *udpSession) {
+	defer func() {
+		up.mu.Lock()
+		if up.sessions[addr] == s {
+			delete(up.sessions, addr)
+		}
+		up.mu.Unlock()
+
+		_ = s.upstream.Close()
+		s.release()
+		up.wg.Done()
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		_ = s.upstream.SetReadDeadline(s.activity.deadline())
+
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			if !s.activity.idle(err) {
+				continue
+			}
+
+			// a datagram of the client could arrive after the check, the session is kept, if it did
+			if errors.Is(err, os.ErrDeadlineExceeded) && !up.removeIdle(addr, s) {
+				continue
+			}
+
+			return
+		}
+
+		s.activity.touch()
+
+		if _, err := up.conn.WriteToUDPAddrPort(buf[:n], addr); err != nil {
+			logger.Debug("failed to send datagram to client",
+				slog.String("pool", up.pool.Name),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Package logging configures slog with a switchable level per application component.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrUnknownFormat is returned when log format is not supported.
+	ErrUnknownFormat = errors.New("unknown log format")
+	// ErrUnknownComponent is returned when a level is set for a component, that doesn't exist.
+	ErrUnknownComponent = errors.New("unknown log component")
+)
+
+// Format is a format of log output.
+type Format string
+
+// A list of available log formats.
+const (
+	TextFormat Format = "text"
+	JSONFormat Format = "json"
+)
+
+// A list of application components, that can have their own log level.
+const (
+	BalancerComponent    = "balancer"
+	RateLimitComponent   = "ratelimit"
+	BackendComponent     = "backend"
+	ProxyComponent       = "proxy"
+	L4Component          = "l4"
+	CacheComponent       = "cache"
+	ConcurrencyComponent = "concurrency"
+	DiscoveryComponent   = "discovery"
+	ClusterComponent     = "cluster"
+)
+
+// components contains all application components.
+var components = []string{
+	BalancerComponent,
+	RateLimitComponent,
+	BackendComponent,
+	ProxyComponent,
+	L4Component,
+	CacheComponent,
+	ConcurrencyComponent,
+	DiscoveryComponent,
+	ClusterComponent,
+}
+
+const componentKey = "component"
+
+var (
+	// root is the handler all component loggers write to, it's replaced by Setup.
+	root atomic.Pointer[slog.Handler]
+
+	levelsMu sync.RWMutex
+	// defaultLevel is used by components without an override.
+	defaultLevel = new(slog.LevelVar)
+	// overrides contains per-component levels.
+	overrides = make(map[string]*slog.LevelVar)
+)
+
+// Setup creates the root handler writing to w and sets it as slog default.
+// Component levels override the default level for loggers created with Component.
+func Setup(w io.Writer, format Format, level slog.Level, componentLevels map[string]slog.Level) error {
+	// handler filters by itself, so the root accepts everything
+	opts := &slog.HandlerOptions{Level: slog.Level(-1 << 10)}
+
+	var h slog.Handler
+
+	switch format {
+	case TextFormat:
+		h = slog.NewTextHandler(w, opts)
+	case JSONFormat:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	for component := range componentLevels {
+		if !slices.Contains(components, component) {
+			return fmt.Errorf("%w: %q", ErrUnknownComponent, component)
+		}
+	}
+
+	root.Store(&h)
+	defaultLevel.Set(level)
+
+	levelsMu.Lock()
+	clear(overrides)
+
+	for component, l := range componentLevels {
+		lv := new(slog.LevelVar)
+		lv.Set(l)
+		overrides[component] = lv
+	}
+	levelsMu.Unlock()
+
+	slog.SetDefault(slog.New(&handler{}))
+
+	return nil
+}
+
+// Component returns a logger for the given application component.
+// It's safe to call before Setup, the logger writes to the current root handler.
+func Component(name string) *slog.Logger {
+	return slog.New(&handler{component: name})
+}
+
+// SetLevel changes the log level of a component at runtime.
+// Empty component name changes the default level.
+func SetLevel(component string, level slog.Level) error {
+	if component == "" {
+		defaultLevel.Set(level)
+		return nil
+	}
+
+	if !slices.Contains(components, component) {
+		return fmt.Errorf("%w: %q", ErrUnknownComponent, component)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	lv, ok := overrides[component]
+	if !ok {
+		lv = new(slog.LevelVar)
+		overrides[component] = lv
+	}
+
+	lv.Set(level)
+
+	return nil
+}
+
+// ResetLevel removes the level override of a component, so it uses the default level again.
+func ResetLevel(component string) error {
+	if !slices.Contains(components, component) {
+		return fmt.Errorf("%w: %q", ErrUnknownComponent, component)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	delete(overrides, component)
+
+	return nil
+}
+
+// Levels returns the default level and current component overrides.
+func Levels() (slog.Level, map[string]slog.Level) {
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+
+	res := make(map[string]slog.Level, len(overrides))
+	for component, lv := range overrides {
+		res[component] = lv.Level()
+	}
+
+	return defaultLevel.Level(), res
+}
+
+func levelFor(component string) slog.Level {
+	if component != "" {
+		levelsMu.RLock()
+		lv, ok := overrides[component]
+		levelsMu.RUnlock()
+
+		if ok {
+			return lv.Level()
+		}
+	}
+
+	return defaultLevel.Level()
+}
+
+// handler filters records by component level and passes them to the root handler.
+// Attributes and groups are stored and replayed, because root can change after creation.
+type handler struct {
+	component string
+	ops       []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelFor(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	next := h.resolve()
+
+	if h.component != "" {
+		r.AddAttrs(slog.String(componentKey, h.component))
+	}
+
+	//nolint:wrapcheck
+	return next.Handle(ctx, r)
+}
+
+//nolint:ireturn
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler {
+		return next.WithAttrs(attrs)
+	})
+}
+
+//nolint:ireturn
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler {
+		return next.WithGroup(name)
+	})
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	return &handler{
+		component: h.component,
+		ops:       append(slices.Clip(h.ops), op),
+	}
+}
+
+//nolint:ireturn
+func (h *handler) resolve() slog.Handler {
+	var next slog.Handler
+
+	if p := root.Load(); p != nil {
+		next = *p
+	} else {
+		next = slog.Default().Handler()
+	}
+
+	for _, op := range h.ops {
+		next = op(next)
+	}
+
+	return next
+}
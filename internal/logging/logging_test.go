@@ -0,0 +1,57 @@
+package logging_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
+)
+
+//nolint:paralleltest
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+
+	// created before Setup, like package-level loggers
+	balancerLogger := logging.Component(logging.BalancerComponent)
+	proxyLogger := logging.Component(logging.ProxyComponent).With(slog.String("key", "value"))
+
+	err := logging.Setup(&buf, logging.JSONFormat, slog.LevelInfo, map[string]slog.Level{
+		logging.BalancerComponent: slog.LevelDebug,
+	})
+	require.NoError(t, err)
+
+	balancerLogger.Debug("balancer debug")
+	proxyLogger.Debug("proxy debug")
+	proxyLogger.Info("proxy info")
+
+	assert.Contains(t, buf.String(), `"msg":"balancer debug"`)
+	assert.Contains(t, buf.String(), `"component":"balancer"`)
+	assert.NotContains(t, buf.String(), "proxy debug")
+	assert.Contains(t, buf.String(), `"key":"value"`)
+
+	buf.Reset()
+	require.NoError(t, logging.SetLevel(logging.ProxyComponent, slog.LevelDebug))
+	require.NoError(t, logging.ResetLevel(logging.BalancerComponent))
+	require.ErrorIs(t, logging.SetLevel("unknown", slog.LevelDebug), logging.ErrUnknownComponent)
+	require.ErrorIs(t, logging.ResetLevel("unknown"), logging.ErrUnknownComponent)
+
+	balancerLogger.Debug("balancer debug")
+	proxyLogger.Debug("proxy debug")
+
+	assert.NotContains(t, buf.String(), "balancer debug")
+	assert.Contains(t, buf.String(), "proxy debug")
+
+	defaultLevel, components := logging.Levels()
+	assert.Equal(t, slog.LevelInfo, defaultLevel)
+	assert.Equal(t, map[string]slog.Level{logging.ProxyComponent: slog.LevelDebug}, components)
+
+	err = logging.Setup(&buf, "xml", slog.LevelInfo, nil)
+	require.ErrorIs(t, err, logging.ErrUnknownFormat)
+
+	err = logging.Setup(&buf, logging.JSONFormat, slog.LevelInfo, map[string]slog.Level{"unknown": slog.LevelDebug})
+	require.ErrorIs(t, err, logging.ErrUnknownComponent)
+}
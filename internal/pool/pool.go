@@ -0,0 +1,58 @@
+// Package pool groups backends together with the balancer and rate limiter serving them.
+package pool
+
+import (
+	"sync"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/backend"
+	"github.com/VasySS/cloudru-load-balancer/internal/balancer"
+	"github.com/VasySS/cloudru-load-balancer/internal/concurrency"
+	"github.com/VasySS/cloudru-load-balancer/internal/config"
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+// Pool is a named group of backends with its own balancer and rate limit policy.
+type Pool struct {
+	Name         string
+	BalancerType config.BalancerType
+	RateLimit    config.RateLimit
+	Balancer     balancer.Balancer
+	Limiter      *ratelimit.RejectionTracker
+	// Backends are the initial backends of the pool. Discovery can replace them,
+	// so they must be accessed by GetBackends and SetBackends after the pool is created.
+	Backends []*backend.Backend
+	// Concurrency limits concurrent requests to the backends, it's nil if the pool has no own limit.
+	Concurrency *concurrency.Limiter
+	// Queue holds requests, when no backend is available, it's nil if queueing is disabled.
+	Queue *queue.Queue
+
+	mu sync.RWMutex
+}
+
+// GetBackends returns the current backends of the pool.
+func (p *Pool) GetBackends() []*backend.Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.Backends
+}
+
+// SetBackends replaces backends of the pool and its balancer.
+func (p *Pool) SetBackends(backends []*backend.Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Backends = backends
+	p.Balancer.UpdateBackends(BalancerBackends(backends))
+}
+
+// BalancerBackends converts backends to the balancer interface.
+func BalancerBackends(backends []*backend.Backend) []balancer.BackendServer {
+	res := make([]balancer.BackendServer, 0, len(backends))
+	for _, b := range backends {
+		res = append(res, b)
+	}
+
+	return res
+}
@@ -0,0 +1,241 @@
+// Package queue contains a bounded priority queue of requests waiting for an available backend.
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrFull is returned when the queue has no space for a new request.
+	ErrFull = errors.New("request queue is full")
+	// ErrTimeout is returned when the request has waited for the maximum time.
+	ErrTimeout = errors.New("request queue wait timed out")
+)
+
+// pollInterval is a period, after which the first waiting request retries without a notification,
+// so backends, that became healthy, are noticed.
+const pollInterval = time.Millisecond * 100
+
+// Options contains settings of the queue.
+type Options struct {
+	// MaxSize is the amount of waiting requests, new requests are rejected when it's reached.
+	MaxSize int
+	// MaxWait is the longest time a request waits in the queue.
+	MaxWait time.Duration
+	// PriorityHeader contains an integer priority of the request, higher priorities are served first.
+	PriorityHeader string
+	// ClientPriorities are priorities of clients, used when the request has no priority header.
+	ClientPriorities map[string]int
+}
+
+// Stats contains the state and counters of the queue.
+type Stats struct {
+	Waiting int `json:"waiting"`
+	// Rejected is the amount of requests, that found the queue full.
+	Rejected int64 `json:"rejected"`
+	// Expired is the amount of requests, that waited for the maximum time.
+	Expired int64 `json:"expired"`
+}
+
+// Ticket keeps the priority, position and deadline of a request between its attempts to get a backend.
+type Ticket struct {
+	priority int
+	seq      uint64
+	deadline time.Time
+}
+
+type waiter struct {
+	ticket *Ticket
+	index  int // position in the heap, -1 when the waiter is removed
+	ready  chan struct{}
+}
+
+// waiters is a heap of waiting requests ordered by priority, then by arrival.
+type waiters []*waiter
+
+func (ws waiters) Len() int { return len(ws) }
+
+func (ws waiters) Less(i, j int) bool {
+	if ws[i].ticket.priority != ws[j].ticket.priority {
+		return ws[i].ticket.priority > ws[j].ticket.priority
+	}
+
+	return ws[i].ticket.seq < ws[j].ticket.seq
+}
+
+func (ws waiters) Swap(i, j int) {
+	ws[i], ws[j] = ws[j], ws[i]
+	ws[i].index = i
+	ws[j].index = j
+}
+
+func (ws *waiters) Push(x any) {
+	//nolint:forcetypeassert
+	w := x.(*waiter)
+	w.index = len(*ws)
+	*ws = append(*ws, w)
+}
+
+func (ws *waiters) Pop() any {
+	old := *ws
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*ws = old[:len(old)-1]
+
+	return w
+}
+
+// Queue holds requests, until a finished request or the poll interval signals, that a backend may be available.
+type Queue struct {
+	opts Options
+
+	mu      sync.Mutex
+	waiters waiters
+	seq     uint64
+
+	rejected atomic.Int64
+	expired  atomic.Int64
+}
+
+// New creates a new queue.
+func New(opts Options) *Queue {
+	return &Queue{opts: opts}
+}
+
+// NewTicket creates a ticket for the request of the client, its priority is taken from the priority header
+// or from client priorities.
+func (q *Queue) NewTicket(r *http.Request, client string) *Ticket {
+	if q.opts.PriorityHeader != "" {
+		if priority, err := strconv.Atoi(r.Header.Get(q.opts.PriorityHeader)); err == nil {
+			return &Ticket{priority: priority}
+		}
+	}
+
+	return &Ticket{priority: q.opts.ClientPriorities[client]}
+}
+
+// Stats returns the state and counters of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		Waiting:  len(q.waiters),
+		Rejected: q.rejected.Load(),
+		Expired:  q.expired.Load(),
+	}
+}
+
+// Wait blocks the request, until it's its turn to retry getting a backend, and returns nil then.
+// The ticket keeps its position, so the request can wait again if the retry fails. ErrFull, ErrTimeout
+// or the context error are returned, when the request must not wait anymore.
+func (q *Queue) Wait(ctx context.Context, t *Ticket) error {
+	w, err := q.push(t)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(min(time.Until(t.deadline), pollInterval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.ready:
+			return nil
+		case <-ctx.Done():
+			// the turn, that the request got concurrently, is passed to the next one
+			if !q.remove(w) {
+				q.Notify()
+			}
+
+			return ctx.Err() //nolint:wrapcheck
+		case <-timer.C:
+			if !time.Now().Before(t.deadline) {
+				if !q.remove(w) {
+					return nil
+				}
+
+				q.expired.Add(1)
+
+				return ErrTimeout
+			}
+
+			if q.popIfFirst(w) {
+				return nil
+			}
+
+			timer.Reset(min(time.Until(t.deadline), pollInterval))
+		}
+	}
+}
+
+// Notify gives the turn to the first waiting request, it's called when a backend may be available.
+func (q *Queue) Notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters) == 0 {
+		return
+	}
+
+	//nolint:forcetypeassert
+	w := heap.Pop(&q.waiters).(*waiter)
+	close(w.ready)
+}
+
+func (q *Queue) push(t *Ticket) (*waiter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// requests waiting again keep their place, so only new ones are limited
+	if t.seq == 0 {
+		if len(q.waiters) >= q.opts.MaxSize {
+			q.rejected.Add(1)
+			return nil, ErrFull
+		}
+
+		q.seq++
+		t.seq = q.seq
+		t.deadline = time.Now().Add(q.opts.MaxWait)
+	}
+
+	w := &waiter{ticket: t, ready: make(chan struct{})}
+	heap.Push(&q.waiters, w)
+
+	return w, nil
+}
+
+// remove returns false if the waiter has already got its turn.
+func (q *Queue) remove(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if w.index < 0 {
+		return false
+	}
+
+	heap.Remove(&q.waiters, w.index)
+
+	return true
+}
+
+func (q *Queue) popIfFirst(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if w.index != 0 {
+		return w.index < 0
+	}
+
+	heap.Pop(&q.waiters)
+
+	return true
+}
@@ -0,0 +1,115 @@
+package queue_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/queue"
+)
+
+func newRequest(priority string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if priority != "" {
+		r.Header.Set("X-Priority", priority)
+	}
+
+	return r
+}
+
+// waitFor waits until the amount of waiting requests is n.
+func waitFor(t *testing.T, q *queue.Queue, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return q.Stats().Waiting == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestQueuePriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	q := queue.New(queue.Options{
+		MaxSize:          10,
+		MaxWait:          time.Minute,
+		PriorityHeader:   "X-Priority",
+		ClientPriorities: map[string]int{"vip": 5},
+	})
+
+	served := make(chan string, 4)
+	wait := func(name, priority, client string) {
+		t.Helper()
+
+		ticket := q.NewTicket(newRequest(priority), client)
+		waiting := q.Stats().Waiting
+
+		go func() {
+			if err := q.Wait(context.Background(), ticket); err == nil {
+				served <- name
+			}
+		}()
+
+		waitFor(t, q, waiting+1)
+	}
+
+	wait("first", "", "")
+	wait("second", "", "")
+	wait("vip", "", "vip")
+	wait("urgent", "10", "vip")
+
+	for _, want := range []string{"urgent", "vip", "first", "second"} {
+		q.Notify()
+		assert.Equal(t, want, <-served)
+	}
+
+	assert.Equal(t, 0, q.Stats().Waiting)
+}
+
+func TestQueueFull(t *testing.T) {
+	t.Parallel()
+
+	q := queue.New(queue.Options{MaxSize: 1, MaxWait: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- q.Wait(ctx, q.NewTicket(newRequest(""), ""))
+	}()
+
+	waitFor(t, q, 1)
+
+	err := q.Wait(context.Background(), q.NewTicket(newRequest(""), ""))
+	require.ErrorIs(t, err, queue.ErrFull)
+	assert.Equal(t, int64(1), q.Stats().Rejected)
+
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, 0, q.Stats().Waiting)
+}
+
+func TestQueueTimeout(t *testing.T) {
+	t.Parallel()
+
+	q := queue.New(queue.Options{MaxSize: 10, MaxWait: time.Millisecond * 50})
+	ticket := q.NewTicket(newRequest(""), "")
+
+	// the only request gets a turn every poll interval and keeps its deadline between attempts
+	for {
+		err := q.Wait(context.Background(), ticket)
+		if err != nil {
+			require.ErrorIs(t, err, queue.ErrTimeout)
+			break
+		}
+	}
+
+	stats := q.Stats()
+	assert.Equal(t, int64(1), stats.Expired)
+	assert.Equal(t, 0, stats.Waiting)
+}
@@ -7,9 +7,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
 	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
 )
 
+var logger = logging.Component(logging.RateLimitComponent)
+
 // Repository defines an interface to save client data.
 //
 //go:generate go tool mockery --name=Repository
@@ -62,7 +65,7 @@ func (lb *UserBucket) ClientAllowed(identifier string) bool {
 	newTokens := max(b.tokens-leakedTokens, 0)
 
 	if newTokens+1 > b.capacity {
-		slog.Debug("leaky bucket overflow", slog.String("client", identifier))
+		logger.Debug("leaky bucket overflow", slog.String("client", identifier))
 
 		return false
 	}
@@ -70,7 +73,7 @@ func (lb *UserBucket) ClientAllowed(identifier string) bool {
 	b.tokens = newTokens + 1
 	b.lastUpdated = now
 
-	slog.Debug("request allowed by leaky bucket",
+	logger.Debug("request allowed by leaky bucket",
 		slog.String("client", identifier),
 		slog.Int("current tokens", b.tokens),
 	)
@@ -8,9 +8,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/VasySS/cloudru-load-balancer/internal/logging"
 	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
 )
 
+var logger = logging.Component(logging.RateLimitComponent)
+
 // Repository defines an interface to save client data.
 //
 //go:generate go tool mockery --name=Repository
@@ -66,7 +69,7 @@ func (tb *UserBucket) ClientAllowed(identifier string) bool {
 	for {
 		current := b.tokens.Load()
 
-		slog.Debug("token bucket check",
+		logger.Debug("token bucket check",
 			slog.String("id", identifier),
 			slog.Int64("tokens", current),
 		)
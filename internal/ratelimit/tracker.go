@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultMaxTrackedClients = 10000
+	// evictionSample is the amount of clients, among which the one with the least rejections is forgotten.
+	evictionSample = 16
+)
+
+var _ Limiter = (*RejectionTracker)(nil)
+
+// ClientRejections contains the amount of rejected requests of a client.
+type ClientRejections struct {
+	Identifier string `json:"identifier"`
+	Rejections int64  `json:"rejections"`
+}
+
+// RejectionTracker wraps a Limiter and counts rejected requests per client.
+type RejectionTracker struct {
+	limiter    Limiter
+	maxClients int
+	mu         sync.Mutex
+	rejections map[string]int64
+	// rejected counts all rejections, including ones of forgotten clients.
+	rejected atomic.Int64
+}
+
+// NewRejectionTracker creates a new RejectionTracker over the limiter.
+// When maxClients is reached, the client with the least rejections is forgotten.
+func NewRejectionTracker(limiter Limiter, maxClients int) *RejectionTracker {
+	if maxClients <= 0 {
+		maxClients = defaultMaxTrackedClients
+	}
+
+	return &RejectionTracker{
+		limiter:    limiter,
+		maxClients: maxClients,
+		rejections: make(map[string]int64),
+	}
+}
+
+// ClientAllowed checks if client is allowed to make a request and counts rejections.
+func (t *RejectionTracker) ClientAllowed(identifier string) bool {
+	if t.limiter.ClientAllowed(identifier) {
+		return true
+	}
+
+	t.rejected.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.rejections[identifier]; !ok && len(t.rejections) >= t.maxClients {
+		t.evictLeast()
+	}
+
+	t.rejections[identifier]++
+
+	return false
+}
+
+// Rejected returns the total amount of rejected requests.
+func (t *RejectionTracker) Rejected() int64 {
+	return t.rejected.Load()
+}
+
+// TopRejected returns up to n clients with the most rejected requests.
+func (t *RejectionTracker) TopRejected(n int) []ClientRejections {
+	return MergeTopRejected(n, t)
+}
+
+// MergeTopRejected sums rejections of clients from all trackers and returns up to n clients with the most rejections.
+func MergeTopRejected(n int, trackers ...*RejectionTracker) []ClientRejections {
+	counts := make(map[string]int64)
+
+	for _, t := range trackers {
+		t.mu.Lock()
+
+		for id, count := range t.rejections {
+			counts[id] += count
+		}
+
+		t.mu.Unlock()
+	}
+
+	res := make([]ClientRejections, 0, len(counts))
+	for id, count := range counts {
+		res = append(res, ClientRejections{Identifier: id, Rejections: count})
+	}
+
+	slices.SortFunc(res, func(a, b ClientRejections) int {
+		if c := cmp.Compare(b.Rejections, a.Rejections); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Identifier, b.Identifier)
+	})
+
+	return res[:min(n, len(res))]
+}
+
+// evictLeast forgets the client with the least rejections among a sample of clients,
+// so eviction doesn't scan all clients on every rejection. Map iteration order is random.
+func (t *RejectionTracker) evictLeast() {
+	var (
+		leastID    string
+		leastCount int64 = -1
+		sampled    int
+	)
+
+	for id, count := range t.rejections {
+		if leastCount == -1 || count < leastCount {
+			leastID, leastCount = id, count
+		}
+
+		sampled++
+		if sampled == evictionSample {
+			break
+		}
+	}
+
+	delete(t.rejections, leastID)
+}
@@ -0,0 +1,76 @@
+package ratelimit_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/ratelimit"
+)
+
+type denyList map[string]bool
+
+func (d denyList) ClientAllowed(identifier string) bool {
+	return !d[identifier]
+}
+
+type denyAllClients struct{}
+
+func (denyAllClients) ClientAllowed(string) bool {
+	return false
+}
+
+func TestRejectionTracker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("count rejections and return top clients", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := ratelimit.NewRejectionTracker(denyList{"a": true, "b": true, "c": true}, 0)
+
+		for range 3 {
+			assert.False(t, tracker.ClientAllowed("b"))
+		}
+
+		assert.False(t, tracker.ClientAllowed("a"))
+		assert.False(t, tracker.ClientAllowed("c"))
+		assert.True(t, tracker.ClientAllowed("allowed"))
+
+		assert.Equal(t, []ratelimit.ClientRejections{
+			{Identifier: "b", Rejections: 3},
+			{Identifier: "a", Rejections: 1},
+		}, tracker.TopRejected(2))
+		assert.Equal(t, int64(5), tracker.Rejected())
+	})
+
+	t.Run("forget client with least rejections when full", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := ratelimit.NewRejectionTracker(denyList{"a": true, "b": true, "c": true}, 2)
+
+		tracker.ClientAllowed("a")
+		tracker.ClientAllowed("a")
+		tracker.ClientAllowed("b")
+		tracker.ClientAllowed("c")
+
+		assert.Equal(t, []ratelimit.ClientRejections{
+			{Identifier: "a", Rejections: 2},
+			{Identifier: "c", Rejections: 1},
+		}, tracker.TopRejected(10))
+		assert.Equal(t, int64(4), tracker.Rejected(), "forgotten clients are counted")
+	})
+
+	t.Run("keep at most max clients", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := ratelimit.NewRejectionTracker(denyAllClients{}, 100)
+
+		for i := range 1000 {
+			tracker.ClientAllowed(strconv.Itoa(i))
+		}
+
+		assert.Len(t, tracker.TopRejected(1000), 100)
+		assert.Equal(t, int64(1000), tracker.Rejected())
+	})
+}
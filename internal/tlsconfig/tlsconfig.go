@@ -0,0 +1,344 @@
+// Package tlsconfig creates TLS configuration for listeners with SNI certificate selection and hot reload,
+// and for connections to backends.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNoCertificates is returned when no certificates are configured.
+	ErrNoCertificates = errors.New("no certificates configured")
+	// ErrUnknownVersion is returned when TLS version is not supported.
+	ErrUnknownVersion = errors.New("unknown TLS version")
+	// ErrUnknownCipherSuite is returned when cipher suite name is not supported.
+	ErrUnknownCipherSuite = errors.New("unknown cipher suite")
+	// ErrInvalidCABundle is returned when CA file contains no PEM certificates.
+	ErrInvalidCABundle = errors.New("no certificates found in CA bundle")
+)
+
+// KeyPair contains paths to PEM encoded certificate and key files.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// certificates is an immutable set of loaded certificates, indexed by names for SNI.
+type certificates struct {
+	byName   map[string]*tls.Certificate
+	fallback *tls.Certificate
+	// digest is a hash of contents of the loaded files.
+	digest [sha256.Size]byte
+}
+
+// CertStore loads certificates from disk and selects them by SNI.
+type CertStore struct {
+	pairs []KeyPair
+	certs atomic.Pointer[certificates]
+}
+
+// NewCertStore loads all key pairs. The first pair is used when SNI doesn't match any certificate.
+func NewCertStore(pairs []KeyPair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	cs := &CertStore{pairs: pairs}
+
+	certs, err := cs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	cs.certs.Store(certs)
+
+	return cs, nil
+}
+
+// GetCertificate selects a certificate by the server name: exact match, then wildcard, then the first one.
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := cs.certs.Load()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	if cert, ok := certs.byName[name]; ok {
+		return cert, nil
+	}
+
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := certs.byName["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+
+	return certs.fallback, nil
+}
+
+// WatchReload checks files for changes every interval and reloads certificates until ctx is done.
+// If reload fails, previous certificates are kept.
+func (cs *CertStore) WatchReload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cs.reloadIfChanged(); err != nil {
+				slog.Error("failed to reload TLS certificates", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads certificates, when contents of the files have changed. Contents are compared
+// instead of modification times, as files can be replaced by older ones, e.g. by Kubernetes secret updates.
+func (cs *CertStore) reloadIfChanged() error {
+	files, digest, err := cs.read()
+	if err != nil {
+		return err
+	}
+
+	if digest == cs.certs.Load().digest {
+		return nil
+	}
+
+	certs, err := cs.parse(files, digest)
+	if err != nil {
+		return err
+	}
+
+	cs.certs.Store(certs)
+	slog.Info("TLS certificates reloaded", slog.Int("count", len(cs.pairs)))
+
+	return nil
+}
+
+// pemFiles contains contents of a key pair.
+type pemFiles struct {
+	cert []byte
+	key  []byte
+}
+
+// read reads all key pairs and returns a digest of their contents.
+func (cs *CertStore) read() ([]pemFiles, [sha256.Size]byte, error) {
+	files := make([]pemFiles, 0, len(cs.pairs))
+	h := sha256.New()
+
+	for _, p := range cs.pairs {
+		cert, err := os.ReadFile(p.CertFile)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("error reading certificate file: %w", err)
+		}
+
+		key, err := os.ReadFile(p.KeyFile)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("error reading key file: %w", err)
+		}
+
+		// lengths separate contents, so moving bytes between files changes the digest
+		for _, content := range [][]byte{cert, key} {
+			h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(content))))
+			h.Write(content)
+		}
+
+		files = append(files, pemFiles{cert: cert, key: key})
+	}
+
+	return files, [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+func (cs *CertStore) load() (*certificates, error) {
+	files, digest, err := cs.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return cs.parse(files, digest)
+}
+
+func (cs *CertStore) parse(files []pemFiles, digest [sha256.Size]byte) (*certificates, error) {
+	res := &certificates{
+		byName: make(map[string]*tls.Certificate),
+		digest: digest,
+	}
+
+	for i, p := range cs.pairs {
+		cert, err := tls.X509KeyPair(files[i].cert, files[i].key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key pair %q: %w", p.CertFile, err)
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate %q: %w", p.CertFile, err)
+		}
+
+		cert.Leaf = leaf
+
+		if res.fallback == nil {
+			res.fallback = &cert
+		}
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+
+		for _, name := range names {
+			name = strings.ToLower(name)
+
+			// first configured certificate wins for duplicate names
+			if _, ok := res.byName[name]; !ok {
+				res.byName[name] = &cert
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// ParseVersion converts version like "1.2" to the crypto/tls constant.
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+}
+
+// ParseCipherSuites converts IANA cipher suite names to their IDs.
+// Empty list means Go defaults. Suites are ignored by Go for TLS 1.3.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	res := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCipherSuite, name)
+		}
+
+		res = append(res, id)
+	}
+
+	return res, nil
+}
+
+// NewServerConfig creates a listener TLS config, that takes certificates from the store.
+func NewServerConfig(store *CertStore, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	version, err := ParseVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	suites, err := ParseCipherSuites(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   suites,
+		GetCertificate: store.GetCertificate,
+	}, nil
+}
+
+// RequireClientCerts makes the listener require client certificates signed by CAs from the bundle.
+func RequireClientCerts(cfg *tls.Config, caFile string) error {
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return err
+	}
+
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return nil
+}
+
+// ClientOptions contains settings of TLS connections to backends.
+type ClientOptions struct {
+	// CAFile is a PEM bundle of trusted CAs, system roots are used if it's empty.
+	CAFile string
+	// CertFile and KeyFile are a client certificate for mTLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used for SNI and certificate verification.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewClientConfig creates a TLS config for connections to backends.
+func NewClientConfig(opts ClientOptions) (*tls.Config, error) {
+	//nolint:gosec
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client key pair: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCABundle, caFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,144 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VasySS/cloudru-load-balancer/internal/tlsconfig"
+)
+
+// writeCert writes a self-signed certificate for the names and returns its key pair.
+func writeCert(t *testing.T, dir, file string, names ...string) tlsconfig.KeyPair {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := tlsconfig.KeyPair{
+		CertFile: filepath.Join(dir, file+".crt"),
+		KeyFile:  filepath.Join(dir, file+".key"),
+	}
+
+	require.NoError(t, os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(pair.KeyFile, keyPEM, 0o600))
+
+	return pair
+}
+
+func servedName(t *testing.T, store *tlsconfig.CertStore, serverName string) string {
+	t.Helper()
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	require.NoError(t, err)
+
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertStoreSNI(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store, err := tlsconfig.NewCertStore([]tlsconfig.KeyPair{
+		writeCert(t, dir, "default", "example.com"),
+		writeCert(t, dir, "wildcard", "*.api.example.com"),
+		writeCert(t, dir, "exact", "eu.api.example.com"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "example.com", servedName(t, store, "example.com"))
+	assert.Equal(t, "eu.api.example.com", servedName(t, store, "EU.api.example.com"))
+	assert.Equal(t, "*.api.example.com", servedName(t, store, "us.api.example.com"))
+	assert.Equal(t, "example.com", servedName(t, store, "unknown.org"))
+	assert.Equal(t, "example.com", servedName(t, store, ""))
+}
+
+func TestCertStoreReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	pair := writeCert(t, dir, "site", "old.example.com")
+
+	store, err := tlsconfig.NewCertStore([]tlsconfig.KeyPair{pair})
+	require.NoError(t, err)
+
+	go store.WatchReload(t.Context(), time.Millisecond*10)
+
+	writeCert(t, dir, "site", "new.example.com")
+
+	// files replaced by older ones, e.g. with rsync -t, are reloaded too
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(pair.CertFile, past, past))
+	require.NoError(t, os.Chtimes(pair.KeyFile, past, past))
+
+	assert.Eventually(t, func() bool {
+		return servedName(t, store, "new.example.com") == "new.example.com"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestParseSettings(t *testing.T) {
+	t.Parallel()
+
+	version, err := tlsconfig.ParseVersion("1.3")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = tlsconfig.ParseVersion("2.0")
+	require.ErrorIs(t, err, tlsconfig.ErrUnknownVersion)
+
+	suites, err := tlsconfig.ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, suites)
+
+	_, err = tlsconfig.ParseCipherSuites([]string{"TLS_NOPE"})
+	require.ErrorIs(t, err, tlsconfig.ErrUnknownCipherSuite)
+}
+
+func TestNewClientConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	pair := writeCert(t, dir, "client", "client.example.com")
+
+	cfg, err := tlsconfig.NewClientConfig(tlsconfig.ClientOptions{
+		CAFile:     pair.CertFile,
+		CertFile:   pair.CertFile,
+		KeyFile:    pair.KeyFile,
+		ServerName: "backend.internal",
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.Len(t, cfg.Certificates, 1)
+	assert.Equal(t, "backend.internal", cfg.ServerName)
+
+	_, err = tlsconfig.NewClientConfig(tlsconfig.ClientOptions{CAFile: pair.KeyFile})
+	require.ErrorIs(t, err, tlsconfig.ErrInvalidCABundle)
+}